@@ -0,0 +1,133 @@
+// Package main is the aggregator of the stats of the bot's shard processes,
+// serving a combined view of all the shards for the website.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/aggregator"
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+const (
+	contextTimeout = time.Minute
+
+	// targetOrdinalPlaceholder is replaced with each StatefulSet pod ordinal
+	// in TARGET_URL_TEMPLATE.
+	targetOrdinalPlaceholder = "{ordinal}"
+)
+
+type environmentVariables struct {
+	LogLevel            string        `env:"LOG_LEVEL"             envDefault:"info"`
+	LogTimezoneLocation string        `env:"LOG_TIMEZONE_LOCATION" envDefault:"UTC"`
+	Port                string        `env:"PORT"                  envDefault:"8081"`
+	Targets             []string      `env:"TARGETS"               envSeparator:","`
+	TargetURLTemplate   string        `env:"TARGET_URL_TEMPLATE"`
+	TargetCount         int           `env:"TARGET_COUNT"`
+	ScrapeInterval      time.Duration `env:"SCRAPE_INTERVAL"       envDefault:"30s"`
+	ScrapeTimeout       time.Duration `env:"SCRAPE_TIMEOUT"        envDefault:"10s"`
+	StaleAfter          time.Duration `env:"STALE_AFTER"           envDefault:"5m"`
+	AllowOrigin         string        `env:"ALLOW_ORIGIN"`
+}
+
+// parseTargets determines the shard processes to scrape: those listed by
+// TARGETS, when set, and otherwise the TARGET_COUNT pods of the StatefulSet
+// addressed by TARGET_URL_TEMPLATE, such as
+// "http://ephemeral-roles-{ordinal}.ephemeral-roles:8081".
+func (envVars *environmentVariables) parseTargets() error {
+	if len(envVars.Targets) > 0 {
+		return nil
+	}
+
+	if envVars.TargetURLTemplate == "" || envVars.TargetCount <= 0 {
+		return errors.New("TARGETS, or TARGET_URL_TEMPLATE and TARGET_COUNT, are required")
+	}
+
+	if !strings.Contains(envVars.TargetURLTemplate, targetOrdinalPlaceholder) {
+		return fmt.Errorf("no %s in TARGET_URL_TEMPLATE %q", targetOrdinalPlaceholder, envVars.TargetURLTemplate)
+	}
+
+	for ordinal := range envVars.TargetCount {
+		envVars.Targets = append(envVars.Targets,
+			strings.ReplaceAll(envVars.TargetURLTemplate, targetOrdinalPlaceholder, strconv.Itoa(ordinal)),
+		)
+	}
+
+	return nil
+}
+
+func run() error {
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancelCtx()
+
+	ev := &environmentVariables{}
+
+	if err := env.Parse(ev); err != nil {
+		return fmt.Errorf("error parsing environment variables: %w", err)
+	}
+
+	if err := ev.parseTargets(); err != nil {
+		return fmt.Errorf("error parsing targets: %w", err)
+	}
+
+	log := logging.New(
+		logging.OptionalLogLevel(ev.LogLevel),
+		logging.OptionalTimezoneLocation(ev.LogTimezoneLocation),
+	)
+	defer log.Close()
+
+	log.Info("starting up", "targets", len(ev.Targets))
+
+	statsAggregator := aggregator.New(&aggregator.Config{
+		Log:        log.Logger,
+		Client:     internalHTTP.NewClient(internalHTTP.NewTransport()),
+		Targets:    ev.Targets,
+		Interval:   ev.ScrapeInterval,
+		Timeout:    ev.ScrapeTimeout,
+		StaleAfter: ev.StaleAfter,
+	})
+
+	go statsAggregator.Run(ctx)
+
+	httpServer := aggregator.NewServer(&aggregator.ServerConfig{
+		Log:         log.Logger,
+		Aggregator:  statsAggregator,
+		Port:        ev.Port,
+		AllowOrigin: ev.AllowOrigin,
+	})
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil {
+			if !errors.Is(err, http.ErrServerClosed) {
+				log.Error("HTTP server error", "error", err)
+			}
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), contextTimeout)
+	defer cancel()
+
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "fatal error: %s\n", err)
+
+		os.Exit(1)
+	}
+}
@@ -3,12 +3,14 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -18,20 +20,35 @@ import (
 	"github.com/disgoorg/disgo"
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/cache"
+	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/gateway"
 	"github.com/disgoorg/disgo/rest"
 	"github.com/disgoorg/disgo/sharding"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/diagnostics"
 	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/resume"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/shards"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
 )
 
 const (
-	contextTimeout  = 5 * time.Minute
-	monitorInterval = 10 * time.Second
+	contextTimeout = 5 * time.Minute
+
+	auditLogCompactInterval = time.Hour
+
+	voiceHistoryPruneInterval = 10 * time.Minute
+
+	identifyLockFile = "file"
+	identifyLockHTTP = "http"
 
 	// intents subscribes to only the gateway events the bot handles: guild,
 	// channel, and role changes (IntentGuilds), the core VoiceStateUpdate
@@ -42,6 +59,14 @@ const (
 		gateway.IntentGuildMembers
 )
 
+// sessionStores are the stores the Discord session's callbacks record to,
+// which outlive the session.
+type sessionStores struct {
+	voiceHistory *voicehistory.Store
+	audit        *audit.Store
+	settings     *settings.Store
+}
+
 type environmentVariables struct {
 	BotToken            string `env:"BOT_TOKEN,required"`
 	DiscordWebhookURL   string `env:"DISCORD_WEBHOOK_URL"`
@@ -53,10 +78,75 @@ type environmentVariables struct {
 	RoleColor           int    `env:"ROLE_COLOR_HEX2DEC"    envDefault:"16753920"`
 	InstanceName        string `env:"INSTANCE_NAME"         envDefault:"ephemeral-roles-0"`
 	ShardCount          int    `env:"SHARD_COUNT"           envDefault:"1"`
-	shardID             int
+	ShardIDs            string `env:"SHARD_IDS"`
+	ShardCountCheck     string `env:"SHARD_COUNT_CHECK"     envDefault:"off"`
+	AdminToken          string `env:"ADMIN_TOKEN"`
+
+	LogDebugGuilds            []string      `env:"LOG_DEBUG_GUILDS"            envSeparator:","`
+	DiagnosticsNotifyInterval time.Duration `env:"DIAGNOSTICS_NOTIFY_INTERVAL" envDefault:"24h"`
+	VoiceChannelMetrics       bool          `env:"VOICE_CHANNEL_METRICS"       envDefault:"false"`
+	VoiceChannelMetricsLimit  int           `env:"VOICE_CHANNEL_METRICS_LIMIT" envDefault:"100"`
+	VoiceHistoryPath          string        `env:"VOICE_HISTORY_PATH"`
+	VoiceHistoryMaxAge        time.Duration `env:"VOICE_HISTORY_MAX_AGE"       envDefault:"720h"`
+	VoiceHistoryMaxPerGuild   int           `env:"VOICE_HISTORY_MAX_PER_GUILD" envDefault:"10000"`
+	LogFilePath               string        `env:"LOG_FILE_PATH"`
+	LogFileLevel              string        `env:"LOG_FILE_LEVEL"`
+	LogFileMaxSize            int64         `env:"LOG_FILE_MAX_SIZE"           envDefault:"104857600"`
+	LogFileMaxAge             time.Duration `env:"LOG_FILE_MAX_AGE"            envDefault:"24h"`
+	LogFileMaxBackups         int           `env:"LOG_FILE_MAX_BACKUPS"        envDefault:"5"`
+	OTLPLogsEndpoint          string        `env:"OTLP_LOGS_ENDPOINT"`
+	OTLPLogsLevel             string        `env:"OTLP_LOGS_LEVEL"`
+	OTLPTracesEndpoint        string        `env:"OTLP_TRACES_ENDPOINT"`
+	OTLPTracesSampleRatio     float64       `env:"OTLP_TRACES_SAMPLE_RATIO"    envDefault:"1"`
+	AuditLogPath              string        `env:"AUDIT_LOG_PATH"`
+	SettingsPath              string        `env:"SETTINGS_PATH"`
+	AuditLogMaxAge            time.Duration `env:"AUDIT_LOG_MAX_AGE"           envDefault:"2160h"`
+	AuditLogMaxPerGuild       int           `env:"AUDIT_LOG_MAX_PER_GUILD"     envDefault:"10000"`
+	IdentifyLock              string        `env:"IDENTIFY_LOCK"`
+	IdentifyLockDir           string        `env:"IDENTIFY_LOCK_DIR"           envDefault:"/tmp/ephemeral-roles"`
+	IdentifyLockURL           string        `env:"IDENTIFY_LOCK_URL"`
+	IdentifyLockToken         string        `env:"IDENTIFY_LOCK_TOKEN"`
+	IdentifyLockServe         bool          `env:"IDENTIFY_LOCK_SERVE"         envDefault:"false"`
+	IdentifyLockServeInstance string        `env:"IDENTIFY_LOCK_SERVE_INSTANCE"`
+	SessionStatePath          string        `env:"SESSION_STATE_PATH"`
+	SessionStateMaxAge        time.Duration `env:"SESSION_STATE_MAX_AGE"       envDefault:"5m"`
+	WatchdogInterval          time.Duration `env:"WATCHDOG_INTERVAL"           envDefault:"30s"`
+	WatchdogHeartbeatTimeout  time.Duration `env:"WATCHDOG_HEARTBEAT_TIMEOUT"  envDefault:"2m"`
+	WatchdogEventTimeout      time.Duration `env:"WATCHDOG_EVENT_TIMEOUT"      envDefault:"30m"`
+	WatchdogMaxFailures       int           `env:"WATCHDOG_MAX_FAILURES"       envDefault:"3"`
+	LivenessThreshold         time.Duration `env:"LIVENESS_THRESHOLD"          envDefault:"2m"`
+	InternalAddr              string        `env:"INTERNAL_ADDR"               envDefault:"127.0.0.1:8082"`
+	InternalUsername          string        `env:"INTERNAL_USERNAME"`
+	InternalPassword          string        `env:"INTERNAL_PASSWORD"`
+	Profiling                 bool          `env:"PROFILING"                   envDefault:"false"`
+	TLSCertFile               string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile                string        `env:"TLS_KEY_FILE"`
+	TLSCertCheckInterval      time.Duration `env:"TLS_CERT_CHECK_INTERVAL"     envDefault:"1m"`
+	HTTPReadHeaderTimeout     time.Duration `env:"HTTP_READ_HEADER_TIMEOUT"    envDefault:"3s"`
+	HTTPReadTimeout           time.Duration `env:"HTTP_READ_TIMEOUT"           envDefault:"30s"`
+	HTTPWriteTimeout          time.Duration `env:"HTTP_WRITE_TIMEOUT"          envDefault:"1m"`
+	HTTPIdleTimeout           time.Duration `env:"HTTP_IDLE_TIMEOUT"           envDefault:"2m"`
+	HTTPUnencryptedHTTP2      bool          `env:"HTTP_UNENCRYPTED_HTTP2"      envDefault:"false"`
+
+	shardIDs        []int
+	shardCountCheck shards.CheckMode
 }
 
-func (envVars *environmentVariables) parseShardID() error {
+// parseShardIDs determines the shards the process manages: those named by
+// SHARD_IDS, such as "0-3", when set, and otherwise the single shard numbered
+// by the trailing ordinal of the StatefulSet pod's instance name.
+func (envVars *environmentVariables) parseShardIDs() error {
+	if envVars.ShardIDs != "" {
+		shardIDs, err := shards.ParseIDs(envVars.ShardIDs, envVars.ShardCount)
+		if err != nil {
+			return fmt.Errorf("error parsing SHARD_IDS: %w", err)
+		}
+
+		envVars.shardIDs = shardIDs
+
+		return nil
+	}
+
 	index := strings.LastIndexByte(envVars.InstanceName, '-')
 	if index < 0 {
 		return fmt.Errorf("error parsing shard ID: no trailing -<N> in instance name %q", envVars.InstanceName)
@@ -67,11 +157,51 @@ func (envVars *environmentVariables) parseShardID() error {
 		return fmt.Errorf("error parsing shard ID: %w", err)
 	}
 
-	envVars.shardID = shardID
+	envVars.shardIDs = []int{shardID}
 
 	return nil
 }
 
+// servesIdentifyLock reports whether the process serves the identify lock API:
+// with IDENTIFY_LOCK_SERVE, or when its INSTANCE_NAME is
+// IDENTIFY_LOCK_SERVE_INSTANCE, for the pods of a StatefulSet, which share
+// their environment, to pick the one serving it.
+func (envVars *environmentVariables) servesIdentifyLock() bool {
+	return envVars.IdentifyLockServe ||
+		(envVars.IdentifyLockServeInstance != "" && envVars.IdentifyLockServeInstance == envVars.InstanceName)
+}
+
+// logOptions returns the logging options configured by the environment, with
+// the file and OTLP sinks only when their destination is set.
+func (envVars *environmentVariables) logOptions() []logging.OptionFunc {
+	options := []logging.OptionFunc{
+		logging.OptionalShardIDs(envVars.shardIDs...),
+		logging.OptionalLogLevel(envVars.LogLevel),
+		logging.OptionalDebugGuilds(envVars.LogDebugGuilds...),
+		logging.OptionalTimezoneLocation(envVars.LogTimezoneLocation),
+		logging.OptionalDiscordWebhook(envVars.DiscordWebhookURL),
+	}
+
+	if envVars.LogFilePath != "" {
+		options = append(options, logging.OptionalFileSink(logging.FileSinkConfig{
+			Path:       envVars.LogFilePath,
+			Level:      envVars.LogFileLevel,
+			MaxSize:    envVars.LogFileMaxSize,
+			MaxAge:     envVars.LogFileMaxAge,
+			MaxBackups: envVars.LogFileMaxBackups,
+		}))
+	}
+
+	if envVars.OTLPLogsEndpoint != "" {
+		options = append(options, logging.OptionalOTLPSink(logging.OTLPSinkConfig{
+			Endpoint: envVars.OTLPLogsEndpoint,
+			Level:    envVars.OTLPLogsLevel,
+		}))
+	}
+
+	return options
+}
+
 func run() error {
 	ctx, cancelCtx := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancelCtx()
@@ -82,29 +212,353 @@ func run() error {
 		return fmt.Errorf("error parsing environment variables: %w", err)
 	}
 
-	if err := ev.parseShardID(); err != nil {
-		return fmt.Errorf("error parsing shard ID: %w", err)
+	if err := ev.parseShardIDs(); err != nil {
+		return fmt.Errorf("error parsing shard IDs: %w", err)
 	}
 
-	log := logging.New(
-		logging.OptionalShardID(ev.shardID),
-		logging.OptionalLogLevel(ev.LogLevel),
-		logging.OptionalTimezoneLocation(ev.LogTimezoneLocation),
-		logging.OptionalDiscordWebhook(ev.DiscordWebhookURL),
-	)
+	shardCountCheck, err := shards.ParseCheckMode(ev.ShardCountCheck)
+	if err != nil {
+		return fmt.Errorf("error parsing SHARD_COUNT_CHECK: %w", err)
+	}
+
+	ev.shardCountCheck = shardCountCheck
+
+	if ev.VoiceChannelMetricsLimit < 0 {
+		return fmt.Errorf("invalid VOICE_CHANNEL_METRICS_LIMIT: %d", ev.VoiceChannelMetricsLimit)
+	}
+
+	log := logging.New(ev.logOptions()...)
+
+	// Flush the records pending for the log sinks last, after shutdown has
+	// logged everything it will.
+	defer log.Close()
 
 	log.Info("starting up", "bot", ev.BotName)
 
+	go handleLogLevelSignals(ctx, log, ev.LogLevel)
+
+	tracingProvider := newTracingProvider(log.Logger, ev)
+	defer shutdownTracing(log.Logger, tracingProvider)
+
+	voiceHistory := voicehistory.NewStore(&voicehistory.Config{
+		MaxAge:      ev.VoiceHistoryMaxAge,
+		MaxPerGuild: ev.VoiceHistoryMaxPerGuild,
+	})
+
+	if ev.VoiceHistoryPath != "" {
+		if err := voiceHistory.Load(ev.VoiceHistoryPath); err != nil {
+			log.Warn("unable to restore voice history", "error", err)
+		}
+
+		defer saveVoiceHistory(log.Logger, voiceHistory, ev.VoiceHistoryPath)
+	}
+
+	go pruneVoiceHistory(ctx, voiceHistory)
+
+	auditStore := audit.NewStore(&audit.Config{
+		MaxAge:      ev.AuditLogMaxAge,
+		MaxPerGuild: ev.AuditLogMaxPerGuild,
+	})
+
+	if ev.AuditLogPath != "" {
+		if err := auditStore.Open(ev.AuditLogPath); err != nil {
+			log.Warn("unable to open audit log: keeping it in memory only", "error", err)
+		}
+
+		defer closeAuditLog(log.Logger, auditStore)
+
+		go compactAuditLog(ctx, log.Logger, auditStore)
+	}
+
+	settingsStore := settings.NewStore()
+
+	if ev.SettingsPath != "" {
+		if err := settingsStore.Open(ev.SettingsPath); err != nil {
+			log.Warn("unable to open settings: keeping them in memory only", "error", err)
+		}
+	}
+
+	// The certificate is loaded before connecting to Discord, so that a bad
+	// one fails startup rather than the server later.
+	tlsConfig, err := newTLSConfig(log.Logger, ev)
+	if err != nil {
+		return fmt.Errorf("error configuring TLS: %w", err)
+	}
+
 	httpClient := internalHTTP.NewClient(internalHTTP.NewTransport())
 
-	client, err := startSession(ctx, log.Logger, ev, httpClient)
+	var identifyLockConfig *internalHTTP.IdentifyLockConfig
+
+	if ev.servesIdentifyLock() {
+		if ev.IdentifyLockToken == "" {
+			return errors.New("error serving identify lock: IDENTIFY_LOCK_TOKEN is required")
+		}
+
+		identifyLockConfig = &internalHTTP.IdentifyLockConfig{
+			Token:  ev.IdentifyLockToken,
+			Leases: shards.NewLeases(0),
+		}
+	}
+
+	identifyLock, err := newIdentifyLock(ev, httpClient, identifyLockConfig)
+	if err != nil {
+		return fmt.Errorf("error configuring identify lock: %w", err)
+	}
+
+	client, callbackHandler, shardTracker, err := startSession(ctx, log.Logger, ev, httpClient, &sessionStores{
+		voiceHistory: voiceHistory,
+		audit:        auditStore,
+		settings:     settingsStore,
+	}, tracingProvider.Tracer(), identifyLock, loadSessionState(log.Logger, ev))
 	if err != nil {
 		return fmt.Errorf("error starting Discord session: %w", err)
 	}
 
-	defer client.Close(context.WithoutCancel(ctx))
+	defer closeSession(context.WithoutCancel(ctx), log.Logger, ev, client)
+
+	// A WATCHDOG_INTERVAL of 0 disables the zombie shard watchdog.
+	if ev.WatchdogInterval > 0 {
+		go monitor.NewWatchdog(&monitor.Config{Log: log.Logger}, &monitor.WatchdogConfig{
+			Tracker:          shardTracker,
+			Interval:         ev.WatchdogInterval,
+			HeartbeatTimeout: ev.WatchdogHeartbeatTimeout,
+			EventTimeout:     ev.WatchdogEventTimeout,
+			MaxFailures:      ev.WatchdogMaxFailures,
+		}).Run(ctx)
+	}
+
+	return runServer(ctx, &internalHTTP.ServerConfig{
+		Log:              log.Logger,
+		Client:           client,
+		Port:             ev.Port,
+		TLS:              tlsConfig,
+		UnencryptedHTTP2: ev.HTTPUnencryptedHTTP2,
+		Timeouts: internalHTTP.ServerTimeouts{
+			ReadHeader: ev.HTTPReadHeaderTimeout,
+			Read:       ev.HTTPReadTimeout,
+			Write:      ev.HTTPWriteTimeout,
+			Idle:       ev.HTTPIdleTimeout,
+		},
+		ShardIDs:          ev.shardIDs,
+		Liveness:          callbackHandler,
+		LivenessThreshold: ev.LivenessThreshold,
+		EphemeralRoles:    callbackHandler,
+		Shards:            shardTracker,
+		VoiceHistory:      voiceHistory,
+		Admin: &internalHTTP.AdminConfig{
+			Token:    ev.AdminToken,
+			Guilds:   callbackHandler,
+			Audit:    auditStore,
+			Settings: settingsStore,
+		},
+		LogLevel:     log,
+		IdentifyLock: identifyLockConfig,
+	}, newInternalServerConfig(log.Logger, ev))
+}
+
+// newTLSConfig returns the TLS configuration of the server, reloading the
+// certificate in TLS_CERT_FILE and TLS_KEY_FILE as they change, or nil if
+// they are not set, to serve plain HTTP.
+func newTLSConfig(log *slog.Logger, envVars *environmentVariables) (*tls.Config, error) {
+	if envVars.TLSCertFile == "" && envVars.TLSKeyFile == "" {
+		return nil, nil
+	}
+
+	if envVars.TLSCertFile == "" || envVars.TLSKeyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE are both required")
+	}
+
+	reloader, err := internalHTTP.NewCertificateReloader(
+		log, envVars.TLSCertFile, envVars.TLSKeyFile, envVars.TLSCertCheckInterval,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return internalHTTP.NewTLSConfig(reloader), nil
+}
+
+// newInternalServerConfig returns the configuration of the server for metrics
+// and profiling, or nil if INTERNAL_ADDR is empty, to not serve them.
+func newInternalServerConfig(log *slog.Logger, envVars *environmentVariables) *internalHTTP.InternalServerConfig {
+	if envVars.InternalAddr == "" {
+		return nil
+	}
+
+	if envVars.InternalUsername == "" || envVars.InternalPassword == "" {
+		log.Warn("INTERNAL_USERNAME or INTERNAL_PASSWORD not set: serving the internal endpoints without authentication",
+			"addr", envVars.InternalAddr,
+			"profiling", envVars.Profiling,
+		)
+	}
+
+	return &internalHTTP.InternalServerConfig{
+		Log:       log,
+		Addr:      envVars.InternalAddr,
+		Profiling: envVars.Profiling,
+		Username:  envVars.InternalUsername,
+		Password:  envVars.InternalPassword,
+	}
+}
+
+// newIdentifyLock returns the lock coordinating IDENTIFYs across processes
+// configured by IDENTIFY_LOCK, or nil for disgo's default of spacing them out
+// within the process only. A process serving the identify lock API takes its
+// own leases directly, rather than through the API.
+func newIdentifyLock(
+	envVars *environmentVariables,
+	httpClient *http.Client,
+	served *internalHTTP.IdentifyLockConfig,
+) (shards.IdentifyLock, error) {
+	switch envVars.IdentifyLock {
+	case "":
+		return nil, nil
+	case identifyLockFile:
+		return shards.NewFileLock(envVars.IdentifyLockDir)
+	case identifyLockHTTP:
+		if served != nil {
+			return served.Leases.Lock(), nil
+		}
+
+		if envVars.IdentifyLockURL == "" {
+			return nil, errors.New("IDENTIFY_LOCK_URL is required")
+		}
+
+		return internalHTTP.NewIdentifyLock(httpClient, envVars.IdentifyLockURL, envVars.IdentifyLockToken), nil
+	default:
+		return nil, fmt.Errorf("invalid IDENTIFY_LOCK: %q", envVars.IdentifyLock)
+	}
+}
+
+// handleLogLevelSignals switches the logging level to debug on SIGUSR1 and
+// back to the configured level on SIGUSR2, for operators with shell access to
+// the pod but not the admin API.
+func handleLogLevelSignals(ctx context.Context, log *logging.Logger, configuredLevel string) {
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			level := configuredLevel
+			if sig == syscall.SIGUSR1 {
+				level = logging.DebugLevel
+			}
+
+			log.UpdateLevel(level, "source", "signal", "signal", sig.String())
+		}
+	}
+}
+
+// newTracingProvider returns the provider exporting event traces, or nil when
+// no OTLP traces endpoint is configured or it can't be set up: tracing is
+// diagnostic, so it never prevents startup.
+func newTracingProvider(log *slog.Logger, envVars *environmentVariables) *tracing.Provider {
+	if envVars.OTLPTracesEndpoint == "" {
+		return nil
+	}
+
+	provider, err := tracing.NewProvider(&tracing.Config{
+		Endpoint:    envVars.OTLPTracesEndpoint,
+		SampleRatio: envVars.OTLPTracesSampleRatio,
+	})
+	if err != nil {
+		log.Warn("unable to configure tracing: skipping", "error", err)
+		return nil
+	}
+
+	return provider
+}
+
+// shutdownTracing flushes the spans pending export on shutdown.
+func shutdownTracing(log *slog.Logger, provider *tracing.Provider) {
+	if err := provider.Shutdown(); err != nil {
+		log.Error("unable to flush traces", "error", err)
+	}
+}
+
+// compactAuditLog periodically compacts the audit log file, so that entries
+// past their retention are dropped from it and not just from memory.
+func compactAuditLog(ctx context.Context, log *slog.Logger, auditStore *audit.Store) {
+	ticker := time.NewTicker(auditLogCompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := auditStore.Compact(); err != nil {
+				log.Error("unable to compact audit log", "error", err)
+			}
+		}
+	}
+}
+
+// closeAuditLog closes the audit log file on shutdown.
+func closeAuditLog(log *slog.Logger, auditStore *audit.Store) {
+	if err := auditStore.Close(); err != nil {
+		log.Error("unable to close audit log", "error", err)
+	}
+}
+
+// loadSessionState returns the gateway sessions saved by the previous process
+// to resume, or nil to IDENTIFY.
+func loadSessionState(log *slog.Logger, envVars *environmentVariables) *resume.State {
+	if envVars.SessionStatePath == "" {
+		return nil
+	}
+
+	state, err := resume.Load(envVars.SessionStatePath, envVars.SessionStateMaxAge, envVars.ShardCount)
+	if err != nil {
+		log.Warn("unable to resume sessions: identifying instead", "error", err)
+		return nil
+	}
+
+	return state
+}
+
+// closeSession closes the Discord session on shutdown. With SESSION_STATE_PATH
+// set, the shards are closed keeping their sessions resumable, and the
+// sessions are saved for the next process to resume.
+func closeSession(ctx context.Context, log *slog.Logger, envVars *environmentVariables, client *bot.Client) {
+	defer client.Close(ctx)
+
+	if envVars.SessionStatePath == "" {
+		return
+	}
+
+	if err := resume.Suspend(ctx, client, envVars.ShardCount).Save(envVars.SessionStatePath); err != nil {
+		log.Error("unable to save session state", "error", err)
+	}
+}
 
-	return runServer(ctx, log.Logger, client, ev.Port)
+// pruneVoiceHistory periodically applies the voice history's retention
+// limits, off the gateway read loops recording the sessions.
+func pruneVoiceHistory(ctx context.Context, voiceHistory *voicehistory.Store) {
+	ticker := time.NewTicker(voiceHistoryPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			voiceHistory.Prune(now)
+		}
+	}
+}
+
+// saveVoiceHistory persists the voice history on shutdown, so it survives a
+// restart.
+func saveVoiceHistory(log *slog.Logger, voiceHistory *voicehistory.Store, path string) {
+	if err := voiceHistory.Save(path); err != nil {
+		log.Error("unable to save voice history", "error", err)
+	}
 }
 
 func startSession(
@@ -112,17 +566,50 @@ func startSession(
 	log *slog.Logger,
 	envVars *environmentVariables,
 	httpClient *http.Client,
-) (*bot.Client, error) {
+	stores *sessionStores,
+	tracer trace.Tracer,
+	identifyLock shards.IdentifyLock,
+	resumeState *resume.State,
+) (*bot.Client, *callbacks.Handler, *monitor.ShardTracker, error) {
+	shardingOpts := []sharding.ConfigOpt{
+		sharding.WithShardIDs(envVars.shardIDs...),
+		sharding.WithShardCount(envVars.ShardCount),
+		sharding.WithAutoScaling(false),
+		sharding.WithGatewayConfigOpts(
+			gateway.WithIntents(intents),
+		),
+	}
+
+	if resumeState != nil {
+		shardingOpts = append(shardingOpts, sharding.WithShardIDsWithStates(resumeState.ShardStates(envVars.shardIDs)))
+	}
+
+	recommendation, err := checkShardCount(ctx, log, envVars, httpClient)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// max_concurrency is only known once the recommendation has been
+	// fetched, for SHARD_COUNT_CHECK or IDENTIFY_LOCK; without it IDENTIFYs
+	// share a single bucket, which is always safe.
+	switch {
+	case identifyLock != nil:
+		shardingOpts = append(shardingOpts, sharding.WithIdentifyRateLimiter(
+			shards.NewIdentifyRateLimiter(&shards.IdentifyRateLimiterConfig{
+				Log:            log,
+				Lock:           identifyLock,
+				MaxConcurrency: recommendation.MaxConcurrency,
+			}),
+		))
+	case recommendation.MaxConcurrency > 0:
+		shardingOpts = append(shardingOpts, sharding.WithIdentifyRateLimiterConfigOpt(
+			gateway.WithIdentifyMaxConcurrency(recommendation.MaxConcurrency),
+		))
+	}
+
 	client, err := disgo.New(envVars.BotToken,
 		bot.WithLogger(log),
-		bot.WithShardManagerConfigOpts(
-			sharding.WithShardIDs(envVars.shardID),
-			sharding.WithShardCount(envVars.ShardCount),
-			sharding.WithAutoScaling(false),
-			sharding.WithGatewayConfigOpts(
-				gateway.WithIntents(intents),
-			),
-		),
+		bot.WithShardManagerConfigOpts(shardingOpts...),
 		bot.WithCacheConfigOpts(
 			cache.WithCaches(
 				cache.FlagGuilds,
@@ -137,33 +624,130 @@ func startSession(
 		),
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	metricsConfig := &monitor.Config{Log: log}
+	callbackMetrics := monitor.NewMetrics(metricsConfig)
+
+	// Per-guild and per-channel voice series are opt-in: even capped, they
+	// multiply the number of series each shard exports.
+	if envVars.VoiceChannelMetrics {
+		monitor.NewVoiceChannelCollector(metricsConfig, client, envVars.VoiceChannelMetricsLimit)
 	}
 
-	callbackMetrics := monitor.NewMetrics(&monitor.Config{
-		Log:      log,
-		Client:   client,
-		Interval: monitorInterval,
+	diagnosticsReporter := diagnostics.NewReporter(&diagnostics.Config{
+		Log:            log,
+		Client:         client,
+		BotName:        envVars.BotName,
+		RolePrefix:     envVars.RolePrefix,
+		NotifyInterval: envVars.DiagnosticsNotifyInterval,
+		NotifyChannel:  stores.settings.NotificationChannel,
 	})
 
-	addCallbackHandlers(client,
-		&callbacks.Handler{
-			Log:                     log,
-			RolePrefix:              envVars.RolePrefix,
-			RoleColor:               envVars.RoleColor,
-			ReadyCounter:            callbackMetrics.ReadyCounter,
-			VoiceStateUpdateCounter: callbackMetrics.VoiceStateUpdateCounter,
-			OperationsGateway:       operations.NewGateway(client),
-		},
-	)
+	callbackHandler := &callbacks.Handler{
+		Log:                     log,
+		BotName:                 envVars.BotName,
+		RolePrefix:              envVars.RolePrefix,
+		RoleColor:               envVars.RoleColor,
+		ReadyCounter:            callbackMetrics.ReadyCounter,
+		VoiceStateUpdateCounter: callbackMetrics.VoiceStateUpdateCounter,
+		VoiceTransitionsCounter: callbackMetrics.VoiceTransitionsCounter,
+		GuildOnboardingCounter:  callbackMetrics.GuildOnboardingCounter,
+		OperationsGateway:       operations.NewGateway(client),
+		Diagnostics:             diagnosticsReporter,
+		Settings:                stores.settings,
+		VoiceHistory:            stores.voiceHistory,
+		Audit:                   stores.audit,
+		Tracer:                  tracer,
+		LogShardIDs:             len(envVars.shardIDs) > 1,
+	}
+
+	// Dispatches are timed from before the first listener to after the last,
+	// for the liveness check.
+	client.AddEventListeners(bot.NewListenerFunc(callbackHandler.DispatchStarted))
+
+	addCallbackHandlers(client, callbackHandler)
+
+	addMetricsHandlers(client, callbackMetrics)
+
+	shardTracker := monitor.NewShardTracker(metricsConfig, client, envVars.ShardCount, envVars.shardIDs)
+	client.AddEventListeners(bot.NewListenerFunc(shardTracker.Event))
+
+	// The cache of resumed shards is restored before they open, since the
+	// events replayed on RESUME depend on it.
+	if resumeState != nil {
+		resumer := resume.NewResumer(&resume.Config{Log: log, Metrics: callbackMetrics})
+		resumer.Restore(client, resumeState, envVars.shardIDs)
+
+		client.AddEventListeners(
+			bot.NewListenerFunc(resumer.Resumed),
+			bot.NewListenerFunc(resumer.Ready),
+		)
+	}
+
+	client.AddEventListeners(bot.NewListenerFunc(callbackHandler.DispatchDone))
+
+	// Slash commands are global, so only the process managing shard 0 needs to
+	// register them.
+	if slices.Contains(envVars.shardIDs, 0) {
+		registerCommands(log, client)
+	}
 
 	if err := client.OpenShardManager(ctx); err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	return client, callbackHandler, shardTracker, nil
+}
+
+// checkShardCount validates the configured shard count against Discord's
+// recommended sharding, as configured by SHARD_COUNT_CHECK, and returns the
+// recommendation, if it was fetched. With IDENTIFY_LOCK set, the
+// recommendation is fetched even when the check is off, for its
+// max_concurrency to size the identify lock's buckets.
+func checkShardCount(
+	ctx context.Context,
+	log *slog.Logger,
+	envVars *environmentVariables,
+	httpClient *http.Client,
+) (shards.Recommendation, error) {
+	if envVars.shardCountCheck == shards.CheckModeOff && envVars.IdentifyLock == "" {
+		return shards.Recommendation{}, nil
+	}
+
+	restClient := rest.NewClient(envVars.BotToken, rest.WithLogger(log), rest.WithHTTPClient(httpClient))
+	defer restClient.Close(context.WithoutCancel(ctx))
+
+	requestCtx, cancel := operations.RequestContext(ctx)
+	defer cancel()
+
+	if envVars.shardCountCheck != shards.CheckModeOff {
+		return shards.Check(requestCtx, log, rest.New(restClient), envVars.ShardCount, envVars.shardCountCheck)
 	}
 
-	go callbackMetrics.Monitor(ctx)
+	recommendation, err := shards.FetchRecommendation(requestCtx, rest.New(restClient))
+	if err != nil {
+		log.Warn("unable to fetch gateway max concurrency: identifying one shard at a time", "error", err)
+		return shards.Recommendation{}, nil
+	}
 
-	return client, nil
+	return recommendation, nil
+}
+
+// registerCommands registers the bot's slash commands with Discord. A failure
+// is logged rather than returned: role management doesn't depend on them.
+func registerCommands(log *slog.Logger, client *bot.Client) {
+	ctx, cancel := operations.RequestContext(context.Background())
+	defer cancel()
+
+	_, err := client.Rest.SetGlobalCommands(client.ApplicationID,
+		[]discord.ApplicationCommandCreate{callbacks.VoiceHistoryCommand},
+		rest.WithCtx(ctx),
+	)
+	if err != nil {
+		log.Error("unable to register slash commands", "error", err)
+	}
 }
 
 func addCallbackHandlers(client *bot.Client, callbackConfig *callbacks.Handler) {
@@ -171,31 +755,62 @@ func addCallbackHandlers(client *bot.Client, callbackConfig *callbacks.Handler)
 		bot.NewListenerFunc(callbackConfig.Ready),
 		bot.NewListenerFunc(callbackConfig.VoiceStateUpdate),
 		bot.NewListenerFunc(callbackConfig.ChannelDelete),
+		bot.NewListenerFunc(callbackConfig.GuildJoin),
+		bot.NewListenerFunc(callbackConfig.GuildLeave),
+		bot.NewListenerFunc(callbackConfig.ApplicationCommand),
 	)
 }
 
+func addMetricsHandlers(client *bot.Client, metrics *monitor.Metrics) {
+	client.AddEventListeners(
+		bot.NewListenerFunc(metrics.GuildReady),
+		bot.NewListenerFunc(metrics.GuildAvailable),
+		bot.NewListenerFunc(metrics.GuildJoin),
+		bot.NewListenerFunc(metrics.GuildUnavailable),
+		bot.NewListenerFunc(metrics.GuildLeave),
+		bot.NewListenerFunc(metrics.GuildMemberJoin),
+		bot.NewListenerFunc(metrics.GuildMemberLeave),
+		bot.NewListenerFunc(metrics.GuildVoiceJoin),
+		bot.NewListenerFunc(metrics.GuildVoiceLeave),
+	)
+}
+
+// runServer serves the public endpoints and, with internalConfig set, the
+// internal ones, until ctx is done.
 func runServer(
 	ctx context.Context,
-	log *slog.Logger,
-	client *bot.Client,
-	port string,
+	serverConfig *internalHTTP.ServerConfig,
+	internalConfig *internalHTTP.InternalServerConfig,
 ) error {
-	httpServer := internalHTTP.NewServer(log, client, port)
+	log := serverConfig.Log
+	httpServers := []*http.Server{internalHTTP.NewServer(serverConfig)}
+
+	if internalConfig != nil {
+		httpServers = append(httpServers, internalHTTP.NewInternalServer(internalConfig))
+	}
 
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				log.Error("HTTP server error", "error", err)
+	for _, httpServer := range httpServers {
+		go func() {
+			if err := internalHTTP.ListenAndServe(httpServer); err != nil {
+				if !errors.Is(err, http.ErrServerClosed) {
+					log.Error("HTTP server error", "addr", httpServer.Addr, "error", err)
+				}
 			}
-		}
-	}()
+		}()
+	}
 
 	<-ctx.Done()
 
 	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), contextTimeout)
 	defer cancel()
 
-	return httpServer.Shutdown(shutdownCtx)
+	var errs []error
+
+	for _, httpServer := range httpServers {
+		errs = append(errs, httpServer.Shutdown(shutdownCtx))
+	}
+
+	return errors.Join(errs...)
 }
 
 func main() {
@@ -0,0 +1,368 @@
+// Package aggregator merges the stats of the bot's shards, each only seeing
+// the guilds of the shards its process manages, into a combined view of all
+// of them.
+//
+// The stats endpoints of the shard processes are scraped periodically rather
+// than on request, so the combined view is served fast and without loading
+// the shards. A shard process that can't be scraped keeps contributing its
+// last stats until they are too old to be trusted, so a rolling restart
+// doesn't make the totals dip.
+package aggregator
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+// Aggregator defaults.
+const (
+	DefaultInterval   = 30 * time.Second
+	DefaultTimeout    = 10 * time.Second
+	DefaultStaleAfter = 5 * time.Minute
+)
+
+// Config contains fields for configuring an Aggregator.
+type Config struct {
+	Log    *slog.Logger
+	Client *http.Client
+
+	// Targets are the base URLs of the shard processes' HTTP servers.
+	Targets []string
+
+	// Interval is how often the targets are scraped.
+	Interval time.Duration
+
+	// Timeout bounds the scrape of each target.
+	Timeout time.Duration
+
+	// StaleAfter is how long the stats of a target that can't be scraped keep
+	// being served since its last successful scrape.
+	StaleAfter time.Duration
+}
+
+// TargetStatus is the outcome of scraping a target.
+type TargetStatus struct {
+	URL string `json:"url"`
+
+	// Up reports whether the last scrape succeeded.
+	Up bool `json:"up"`
+
+	// Error is the error of the last scrape, if it failed.
+	Error string `json:"error,omitempty"`
+
+	// LastSuccess is when the target was last scraped successfully, or nil
+	// if it never was.
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+
+	// Stale reports whether the target's stats are served from a previous
+	// scrape, as the last one failed.
+	Stale bool `json:"stale"`
+
+	// Guilds is the number of guilds the target contributes.
+	Guilds int `json:"guilds"`
+}
+
+// Stats is the combined view of the shards' stats.
+type Stats struct {
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Complete reports whether every target's stats are current: false when
+	// some are stale or missing, and the totals undercount.
+	Complete bool `json:"complete"`
+
+	Guilds         int `json:"guilds"`
+	Members        int `json:"members"`
+	EphemeralRoles int `json:"ephemeralRoles"`
+	VoiceMembers   int `json:"voiceMembers"`
+
+	Shards  []monitor.ShardHealth `json:"shards"`
+	Targets []TargetStatus        `json:"targets"`
+}
+
+// target is the last scraped stats of a target.
+type target struct {
+	url         string
+	err         error
+	lastSuccess time.Time
+	guilds      internalHTTP.SortableGuilds
+	shards      []monitor.ShardHealth
+}
+
+// Aggregator scrapes the shard processes' stats and merges them.
+type Aggregator struct {
+	*Config
+
+	mu        sync.RWMutex
+	targets   []*target
+	updatedAt time.Time
+}
+
+// New returns a new *Aggregator configured using the provided config, with
+// defaults for its zero values.
+func New(config *Config) *Aggregator {
+	config.Interval = cmp.Or(config.Interval, DefaultInterval)
+	config.Timeout = cmp.Or(config.Timeout, DefaultTimeout)
+	config.StaleAfter = cmp.Or(config.StaleAfter, DefaultStaleAfter)
+
+	targets := make([]*target, 0, len(config.Targets))
+
+	for _, targetURL := range config.Targets {
+		targets = append(targets, &target{url: strings.TrimSuffix(targetURL, "/")})
+	}
+
+	return &Aggregator{
+		Config:  config,
+		targets: targets,
+	}
+}
+
+// Run scrapes the targets right away, then every Interval until ctx is done.
+func (aggregator *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(aggregator.Interval)
+	defer ticker.Stop()
+
+	for {
+		aggregator.Scrape(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scrape scrapes every target concurrently. A target that fails keeps its
+// previous stats. A target scraped successfully is timestamped when its
+// scrape completes, so that the freshest data wins when targets disagree.
+func (aggregator *Aggregator) Scrape(ctx context.Context) {
+	type result struct {
+		guilds internalHTTP.SortableGuilds
+		shards []monitor.ShardHealth
+		err    error
+		at     time.Time
+	}
+
+	results := make([]result, len(aggregator.targets))
+
+	var wg sync.WaitGroup
+
+	for i, t := range aggregator.targets {
+		wg.Go(func() {
+			scrapeCtx, cancel := context.WithTimeout(ctx, aggregator.Timeout)
+			defer cancel()
+
+			results[i].guilds, results[i].shards, results[i].err = aggregator.scrape(scrapeCtx, t.url)
+			results[i].at = time.Now()
+		})
+	}
+
+	wg.Wait()
+
+	now := time.Now()
+
+	aggregator.mu.Lock()
+	defer aggregator.mu.Unlock()
+
+	for i, t := range aggregator.targets {
+		t.err = results[i].err
+
+		if t.err != nil {
+			aggregator.Log.Warn("Unable to scrape shard stats", "target", t.url, "error", t.err)
+			continue
+		}
+
+		t.lastSuccess = results[i].at
+		t.guilds = results[i].guilds
+		t.shards = results[i].shards
+	}
+
+	aggregator.updatedAt = now
+}
+
+// Ready reports whether any target has stats to serve.
+func (aggregator *Aggregator) Ready() bool {
+	aggregator.mu.RLock()
+	defer aggregator.mu.RUnlock()
+
+	for _, t := range aggregator.targets {
+		if aggregator.current(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Guilds returns the guilds of every target with stats to serve. A guild
+// reported by several targets, as while the shard count changes, is listed
+// once, as reported by the target whose last successful scrape completed
+// last, or listed last in Targets on ties.
+func (aggregator *Aggregator) Guilds() internalHTTP.SortableGuilds {
+	aggregator.mu.RLock()
+	defer aggregator.mu.RUnlock()
+
+	return aggregator.guilds()
+}
+
+// Stats returns the combined view of the targets' stats.
+func (aggregator *Aggregator) Stats() Stats {
+	aggregator.mu.RLock()
+	defer aggregator.mu.RUnlock()
+
+	stats := Stats{
+		UpdatedAt: aggregator.updatedAt,
+		Complete:  true,
+		Shards:    []monitor.ShardHealth{},
+		Targets:   make([]TargetStatus, 0, len(aggregator.targets)),
+	}
+
+	for _, t := range aggregator.targets {
+		status := TargetStatus{
+			URL:   t.url,
+			Up:    t.err == nil && !t.lastSuccess.IsZero(),
+			Stale: t.err != nil && aggregator.current(t),
+		}
+
+		if t.err != nil {
+			status.Error = t.err.Error()
+		}
+
+		if !t.lastSuccess.IsZero() {
+			lastSuccess := t.lastSuccess
+			status.LastSuccess = &lastSuccess
+		}
+
+		if aggregator.current(t) {
+			status.Guilds = len(t.guilds)
+			stats.Shards = append(stats.Shards, t.shards...)
+		}
+
+		stats.Complete = stats.Complete && status.Up
+		stats.Targets = append(stats.Targets, status)
+	}
+
+	slices.SortFunc(stats.Shards, func(a, b monitor.ShardHealth) int {
+		return cmp.Compare(a.ShardID, b.ShardID)
+	})
+
+	for _, guild := range aggregator.guilds() {
+		stats.Guilds++
+		stats.Members += guild.MemberCount
+		stats.EphemeralRoles += guild.EphemeralRoles
+		stats.VoiceMembers += guild.VoiceMembers
+	}
+
+	return stats
+}
+
+// guilds returns the deduplicated guilds of the targets with stats to serve.
+// The caller must hold aggregator.mu.
+func (aggregator *Aggregator) guilds() internalHTTP.SortableGuilds {
+	targets := slices.Clone(aggregator.targets)
+
+	slices.SortStableFunc(targets, func(a, b *target) int {
+		return a.lastSuccess.Compare(b.lastSuccess)
+	})
+
+	seen := make(map[snowflake.ID]int)
+	guilds := make(internalHTTP.SortableGuilds, 0)
+
+	for _, t := range targets {
+		if !aggregator.current(t) {
+			continue
+		}
+
+		for _, guild := range t.guilds {
+			if i, ok := seen[guild.ID]; ok {
+				guilds[i] = guild
+				continue
+			}
+
+			seen[guild.ID] = len(guilds)
+			guilds = append(guilds, guild)
+		}
+	}
+
+	return guilds
+}
+
+// current reports whether t's stats are recent enough to serve. The caller
+// must hold aggregator.mu.
+func (aggregator *Aggregator) current(t *target) bool {
+	return !t.lastSuccess.IsZero() && time.Since(t.lastSuccess) <= aggregator.StaleAfter
+}
+
+// scrape fetches the guilds and shard health served by the target at
+// targetURL. A target not serving its shard health, as one without a shard
+// tracker, reports no shards.
+func (aggregator *Aggregator) scrape(
+	ctx context.Context,
+	targetURL string,
+) (internalHTTP.SortableGuilds, []monitor.ShardHealth, error) {
+	guilds := make(internalHTTP.SortableGuilds, 0)
+
+	if err := aggregator.get(ctx, targetURL+internalHTTP.GuildsEndpoint, &guilds); err != nil {
+		return nil, nil, err
+	}
+
+	shards := make([]monitor.ShardHealth, 0)
+
+	if err := aggregator.get(ctx, targetURL+internalHTTP.ShardsEndpoint, &shards); err != nil && !errors.Is(err, errNotFound) {
+		return nil, nil, err
+	}
+
+	return guilds, shards, nil
+}
+
+// errNotFound is returned by get for a 404 response.
+var errNotFound = errors.New("endpoint not found")
+
+// get decodes the JSON served at endpointURL into v.
+func (aggregator *Aggregator) get(ctx context.Context, endpointURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("unable to create stats request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := aggregator.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to make stats request: %w", err)
+	}
+
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", errNotFound, endpointURL)
+	default:
+		return fmt.Errorf("unexpected response: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode stats response: %w", err)
+	}
+
+	return nil
+}
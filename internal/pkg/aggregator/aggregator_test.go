@@ -0,0 +1,178 @@
+package aggregator_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/aggregator"
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+// fakeShardProcess is the stats endpoints of a shard process, which fail
+// while down.
+type fakeShardProcess struct {
+	*httptest.Server
+
+	down atomic.Bool
+
+	// delay is how long, in nanoseconds, the endpoints wait before serving.
+	delay atomic.Int64
+}
+
+func newFakeShardProcess(t *testing.T, guilds internalHTTP.SortableGuilds, shards []monitor.ShardHealth) *fakeShardProcess {
+	t.Helper()
+
+	process := &fakeShardProcess{}
+	mux := http.NewServeMux()
+
+	serve := func(v any) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			time.Sleep(time.Duration(process.delay.Load()))
+
+			if process.down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(v)
+		}
+	}
+
+	mux.HandleFunc(internalHTTP.GuildsEndpoint, serve(guilds))
+
+	if shards != nil {
+		mux.HandleFunc(internalHTTP.ShardsEndpoint, serve(shards))
+	}
+
+	process.Server = httptest.NewServer(mux)
+	t.Cleanup(process.Close)
+
+	return process
+}
+
+func TestAggregator_Scrape(t *testing.T) {
+	t.Parallel()
+
+	shard0 := newFakeShardProcess(t,
+		internalHTTP.SortableGuilds{
+			{ID: 1, Name: "guild1", MemberCount: 10, EphemeralRoles: 2, VoiceMembers: 3},
+			{ID: 2, Name: "guild2", MemberCount: 5, EphemeralRoles: 1, VoiceMembers: 1},
+		},
+		[]monitor.ShardHealth{{ShardID: 0, Status: "Ready", Guilds: 2}},
+	)
+
+	// A process without a shard tracker doesn't serve ShardsEndpoint.
+	shard1 := newFakeShardProcess(t,
+		internalHTTP.SortableGuilds{
+			{ID: 2, Name: "guild2", MemberCount: 5, EphemeralRoles: 1, VoiceMembers: 1},
+			{ID: 3, Name: "guild3", MemberCount: 20},
+		},
+		nil,
+	)
+
+	statsAggregator := aggregator.New(&aggregator.Config{
+		Log:     mock.NewLogger(),
+		Client:  shard0.Client(),
+		Targets: []string{shard0.URL, shard1.URL + "/"},
+	})
+
+	assert.False(t, statsAggregator.Ready())
+
+	statsAggregator.Scrape(t.Context())
+
+	assert.True(t, statsAggregator.Ready())
+	assert.Len(t, statsAggregator.Guilds(), 3, "guild reported twice not deduplicated")
+
+	stats := statsAggregator.Stats()
+
+	assert.True(t, stats.Complete)
+	assert.Equal(t, 3, stats.Guilds)
+	assert.Equal(t, 35, stats.Members)
+	assert.Equal(t, 3, stats.EphemeralRoles)
+	assert.Equal(t, 4, stats.VoiceMembers)
+	assert.Equal(t, []monitor.ShardHealth{{ShardID: 0, Status: "Ready", Guilds: 2}}, stats.Shards)
+
+	require.Len(t, stats.Targets, 2)
+	assert.Equal(t, shard1.URL, stats.Targets[1].URL)
+	assert.True(t, stats.Targets[1].Up)
+	assert.Equal(t, 2, stats.Targets[1].Guilds)
+}
+
+func TestAggregator_Scrape_freshest(t *testing.T) {
+	t.Parallel()
+
+	// The slow process completes its scrape last, so its data is the
+	// freshest, whatever the targets' order.
+	slow := newFakeShardProcess(t, internalHTTP.SortableGuilds{{ID: 1, Name: "guild1", MemberCount: 11}}, nil)
+	slow.delay.Store(int64(50 * time.Millisecond))
+
+	fast := newFakeShardProcess(t, internalHTTP.SortableGuilds{{ID: 1, Name: "guild1", MemberCount: 10}}, nil)
+
+	for _, targets := range [][]string{{slow.URL, fast.URL}, {fast.URL, slow.URL}} {
+		statsAggregator := aggregator.New(&aggregator.Config{
+			Log:     mock.NewLogger(),
+			Client:  slow.Client(),
+			Targets: targets,
+		})
+
+		statsAggregator.Scrape(t.Context())
+
+		guilds := statsAggregator.Guilds()
+		require.Len(t, guilds, 1)
+		assert.Equal(t, 11, guilds[0].MemberCount, targets)
+	}
+}
+
+func TestAggregator_Scrape_unavailable(t *testing.T) {
+	t.Parallel()
+
+	const staleAfter = 100 * time.Millisecond
+
+	shard0 := newFakeShardProcess(t, internalHTTP.SortableGuilds{{ID: 1, Name: "guild1", MemberCount: 10}}, nil)
+	shard1 := newFakeShardProcess(t, internalHTTP.SortableGuilds{{ID: 2, Name: "guild2", MemberCount: 5}}, nil)
+
+	statsAggregator := aggregator.New(&aggregator.Config{
+		Log:        mock.NewLogger(),
+		Client:     shard0.Client(),
+		Targets:    []string{shard0.URL, shard1.URL, "http://127.0.0.1:0"},
+		StaleAfter: staleAfter,
+	})
+
+	statsAggregator.Scrape(t.Context())
+
+	stats := statsAggregator.Stats()
+
+	assert.False(t, stats.Complete)
+	assert.Equal(t, 2, stats.Guilds, "unavailable target prevents aggregation")
+	assert.False(t, stats.Targets[2].Up)
+	assert.NotEmpty(t, stats.Targets[2].Error)
+	assert.Nil(t, stats.Targets[2].LastSuccess)
+
+	shard1.down.Store(true)
+	statsAggregator.Scrape(t.Context())
+
+	stats = statsAggregator.Stats()
+
+	assert.Equal(t, 2, stats.Guilds, "stats of a target down not kept until stale")
+	assert.False(t, stats.Targets[1].Up)
+	assert.True(t, stats.Targets[1].Stale)
+
+	time.Sleep(2 * staleAfter)
+	statsAggregator.Scrape(t.Context())
+
+	stats = statsAggregator.Stats()
+
+	assert.Equal(t, 1, stats.Guilds, "stale stats still served")
+	assert.False(t, stats.Targets[1].Stale)
+	assert.Zero(t, stats.Targets[1].Guilds)
+	assert.True(t, statsAggregator.Ready())
+}
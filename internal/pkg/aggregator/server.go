@@ -0,0 +1,111 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+)
+
+// StatsEndpoint serves the combined Stats. The combined guilds are served on
+// internalHTTP.GuildsEndpoint, with the same query parameters as on the shard
+// processes.
+const StatsEndpoint = "/stats"
+
+const readHeaderTimeout = 3 * time.Second
+
+// ServerConfig contains fields for configuring the server returned by
+// NewServer.
+type ServerConfig struct {
+	Log        *slog.Logger
+	Aggregator *Aggregator
+	Port       string
+
+	// AllowOrigin, when set, is sent as the Access-Control-Allow-Origin of
+	// the stats responses, for the website to fetch them from the browser.
+	AllowOrigin string
+}
+
+// NewServer returns a new pre-configured *http.Server serving the combined
+// view of the aggregator.
+func NewServer(config *ServerConfig) *http.Server {
+	log := config.Log
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(internalHTTP.RootEndpoint, rootHandler())
+	mux.Handle(internalHTTP.GuildsEndpoint, allowOrigin(config.AllowOrigin,
+		internalHTTP.GuildsHandler(log, config.Aggregator.Guilds, nil),
+	))
+	mux.Handle(StatsEndpoint, allowOrigin(config.AllowOrigin, statsHandler(log, config.Aggregator)))
+	mux.HandleFunc(internalHTTP.ReadyzEndpoint, readyzHandler(config.Aggregator))
+	mux.Handle(internalHTTP.MetricsEndpoint, promhttp.Handler())
+
+	return &http.Server{
+		Addr:              "0.0.0.0:" + config.Port,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelError),
+	}
+}
+
+func rootHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+		_, _ = w.Write(nil)
+	}
+}
+
+// allowOrigin sets origin, if any, as the Access-Control-Allow-Origin of the
+// responses of next.
+func allowOrigin(origin string, next http.Handler) http.Handler {
+	if origin == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Access-Control-Expose-Headers", internalHTTP.GuildsTotalCountHeader)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readyzHandler reports 200 once any shard process has been scraped, so the
+// combined view has something to serve, and 503 otherwise.
+func readyzHandler(aggregator *Aggregator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+
+		if !aggregator.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func statsHandler(log *slog.Logger, aggregator *Aggregator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+
+		statsJSON, err := json.MarshalIndent(aggregator.Stats(), "", "    ")
+		if err != nil {
+			log.Error("Error marshaling stats to JSON", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err = w.Write(statsJSON)
+		if err != nil {
+			log.Error("Error writing stats response", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package aggregator_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/aggregator"
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+const testOrigin = "https://ephemeral-roles.net"
+
+func TestNewServer(t *testing.T) {
+	t.Parallel()
+
+	shard0 := newFakeShardProcess(t,
+		internalHTTP.SortableGuilds{{ID: 1, Name: "guild1", MemberCount: 10}},
+		[]monitor.ShardHealth{{ShardID: 0, Status: "Ready"}},
+	)
+	shard1 := newFakeShardProcess(t,
+		internalHTTP.SortableGuilds{{ID: 2, Name: "guild2", MemberCount: 20}},
+		[]monitor.ShardHealth{{ShardID: 1, Status: "Ready"}},
+	)
+
+	statsAggregator := aggregator.New(&aggregator.Config{
+		Log:     mock.NewLogger(),
+		Client:  shard0.Client(),
+		Targets: []string{shard0.URL, shard1.URL},
+	})
+
+	testServer := httptest.NewServer(aggregator.NewServer(&aggregator.ServerConfig{
+		Log:         mock.NewLogger(),
+		Aggregator:  statsAggregator,
+		AllowOrigin: testOrigin,
+	}).Handler)
+	defer testServer.Close()
+
+	resp := doRequest(t, testServer, internalHTTP.ReadyzEndpoint)
+	drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "ready before any scrape")
+
+	statsAggregator.Scrape(t.Context())
+
+	resp = doRequest(t, testServer, internalHTTP.ReadyzEndpoint)
+	drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, testServer, internalHTTP.GuildsEndpoint+"?limit=1")
+
+	guilds := make(internalHTTP.SortableGuilds, 0)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&guilds))
+	drainCloseResponse(resp)
+
+	assert.Equal(t, internalHTTP.SortableGuilds{{ID: 2, Name: "guild2", MemberCount: 20}}, guilds)
+	assert.Equal(t, "2", resp.Header.Get(internalHTTP.GuildsTotalCountHeader))
+	assert.Equal(t, testOrigin, resp.Header.Get("Access-Control-Allow-Origin"))
+
+	resp = doRequest(t, testServer, aggregator.StatsEndpoint)
+
+	stats := aggregator.Stats{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	drainCloseResponse(resp)
+
+	assert.True(t, stats.Complete)
+	assert.Equal(t, 2, stats.Guilds)
+	assert.Equal(t, 30, stats.Members)
+	assert.Len(t, stats.Shards, 2)
+	assert.Equal(t, testOrigin, resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func doRequest(t *testing.T, testServer *httptest.Server, endpoint string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, testServer.URL+endpoint, http.NoBody)
+	require.NoError(t, err)
+
+	resp, err := testServer.Client().Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
+
+func drainCloseResponse(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
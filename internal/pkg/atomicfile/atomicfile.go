@@ -0,0 +1,36 @@
+// Package atomicfile writes files so that a crash or kill mid-write never
+// leaves them truncated.
+package atomicfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes contents to a new file next to the one at path, readable
+// and writable only by the owner, which then replaces it. Readers see either
+// the previous contents or the new ones, never a partial write.
+func WriteFile(path string, contents []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %w", err)
+	}
+
+	_, err = temp.Write(contents)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return fmt.Errorf("unable to write temporary file: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		_ = os.Remove(temp.Name())
+		return fmt.Errorf("unable to replace file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+// Package audit records the role mutations the bot performs, so guild
+// administrators can find out why a member's role was added or removed.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Retention defaults, used when the corresponding Config field is unset.
+const (
+	DefaultMaxAge      = 90 * 24 * time.Hour
+	DefaultMaxPerGuild = 10000
+)
+
+// Action is a kind of role mutation.
+type Action string
+
+// Action enumerations.
+const (
+	ActionCreateRole Action = "createRole"
+	ActionAddRole    Action = "addRole"
+	ActionRemoveRole Action = "removeRole"
+	ActionDeleteRole Action = "deleteRole"
+)
+
+// Outcome is whether a role mutation succeeded.
+type Outcome string
+
+// Outcome enumerations.
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Entry is a single role mutation attempted by the bot.
+type Entry struct {
+	Time    time.Time    `json:"time"`
+	GuildID snowflake.ID `json:"guildID"`
+	Action  Action       `json:"action"`
+
+	// RoleID is zero for a role that failed to be created.
+	RoleID   snowflake.ID `json:"roleID,omitempty"`
+	RoleName string       `json:"roleName,omitempty"`
+
+	// UserID is the member the role was added to or removed from, and zero
+	// for actions on the role itself.
+	UserID snowflake.ID `json:"userID,omitempty"`
+
+	// Event is the event that triggered the mutation, such as
+	// VoiceStateUpdate, and EventID identifies it in the logs.
+	Event   string `json:"event"`
+	EventID string `json:"eventID,omitempty"`
+
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Query selects the entries of a guild returned by Store.Query. A zero
+// UserID, RoleID, Action, or Since matches any.
+type Query struct {
+	GuildID snowflake.ID
+	UserID  snowflake.ID
+	RoleID  snowflake.ID
+	Action  Action
+	Since   time.Time
+	Limit   int
+}
+
+// Config contains fields for configuring a Store.
+type Config struct {
+	// MaxAge is how long entries are retained. It defaults to DefaultMaxAge.
+	MaxAge time.Duration
+
+	// MaxPerGuild caps the entries retained per guild, discarding the oldest
+	// first. It defaults to DefaultMaxPerGuild.
+	MaxPerGuild int
+}
+
+// Store is a concurrency-safe store of audit entries, with retention limits
+// on the entries it keeps. Once opened on a local file with Open, every entry
+// recorded is also appended to the file, so the trail survives a restart.
+type Store struct {
+	*Config
+
+	mu      sync.Mutex
+	entries map[snowflake.ID][]Entry
+	path    string
+	file    *os.File
+}
+
+// NewStore returns a new, empty *Store configured using the provided config.
+func NewStore(config *Config) *Store {
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+
+	if config.MaxPerGuild <= 0 {
+		config.MaxPerGuild = DefaultMaxPerGuild
+	}
+
+	return &Store{
+		Config:  config,
+		entries: make(map[snowflake.ID][]Entry),
+	}
+}
+
+// Record adds entry to the store, and appends it to the store's file if it
+// has been opened. The entry is retained in memory even if appending fails.
+func (store *Store) Record(entry Entry) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.add(entry)
+
+	if store.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit entry: %w", err)
+	}
+
+	if _, err := store.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to append audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns the entries matching query, most recent first.
+func (store *Store) Query(query Query) []Entry {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var entries []Entry
+
+	guildEntries := store.entries[query.GuildID]
+
+	for i := len(guildEntries) - 1; i >= 0; i-- {
+		entry := guildEntries[i]
+
+		if !query.Since.IsZero() && entry.Time.Before(query.Since) {
+			break
+		}
+
+		if (query.UserID == 0 || entry.UserID == query.UserID) &&
+			(query.RoleID == 0 || entry.RoleID == query.RoleID) &&
+			(query.Action == "" || entry.Action == query.Action) {
+			entries = append(entries, entry)
+		}
+
+		if query.Limit > 0 && len(entries) == query.Limit {
+			break
+		}
+	}
+
+	return entries
+}
+
+// Open restores the entries appended to the file at path, applying the
+// store's retention limits, and appends entries recorded from now on to it. A
+// missing file is not an error: it is created.
+//
+// The file is compacted on opening, dropping the entries no longer retained.
+func (store *Store) Open(path string) error {
+	if err := store.load(path); err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.path = path
+
+	return store.compact()
+}
+
+// Compact rewrites the store's file with only the entries still retained, so
+// that it doesn't grow without bound. It is a no-op if the store hasn't been
+// opened.
+func (store *Store) Compact() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.path == "" {
+		return nil
+	}
+
+	for guildID, entries := range store.entries {
+		entries = store.retain(entries)
+		if len(entries) == 0 {
+			delete(store.entries, guildID)
+			continue
+		}
+
+		store.entries[guildID] = entries
+	}
+
+	return store.compact()
+}
+
+// Close closes the store's file. Entries recorded afterward are only kept in
+// memory.
+func (store *Store) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.file == nil {
+		return nil
+	}
+
+	err := store.file.Close()
+	store.file = nil
+
+	return err
+}
+
+func (store *Store) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("unable to open audit log: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		entry := Entry{}
+
+		// A line cut short by a crash is skipped rather than failing the
+		// whole trail.
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		store.add(entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read audit log: %w", err)
+	}
+
+	return nil
+}
+
+// compact writes the retained entries to a new file, which then replaces the
+// store's file and is appended to from then on. The caller must hold
+// store.mu.
+func (store *Store) compact() error {
+	temp, err := os.CreateTemp(filepath.Dir(store.path), filepath.Base(store.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create audit log: %w", err)
+	}
+
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+
+	for _, entries := range store.entries {
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				_ = temp.Close()
+				_ = os.Remove(temp.Name())
+
+				return fmt.Errorf("unable to write audit log: %w", err)
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+
+		return fmt.Errorf("unable to write audit log: %w", err)
+	}
+
+	if err := os.Rename(temp.Name(), store.path); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+
+		return fmt.Errorf("unable to replace audit log: %w", err)
+	}
+
+	if store.file != nil {
+		_ = store.file.Close()
+	}
+
+	store.file = temp
+
+	return nil
+}
+
+// add adds an entry to its guild's trail and applies the retention limits to
+// it. Entries are kept in time order. The caller must hold store.mu.
+func (store *Store) add(entry Entry) {
+	entries := store.entries[entry.GuildID]
+
+	index, _ := slices.BinarySearchFunc(entries, entry.Time, func(existing Entry, at time.Time) int {
+		if existing.Time.After(at) {
+			return 1
+		}
+
+		return -1
+	})
+
+	store.entries[entry.GuildID] = store.retain(slices.Insert(entries, index, entry))
+}
+
+// retain returns entries without those beyond the retention limits.
+func (store *Store) retain(entries []Entry) []Entry {
+	cutoff := time.Now().Add(-store.MaxAge)
+
+	expired, _ := slices.BinarySearchFunc(entries, cutoff, func(entry Entry, cutoff time.Time) int {
+		if entry.Time.Before(cutoff) {
+			return -1
+		}
+
+		return 1
+	})
+
+	entries = entries[expired:]
+
+	if excess := len(entries) - store.MaxPerGuild; excess > 0 {
+		entries = entries[excess:]
+	}
+
+	return entries
+}
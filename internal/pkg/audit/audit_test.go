@@ -0,0 +1,122 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+)
+
+const (
+	testGuildID snowflake.ID = 1000
+	testUserID  snowflake.ID = 1002
+	testRoleID  snowflake.ID = 1005
+)
+
+func TestStore_Query(t *testing.T) {
+	t.Parallel()
+
+	store := audit.NewStore(&audit.Config{})
+	now := time.Now()
+
+	entries := []audit.Entry{
+		{Time: now.Add(-3 * time.Minute), GuildID: testGuildID, Action: audit.ActionCreateRole, RoleID: testRoleID},
+		{Time: now.Add(-2 * time.Minute), GuildID: testGuildID, Action: audit.ActionAddRole, RoleID: testRoleID, UserID: testUserID},
+		{Time: now.Add(-time.Minute), GuildID: testGuildID, Action: audit.ActionRemoveRole, RoleID: testRoleID, UserID: testUserID},
+		{Time: now, GuildID: testGuildID + 1, Action: audit.ActionDeleteRole, RoleID: testRoleID},
+	}
+
+	// Out of order, as concurrent guild workers may record them.
+	for _, i := range []int{1, 0, 3, 2} {
+		require.NoError(t, store.Record(entries[i]))
+	}
+
+	assert.Equal(t, []audit.Entry{entries[2], entries[1], entries[0]}, store.Query(audit.Query{GuildID: testGuildID}))
+	assert.Equal(t, []audit.Entry{entries[2], entries[1]}, store.Query(audit.Query{GuildID: testGuildID, UserID: testUserID}))
+	assert.Equal(t, []audit.Entry{entries[2]}, store.Query(audit.Query{GuildID: testGuildID, Limit: 1}))
+	assert.Equal(t, []audit.Entry{entries[1]}, store.Query(audit.Query{GuildID: testGuildID, Action: audit.ActionAddRole}))
+	assert.Equal(t, []audit.Entry{entries[2], entries[1]}, store.Query(audit.Query{
+		GuildID: testGuildID,
+		Since:   now.Add(-150 * time.Second),
+	}))
+	assert.Empty(t, store.Query(audit.Query{GuildID: testGuildID, RoleID: testRoleID + 1}))
+}
+
+func TestStore_retention(t *testing.T) {
+	t.Parallel()
+
+	store := audit.NewStore(&audit.Config{MaxAge: time.Hour, MaxPerGuild: 2})
+	now := time.Now()
+
+	require.NoError(t, store.Record(audit.Entry{Time: now.Add(-2 * time.Hour), GuildID: testGuildID}))
+	assert.Empty(t, store.Query(audit.Query{GuildID: testGuildID}))
+
+	for i := range 3 {
+		require.NoError(t, store.Record(audit.Entry{
+			Time:    now.Add(time.Duration(i) * time.Second),
+			GuildID: testGuildID,
+			RoleID:  snowflake.ID(i),
+		}))
+	}
+
+	entries := store.Query(audit.Query{GuildID: testGuildID})
+	require.Len(t, entries, 2)
+	assert.Equal(t, snowflake.ID(2), entries[0].RoleID)
+	assert.Equal(t, snowflake.ID(1), entries[1].RoleID)
+}
+
+func TestStore_Open(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	now := time.Now().UTC()
+
+	store := audit.NewStore(&audit.Config{MaxAge: time.Hour})
+	require.NoError(t, store.Open(path))
+
+	expired := audit.Entry{Time: now.Add(-30 * time.Minute), GuildID: testGuildID, Action: audit.ActionCreateRole}
+	retained := audit.Entry{Time: now, GuildID: testGuildID, Action: audit.ActionAddRole, Outcome: audit.OutcomeSuccess}
+
+	require.NoError(t, store.Record(expired))
+	require.NoError(t, store.Record(retained))
+	require.NoError(t, store.Close())
+
+	// A line cut short by a crash is skipped.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"time":`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	restored := audit.NewStore(&audit.Config{MaxAge: 15 * time.Minute})
+	require.NoError(t, restored.Open(path))
+
+	defer func() { _ = restored.Close() }()
+
+	entries := restored.Query(audit.Query{GuildID: testGuildID})
+	require.Len(t, entries, 1)
+	assert.True(t, retained.Time.Equal(entries[0].Time))
+	assert.Equal(t, audit.ActionAddRole, entries[0].Action)
+
+	// Opening compacted away the expired and truncated entries.
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), string(audit.ActionCreateRole))
+	assert.NotContains(t, string(contents), `{"time":`+"\n")
+}
+
+func TestStore_OpenMissing(t *testing.T) {
+	t.Parallel()
+
+	store := audit.NewStore(&audit.Config{})
+
+	require.NoError(t, store.Open(filepath.Join(t.TempDir(), "audit.jsonl")))
+	require.NoError(t, store.Compact())
+	require.NoError(t, store.Close())
+}
@@ -0,0 +1,136 @@
+package callbacks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/reason"
+)
+
+const auditError = "unable to audit role mutation"
+
+// recordAudit records a role mutation made for the event identified by
+// correlation, with its outcome err, and mirrors it to the guild's audit log
+// channel, if one is configured.
+func (handler *Handler) recordAudit(
+	ctx context.Context,
+	client *bot.Client,
+	correlation *Correlation,
+	entry audit.Entry,
+	err error,
+) {
+	if handler.Audit == nil {
+		return
+	}
+
+	entry.Time = time.Now()
+	entry.GuildID = correlation.GuildID
+	entry.Event = correlation.Event
+	entry.EventID = correlation.EventID
+	entry.Outcome = audit.OutcomeSuccess
+
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+
+	if err := handler.Audit.Record(entry); err != nil {
+		handler.Log.ErrorContext(ctx, auditError, append(correlation.LogAttrs(), "error", err)...)
+	}
+
+	if handler.Settings == nil {
+		return
+	}
+
+	channelID, ok := handler.Settings.AuditLogChannel(entry.GuildID)
+	if !ok {
+		return
+	}
+
+	// Like role work, a mirror post dropped when the guild's queue is full
+	// is only a missing message: the entry is still in the audit log.
+	if !handler.auditMirror.Submit(entry.GuildID, func() { handler.mirrorAudit(client, channelID, entry) }) {
+		handler.Log.WarnContext(ctx, "dropping audit log channel post: mirror queue full", correlation.LogAttrs()...)
+	}
+}
+
+// auditReason returns the reason for a role mutation in guildID triggered by
+// kind, to be shown in the guild's Discord audit log, or an empty string if
+// the guild has disabled reasons. It is given in the guild's configured
+// locale, else its preferred locale.
+func (handler *Handler) auditReason(
+	client *bot.Client,
+	guildID snowflake.ID,
+	kind reason.Kind,
+	channelName string,
+) string {
+	var locale discord.Locale
+
+	if guild, ok := client.Caches.Guild(guildID); ok {
+		locale = discord.Locale(guild.PreferredLocale)
+	}
+
+	if handler.Settings != nil {
+		enabled, configured := handler.Settings.AuditLogReasons(guildID)
+		if !enabled {
+			return ""
+		}
+
+		if configured != "" {
+			locale = configured
+		}
+	}
+
+	return reason.Format(locale, kind, channelName)
+}
+
+func (handler *Handler) mirrorAudit(client *bot.Client, channelID snowflake.ID, entry audit.Entry) {
+	ctx, cancel := operations.RequestContext(context.Background())
+	defer cancel()
+
+	_, err := client.Rest.CreateMessage(channelID, discord.MessageCreate{
+		Content:         auditMessage(&entry),
+		AllowedMentions: &discord.AllowedMentions{},
+	}, rest.WithCtx(ctx))
+	if err != nil {
+		handler.Log.Debug(auditError, GuildIDKey, entry.GuildID, EventIDKey, entry.EventID, "error", err)
+	}
+}
+
+// auditMessage returns the audit log channel message for entry.
+func auditMessage(entry *audit.Entry) string {
+	// The role is named rather than mentioned: a deleted role's mention
+	// renders as @deleted-role.
+	role := "`" + entry.RoleName + "`"
+
+	var message string
+
+	switch entry.Action {
+	case audit.ActionCreateRole:
+		message = "Created role " + role
+	case audit.ActionAddRole:
+		message = fmt.Sprintf("Added role %s to %s", role, discord.UserMention(entry.UserID))
+	case audit.ActionRemoveRole:
+		message = fmt.Sprintf("Removed role %s from %s", role, discord.UserMention(entry.UserID))
+	case audit.ActionDeleteRole:
+		message = "Deleted role " + role
+	default:
+		message = string(entry.Action) + " " + role
+	}
+
+	message += fmt.Sprintf(" (%s `%s`)", entry.Event, entry.EventID)
+
+	if entry.Outcome == audit.OutcomeFailure {
+		message += ": failed: " + entry.Error
+	}
+
+	return message
+}
@@ -0,0 +1,81 @@
+package callbacks_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+func TestHandler_audit(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := mock.NewLogger()
+	settingsStore := settings.NewStore()
+
+	require.NoError(t, settingsStore.SetAuditLogChannel(mock.TestGuild, new(mock.TestChannel)))
+
+	handler := &callbacks.Handler{
+		Log:                     log,
+		RolePrefix:              rolePrefix,
+		VoiceStateUpdateCounter: monitor.VoiceStateUpdateCounter(&monitor.Config{Log: log}),
+		OperationsGateway:       operations.NewGateway(session),
+		Settings:                settingsStore,
+		Audit:                   audit.NewStore(&audit.Config{}),
+	}
+
+	member, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+
+	// mock.TestChannel2 has no pre-existing ephemeral role, so the event
+	// creates one and adds it, after removing the member's existing one.
+	sendUpdate(&sync.Mutex{}, session, handler, &member, new(mock.TestChannel2))
+
+	entries := handler.Audit.Query(audit.Query{GuildID: mock.TestGuild})
+
+	actions := make([]audit.Action, 0, len(entries))
+
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+
+		assert.Equal(t, audit.OutcomeSuccess, entry.Outcome)
+		assert.Equal(t, "VoiceStateUpdate", entry.Event)
+		assert.Equal(t, entries[0].EventID, entry.EventID)
+	}
+
+	assert.ElementsMatch(t, []audit.Action{audit.ActionRemoveRole, audit.ActionCreateRole, audit.ActionAddRole}, actions)
+	assert.NotEmpty(t, entries[0].EventID)
+
+	// Mirroring to the audit log channel happens off the guild's worker, in
+	// order.
+	assert.Eventually(t, func() bool {
+		return len(mock.SentMessages(session)) == len(entries)
+	}, time.Second, 10*time.Millisecond)
+
+	prefixes := map[audit.Action]string{
+		audit.ActionRemoveRole: "Removed role",
+		audit.ActionCreateRole: "Created role",
+		audit.ActionAddRole:    "Added role",
+	}
+
+	// The entries are queried most recent first.
+	for i, message := range mock.SentMessages(session) {
+		assert.Equal(t, mock.TestChannel, message.ChannelID)
+		assert.Contains(t, message.Message.Content, entries[0].EventID)
+		assert.True(t, strings.HasPrefix(message.Message.Content, prefixes[entries[len(entries)-1-i].Action]),
+			"mirrored out of order")
+	}
+}
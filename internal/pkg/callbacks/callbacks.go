@@ -2,31 +2,87 @@
 package callbacks
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/diagnostics"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
 )
 
 const unableToProcessEvent = "unable to process event: "
 
+var errGuildQueueFull = errors.New("guild queue full")
+
 // OperationsGateway is an interface abstraction for processing operations
 // requests.
 type OperationsGateway interface {
-	CreateRole(guildID snowflake.ID, roleName string, roleColor int) (discord.Role, error)
+	CreateRole(
+		ctx context.Context,
+		guildID snowflake.ID,
+		roleName string,
+		roleColor int,
+		reason string,
+	) (discord.Role, error)
+}
+
+// DiagnosticsReporter is an interface abstraction for detecting and reporting
+// guild configuration problems that prevent role management.
+type DiagnosticsReporter interface {
+	Report(guildID, roleID snowflake.ID) []diagnostics.Problem
+	Forget(guildID snowflake.ID)
 }
 
 // Handler contains fields for the callback methods attached to it.
 type Handler struct {
 	Log                     *slog.Logger
+	BotName                 string
 	RolePrefix              string
 	RoleColor               int
-	ReadyCounter            prometheus.Counter
-	VoiceStateUpdateCounter prometheus.Counter
+	ReadyCounter            *prometheus.CounterVec
+	VoiceStateUpdateCounter *prometheus.CounterVec
+	VoiceTransitionsCounter *prometheus.CounterVec
+	GuildOnboardingCounter  *prometheus.CounterVec
 	OperationsGateway       OperationsGateway
+	Diagnostics             DiagnosticsReporter
+	Settings                *settings.Store
+	VoiceHistory            *voicehistory.Store
+
+	// Audit records every role mutation. When nil, mutations aren't audited.
+	Audit *audit.Store
+
+	// Tracer starts a span for each event handled. When nil, events aren't
+	// traced.
+	Tracer trace.Tracer
+
+	// LogShardIDs attributes event log lines to the shard the event was
+	// received on. It is set in processes managing more than one shard,
+	// whose logger can't carry a single shard ID.
+	LogShardIDs bool
 
 	sequencer guildSequencer
+
+	// auditMirror posts role mutations to the guilds' audit log channels,
+	// off their sequencer workers, so posting doesn't hold up a guild's
+	// next event, in bounded per-guild queues.
+	auditMirror guildSequencer
+
+	// dispatchStarted is when the event being dispatched started, in Unix
+	// nanoseconds, or 0 between events.
+	dispatchStarted atomic.Int64
 }
 
 // Flush blocks until any Discord role work already queued for guildID (from
@@ -40,3 +96,57 @@ func (handler *Handler) Flush(guildID snowflake.ID) {
 func (handler *Handler) RoleNameFromChannel(channelName string) string {
 	return handler.RolePrefix + " " + channelName
 }
+
+// reportForbidden hands a role mutation rejected for missing permissions to
+// the Diagnostics reporter, if one is configured, so the guild's
+// administrators learn why their ephemeral roles aren't being managed. A zero
+// roleID reports a failure that happened before the role existed.
+//
+// Reporting can notify the guild over REST, so it counts as a step of the
+// guild's running job for the liveness check.
+func (handler *Handler) reportForbidden(guildID, roleID snowflake.ID, err error) {
+	if handler.Diagnostics == nil || !operations.IsForbiddenResponse(err) {
+		return
+	}
+
+	handler.sequencer.Progress(guildID)
+
+	handler.Diagnostics.Report(guildID, roleID)
+
+	handler.sequencer.Progress(guildID)
+}
+
+// startEvent starts the root span for handling an event.
+func (handler *Handler) startEvent(name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := handler.Tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(tracing.InstrumentationName)
+	}
+
+	return tracer.Start(context.Background(), name, trace.WithAttributes(attrs...))
+}
+
+// eventJob returns a job for guildID's sequencer running fn as part of the
+// event span in ctx, tracing the time the job waits in the guild's queue.
+// span, the event's root span, ends when fn returns. Each Discord REST request
+// fn makes with ctx counts as progress of the job for the liveness check.
+func (handler *Handler) eventJob(
+	ctx context.Context,
+	span trace.Span,
+	guildID snowflake.ID,
+	fn func(ctx context.Context),
+) func() {
+	queued := time.Now()
+
+	ctx = operations.WithProgress(ctx, func() {
+		handler.sequencer.Progress(guildID)
+	})
+
+	return func() {
+		defer span.End()
+
+		tracing.Wait(ctx, "sequencer.wait", queued)
+
+		fn(ctx)
+	}
+}
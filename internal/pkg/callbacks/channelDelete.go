@@ -1,15 +1,22 @@
 package callbacks
 
 import (
+	"context"
+
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
-	"github.com/disgoorg/disgo/rest"
 	"github.com/disgoorg/snowflake/v2"
 
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/reason"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
 )
 
-const channelDeleteEventError = unableToProcessEvent + "ChannelDelete"
+const (
+	channelDelete           = "ChannelDelete"
+	channelDeleteEventError = unableToProcessEvent + channelDelete
+)
 
 // ChannelDelete is the callback function for the ChannelDelete event from Discord.
 //
@@ -21,26 +28,40 @@ func (handler *Handler) ChannelDelete(event *events.GuildChannelDelete) {
 		return
 	}
 
-	accepted := handler.sequencer.Submit(event.GuildID, func() {
-		handler.handleChannelDelete(event)
+	ctx, span := handler.startEvent(channelDelete,
+		tracing.GuildIDKey.String(event.GuildID.String()),
+		tracing.ChannelIDKey.String(event.ChannelID.String()),
+	)
+
+	correlation := handler.correlateShard(&Correlation{
+		Event:     channelDelete,
+		EventID:   newEventID(),
+		GuildID:   event.GuildID,
+		ChannelID: &event.ChannelID,
+	}, event.ShardID())
+
+	job := handler.eventJob(ctx, span, event.GuildID, func(ctx context.Context) {
+		handler.handleChannelDelete(ctx, correlation, event)
 	})
+
+	accepted := handler.sequencer.Submit(event.GuildID, job)
 	if !accepted {
 		// Unlike a dropped VoiceStateUpdate, a dropped ChannelDelete is never
 		// retried by a later event, permanently leaking a role toward the
 		// guild's 250-role cap. ChannelDelete is rare, so fall back to a
 		// goroutine that waits for queue capacity: the read loop stays
 		// unblocked and the work still runs serialized on the guild worker.
-		handler.Log.Warn("guild queue full: queueing ChannelDelete asynchronously",
-			"guildID", event.GuildID,
-		)
+		handler.Log.WarnContext(ctx, "guild queue full: queueing ChannelDelete asynchronously", correlation.LogAttrs()...)
 
-		go handler.sequencer.SubmitWait(event.GuildID, func() {
-			handler.handleChannelDelete(event)
-		})
+		go handler.sequencer.SubmitWait(event.GuildID, job)
 	}
 }
 
-func (handler *Handler) handleChannelDelete(event *events.GuildChannelDelete) {
+func (handler *Handler) handleChannelDelete(
+	ctx context.Context,
+	correlation *Correlation,
+	event *events.GuildChannelDelete,
+) {
 	client := event.Client()
 	roleName := handler.RoleNameFromChannel(event.Channel.Name())
 
@@ -65,13 +86,18 @@ func (handler *Handler) handleChannelDelete(event *events.GuildChannelDelete) {
 		return
 	}
 
-	ctx, cancel := operations.RequestContext()
-	defer cancel()
+	err := operations.DeleteRole(
+		ctx, client, event.GuildID, roleID,
+		handler.auditReason(client, event.GuildID, reason.KindChannelDeleted, event.Channel.Name()),
+	)
 
-	if err := client.Rest.DeleteRole(event.GuildID, roleID, rest.WithCtx(ctx)); err != nil {
-		handler.Log.Error(channelDeleteEventError, "error", err)
-		return
-	}
+	handler.recordAudit(ctx, client, correlation, audit.Entry{
+		Action:   audit.ActionDeleteRole,
+		RoleID:   roleID,
+		RoleName: roleName,
+	}, err)
 
-	client.Caches.RemoveRole(event.GuildID, roleID)
+	if err != nil {
+		handler.Log.ErrorContext(ctx, channelDeleteEventError, append(correlation.LogAttrs(), "error", err)...)
+	}
 }
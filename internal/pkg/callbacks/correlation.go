@@ -0,0 +1,102 @@
+package callbacks
+
+import (
+	"crypto/rand"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Log attribute keys identifying the event a log record is about.
+const (
+	EventIDKey   = "eventID"
+	ShardIDKey   = "shardID"
+	GuildIDKey   = "guildID"
+	UserIDKey    = "userID"
+	ChannelIDKey = "channelID"
+)
+
+// Correlation identifies the event a piece of work was submitted for, so that
+// log lines from a guild's worker, where events for different members
+// interleave, can be traced back to their event.
+type Correlation struct {
+	// Event is the name of the event, such as VoiceStateUpdate.
+	Event string
+
+	// EventID is unique to the event, and shared by all work done for it.
+	EventID   string
+	GuildID   snowflake.ID
+	UserID    snowflake.ID
+	ChannelID *snowflake.ID
+
+	// ShardID is the shard the event was received on, set only when the
+	// handler attributes log lines to shards.
+	ShardID *int
+}
+
+// newEventID returns a new random event ID.
+func newEventID() string {
+	return rand.Text()
+}
+
+// newCorrelation returns a *Correlation for voiceState, as part of the event
+// named event and identified by eventID.
+func newCorrelation(event, eventID string, voiceState discord.VoiceState) *Correlation {
+	return &Correlation{
+		Event:     event,
+		EventID:   eventID,
+		GuildID:   voiceState.GuildID,
+		UserID:    voiceState.UserID,
+		ChannelID: voiceState.ChannelID,
+	}
+}
+
+// correlateShard attributes correlation to shardID, if the handler attributes
+// log lines to shards, and returns it.
+func (handler *Handler) correlateShard(correlation *Correlation, shardID int) *Correlation {
+	if handler.LogShardIDs {
+		correlation.ShardID = &shardID
+	}
+
+	return correlation
+}
+
+// correlateGuildShard attributes correlation to the shard of guildID, as
+// correlateShard, for work not started by a gateway event.
+func (handler *Handler) correlateGuildShard(client *bot.Client, correlation *Correlation) *Correlation {
+	if !handler.LogShardIDs || !client.HasShardManager() {
+		return correlation
+	}
+
+	if shard := client.ShardManager.ShardByGuildID(correlation.GuildID); shard != nil {
+		return handler.correlateShard(correlation, shard.ShardID())
+	}
+
+	return correlation
+}
+
+// LogAttrs returns the correlation's log attributes, for slog.Logger.With.
+// The user ID is omitted for events not about a member, such as a channel
+// deletion, the channel ID for events not about a channel, such as a member
+// disconnecting, and the shard ID unless the correlation has one.
+func (correlation *Correlation) LogAttrs() []any {
+	attrs := []any{
+		EventIDKey, correlation.EventID,
+		GuildIDKey, correlation.GuildID,
+	}
+
+	if correlation.UserID != 0 {
+		attrs = append(attrs, UserIDKey, correlation.UserID)
+	}
+
+	if correlation.ChannelID != nil {
+		attrs = append(attrs, ChannelIDKey, *correlation.ChannelID)
+	}
+
+	if correlation.ShardID != nil {
+		attrs = append(attrs, ShardIDKey, *correlation.ShardID)
+	}
+
+	return attrs
+}
@@ -0,0 +1,55 @@
+package callbacks_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+func TestCorrelation_LogAttrs(t *testing.T) {
+	t.Parallel()
+
+	correlation := &callbacks.Correlation{
+		EventID: "event",
+		GuildID: mock.TestGuild,
+		UserID:  mock.TestUser,
+	}
+
+	assert.Equal(t, []any{
+		callbacks.EventIDKey, "event",
+		callbacks.GuildIDKey, mock.TestGuild,
+		callbacks.UserIDKey, mock.TestUser,
+	}, correlation.LogAttrs())
+
+	correlation.ChannelID = new(mock.TestChannel)
+
+	assert.Equal(t, []any{
+		callbacks.EventIDKey, "event",
+		callbacks.GuildIDKey, mock.TestGuild,
+		callbacks.UserIDKey, mock.TestUser,
+		callbacks.ChannelIDKey, mock.TestChannel,
+	}, correlation.LogAttrs())
+
+	correlation.ShardID = new(3)
+
+	assert.Equal(t, []any{
+		callbacks.EventIDKey, "event",
+		callbacks.GuildIDKey, mock.TestGuild,
+		callbacks.UserIDKey, mock.TestUser,
+		callbacks.ChannelIDKey, mock.TestChannel,
+		callbacks.ShardIDKey, 3,
+	}, correlation.LogAttrs())
+
+	// Events not about a member, such as ChannelDelete, have no user ID.
+	correlation.UserID = 0
+
+	assert.Equal(t, []any{
+		callbacks.EventIDKey, "event",
+		callbacks.GuildIDKey, mock.TestGuild,
+		callbacks.ChannelIDKey, mock.TestChannel,
+		callbacks.ShardIDKey, 3,
+	}, correlation.LogAttrs())
+}
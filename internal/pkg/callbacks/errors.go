@@ -48,13 +48,15 @@ func (kind ErrorKind) Message() string {
 
 // EventError is a typed error for failures processing callback events. It
 // carries the guild, member, and channel context available at the point of
-// failure so handlers can branch on Kind and attach structured log fields.
+// failure, and the correlation of the event being processed, so handlers can
+// branch on Kind and attach structured log fields.
 type EventError struct {
-	Kind    ErrorKind
-	Guild   *discord.Guild
-	Member  *discord.Member
-	Channel discord.GuildChannel
-	Err     error
+	Kind        ErrorKind
+	Guild       *discord.Guild
+	Member      *discord.Member
+	Channel     discord.GuildChannel
+	Correlation *Correlation
+	Err         error
 }
 
 // Error satisfies the error interface for EventError.
@@ -0,0 +1,110 @@
+package callbacks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/rest"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/diagnostics"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+const guildJoinEventError = unableToProcessEvent + "GuildJoin"
+
+// Onboarding results, used as the GuildOnboardingCounter label.
+const (
+	OnboardingReady      = "ready"
+	OnboardingNeedsSetup = "needs_setup"
+)
+
+// GuildJoin is the callback function for the GuildJoin event from Discord,
+// which fires when the bot is added to a new guild.
+//
+// Onboarding posts the welcome message with a Discord REST call, so like
+// VoiceStateUpdate it runs on the guild's sequencer worker rather than on the
+// shard's gateway read loop.
+func (handler *Handler) GuildJoin(event *events.GuildJoin) {
+	accepted := handler.sequencer.Submit(event.GuildID, func() {
+		handler.handleGuildJoin(event)
+	})
+	if !accepted {
+		handler.Log.Warn("dropping GuildJoin event: guild queue full",
+			"guildID", event.GuildID,
+		)
+	}
+}
+
+func (handler *Handler) handleGuildJoin(event *events.GuildJoin) {
+	client := event.Client()
+	guild := event.Guild.Guild
+
+	log := handler.Log.With("guild", guild.Name, "guildID", guild.ID)
+
+	log.Info("joined new guild")
+
+	if handler.Settings != nil {
+		if _, err := handler.Settings.Init(guild.ID, settings.Guild{JoinedAt: time.Now()}); err != nil {
+			log.Error("unable to save guild settings", "error", err)
+		}
+	}
+
+	problems := diagnostics.Diagnose(client, guild.ID, 0)
+
+	result := OnboardingReady
+	if len(problems) > 0 {
+		result = OnboardingNeedsSetup
+	}
+
+	if handler.GuildOnboardingCounter != nil {
+		handler.GuildOnboardingCounter.WithLabelValues(result).Inc()
+	}
+
+	if guild.SystemChannelID == nil {
+		log.Debug("no system channel: skipping welcome message")
+		return
+	}
+
+	ctx, cancel := operations.RequestContext(context.Background())
+	defer cancel()
+
+	_, err := client.Rest.CreateMessage(*guild.SystemChannelID, discord.MessageCreate{
+		Content: handler.welcomeMessage(problems),
+	}, rest.WithCtx(ctx))
+	if err != nil {
+		log.Debug(guildJoinEventError, "error", err)
+	}
+}
+
+// welcomeMessage returns the setup message posted when the bot joins a guild,
+// listing any configuration problems detected on join.
+func (handler *Handler) welcomeMessage(problems []diagnostics.Problem) string {
+	builder := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(builder,
+		"Thanks for adding **%s**! Members joining a voice channel will be given a `%s <channel name>` role "+
+			"while they are connected.\n\n",
+		handler.BotName, handler.RolePrefix,
+	)
+
+	if len(problems) == 0 {
+		builder.WriteString("Everything is set up. To keep it that way:\n")
+	} else {
+		builder.WriteString("Setup is needed before roles can be managed:\n")
+
+		for _, problem := range problems {
+			_, _ = fmt.Fprintf(builder, "- %s\n", problem.Message())
+		}
+
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString(diagnostics.FixInstructions(handler.BotName, handler.RolePrefix))
+
+	return builder.String()
+}
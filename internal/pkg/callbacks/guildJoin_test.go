@@ -0,0 +1,91 @@
+package callbacks_test
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/diagnostics"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+func TestHandler_GuildJoin(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := mock.NewLogger()
+	settingsStore := settings.NewStore()
+
+	handler := &callbacks.Handler{
+		Log:                    log,
+		BotName:                testBotName,
+		RolePrefix:             rolePrefix,
+		GuildOnboardingCounter: monitor.GuildOnboardingCounter(&monitor.Config{Log: log}),
+		Settings:               settingsStore,
+	}
+
+	guild, ok := session.Caches.Guild(mock.TestGuild)
+	require.True(t, ok)
+
+	guild.SystemChannelID = new(mock.TestChannel)
+
+	needsSetupBefore := testutil.ToFloat64(handler.GuildOnboardingCounter.WithLabelValues(callbacks.OnboardingNeedsSetup))
+
+	handler.GuildJoin(&events.GuildJoin{
+		GenericGuild: &events.GenericGuild{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			GuildID:      mock.TestGuild,
+		},
+		Guild: discord.GatewayGuild{RestGuild: discord.RestGuild{Guild: guild}},
+	})
+
+	handler.Flush(mock.TestGuild)
+
+	guildSettings, ok := settingsStore.Guild(mock.TestGuild)
+	require.True(t, ok)
+	assert.Nil(t, guildSettings.NotificationChannelID, "notification channel defaulted")
+	assert.False(t, guildSettings.JoinedAt.IsZero())
+
+	// The mock bot member lacks Manage Roles, so onboarding needs setup.
+	assert.InDelta(t, needsSetupBefore+1,
+		testutil.ToFloat64(handler.GuildOnboardingCounter.WithLabelValues(callbacks.OnboardingNeedsSetup)), 0)
+
+	messages := mock.SentMessages(session)
+	require.Len(t, messages, 1)
+	assert.Equal(t, mock.TestChannel, messages[0].ChannelID)
+	assert.Contains(t, messages[0].Message.Content, testBotName)
+	assert.Contains(t, messages[0].Message.Content, diagnostics.MissingManageRolesMessage)
+}
+
+func TestHandler_GuildJoin_noSystemChannel(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	handler := &callbacks.Handler{Log: mock.NewLogger()}
+
+	guild, ok := session.Caches.Guild(mock.TestGuild)
+	require.True(t, ok)
+
+	handler.GuildJoin(&events.GuildJoin{
+		GenericGuild: &events.GenericGuild{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			GuildID:      mock.TestGuild,
+		},
+		Guild: discord.GatewayGuild{RestGuild: discord.RestGuild{Guild: guild}},
+	})
+
+	handler.Flush(mock.TestGuild)
+
+	assert.Empty(t, mock.SentMessages(session))
+}
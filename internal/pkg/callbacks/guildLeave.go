@@ -0,0 +1,52 @@
+package callbacks
+
+import (
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// GuildLeave is the callback function for the GuildLeave event from Discord,
+// which fires when the bot is removed from a guild or the guild is deleted. It
+// purges the state stored for the guild.
+//
+// The purge saves the settings to disk, so like GuildJoin it runs on the
+// guild's sequencer worker rather than on the shard's gateway read loop. It
+// also runs after the work already queued for the guild, such as a GuildJoin
+// shortly followed by a kick, which would otherwise restore the state just
+// purged. The guild's sequencer and audit mirror workers are then stopped.
+func (handler *Handler) GuildLeave(event *events.GuildLeave) {
+	handler.Log.Info("removed from guild", "guild", event.Guild.Name, "guildID", event.GuildID)
+
+	purge := func() {
+		handler.purgeGuild(event.GuildID)
+	}
+
+	if !handler.sequencer.Submit(event.GuildID, purge) {
+		// Like a dropped ChannelDelete, a dropped GuildLeave is never retried,
+		// so wait for queue capacity off the read loop.
+		handler.Log.Warn("guild queue full: queueing GuildLeave asynchronously", "guildID", event.GuildID)
+
+		go handler.sequencer.SubmitWait(event.GuildID, purge)
+	}
+}
+
+// purgeGuild purges the state stored for guildID, and stops its sequencer
+// and audit mirror workers once the work queued for them has completed.
+func (handler *Handler) purgeGuild(guildID snowflake.ID) {
+	if handler.Settings != nil {
+		if err := handler.Settings.Delete(guildID); err != nil {
+			handler.Log.Error("unable to delete guild settings", GuildIDKey, guildID, "error", err)
+		}
+	}
+
+	if handler.VoiceHistory != nil {
+		handler.VoiceHistory.Purge(guildID)
+	}
+
+	if handler.Diagnostics != nil {
+		handler.Diagnostics.Forget(guildID)
+	}
+
+	handler.sequencer.Remove(guildID)
+	handler.auditMirror.Remove(guildID)
+}
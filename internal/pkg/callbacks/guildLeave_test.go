@@ -0,0 +1,145 @@
+package callbacks_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
+)
+
+func TestHandler_GuildLeave(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	settingsStore := settings.NewStore()
+	require.NoError(t, settingsStore.Set(mock.TestGuild, settings.Guild{}))
+
+	voiceHistory := voicehistory.NewStore(&voicehistory.Config{})
+	voiceHistory.Transition(mock.TestGuild, mock.TestUser, nil, new(mock.TestChannel), time.Now())
+
+	reporter := &recordingReporter{}
+
+	handler := &callbacks.Handler{
+		Log:          mock.NewLogger(),
+		Diagnostics:  reporter,
+		Settings:     settingsStore,
+		VoiceHistory: voiceHistory,
+	}
+
+	// Start the guild's sequencer worker so GuildLeave has one to stop.
+	handler.Flush(mock.TestGuild)
+
+	handler.GuildLeave(&events.GuildLeave{
+		GenericGuild: &events.GenericGuild{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			GuildID:      mock.TestGuild,
+		},
+		Guild: discord.Guild{ID: mock.TestGuild, Name: mock.TestGuildName},
+	})
+
+	handler.Flush(mock.TestGuild)
+
+	_, ok := settingsStore.Guild(mock.TestGuild)
+	assert.False(t, ok)
+
+	assert.Empty(t, voiceHistory.Query(voicehistory.Query{GuildID: mock.TestGuild}))
+
+	reporter.mu.Lock()
+	assert.Equal(t, []snowflake.ID{mock.TestGuild}, reporter.forgotten)
+	reporter.mu.Unlock()
+
+	// A rejoined guild gets a fresh sequencer worker.
+	handler.Flush(mock.TestGuild)
+}
+
+func TestHandler_GuildLeave_afterQueuedJoin(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	settingsStore := settings.NewStore()
+
+	handler := &callbacks.Handler{
+		Log:      mock.NewLogger(),
+		Settings: settingsStore,
+	}
+
+	guild, ok := session.Caches.Guild(mock.TestGuild)
+	require.True(t, ok)
+
+	// A kick right after joining purges the settings the still queued join
+	// initializes.
+	handler.GuildJoin(&events.GuildJoin{
+		GenericGuild: &events.GenericGuild{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			GuildID:      mock.TestGuild,
+		},
+		Guild: discord.GatewayGuild{RestGuild: discord.RestGuild{Guild: guild}},
+	})
+
+	handler.GuildLeave(&events.GuildLeave{
+		GenericGuild: &events.GenericGuild{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			GuildID:      mock.TestGuild,
+		},
+		Guild: guild,
+	})
+
+	handler.Flush(mock.TestGuild)
+
+	assert.Never(t, func() bool {
+		_, ok := settingsStore.Guild(mock.TestGuild)
+		return ok
+	}, 100*time.Millisecond, 10*time.Millisecond, "settings of a guild left restored by a queued join")
+}
+
+func TestHandler_GuildLeave_concurrentFlush(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	handler := &callbacks.Handler{Log: mock.NewLogger()}
+
+	event := &events.GuildLeave{
+		GenericGuild: &events.GenericGuild{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			GuildID:      mock.TestGuild,
+		},
+		Guild: discord.Guild{ID: mock.TestGuild, Name: mock.TestGuildName},
+	}
+
+	// A Flush racing the removal of its guild's queue must still return.
+	var wg sync.WaitGroup
+
+	for range 100 {
+		wg.Go(func() { handler.Flush(mock.TestGuild) })
+		wg.Go(func() { handler.GuildLeave(event) })
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Flush racing GuildLeave hung")
+	}
+}
@@ -0,0 +1,49 @@
+package callbacks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+)
+
+// DispatchStarted is the callback function for every event from Discord,
+// marking the start of its dispatch to the event listeners. It must be added
+// before every other listener.
+func (handler *Handler) DispatchStarted(bot.Event) {
+	handler.dispatchStarted.Store(time.Now().UnixNano())
+}
+
+// DispatchDone is the callback function for every event from Discord,
+// marking the end of its dispatch to the event listeners. It must be added
+// after every other listener.
+//
+// disgo skips the listeners after one that panics, DispatchDone included, so
+// a dispatch can look unfinished until the next event, a heartbeat ACK at
+// worst, starts.
+func (handler *Handler) DispatchDone(bot.Event) {
+	handler.dispatchStarted.Store(0)
+}
+
+// Liveness returns an error if event handling has stopped making progress
+// for longer than threshold while there is work to do: an event has been
+// dispatching to the listeners, which hold disgo's event-manager mutex and
+// the shard's gateway read loop, for that long, or a guild's sequencer worker
+// has pending jobs but hasn't started or completed one, nor a step of a long
+// one such as a reconcile pass, for that long.
+//
+// Either way events are no longer being handled, or are being dropped as
+// guild queues fill up, and only a restart recovers.
+func (handler *Handler) Liveness(threshold time.Duration) error {
+	if started := handler.dispatchStarted.Load(); started != 0 {
+		if dispatching := time.Since(time.Unix(0, started)); dispatching > threshold {
+			return fmt.Errorf("event dispatch wedged for %s", dispatching.Round(time.Second))
+		}
+	}
+
+	if stalled := handler.sequencer.Stalled(threshold); len(stalled) > 0 {
+		return fmt.Errorf("guild workers wedged for over %s: %v", threshold, stalled)
+	}
+
+	return nil
+}
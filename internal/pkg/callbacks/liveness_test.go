@@ -0,0 +1,82 @@
+package callbacks_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+const testLivenessThreshold = 20 * time.Millisecond
+
+// blockingGateway blocks role creation until release is closed.
+type blockingGateway struct {
+	release chan struct{}
+}
+
+func (gateway *blockingGateway) CreateRole(context.Context, snowflake.ID, string, int, string) (discord.Role, error) {
+	<-gateway.release
+	return discord.Role{}, context.Canceled
+}
+
+func TestHandler_Liveness(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := mock.NewLogger()
+	operationsGateway := &blockingGateway{release: make(chan struct{})}
+
+	handler := &callbacks.Handler{
+		Log:                     log,
+		RolePrefix:              rolePrefix,
+		VoiceStateUpdateCounter: monitor.VoiceStateUpdateCounter(&monitor.Config{Log: log}),
+		OperationsGateway:       operationsGateway,
+	}
+
+	require.NoError(t, handler.Liveness(testLivenessThreshold))
+
+	event := &events.HeartbeatAck{GenericEvent: events.NewGenericEvent(session, 0, 0)}
+
+	handler.DispatchStarted(event)
+	time.Sleep(2 * testLivenessThreshold)
+	assert.ErrorContains(t, handler.Liveness(testLivenessThreshold), "event dispatch")
+
+	handler.DispatchDone(event)
+	require.NoError(t, handler.Liveness(testLivenessThreshold))
+
+	testUserMember, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+
+	// Joining TestChannel2, which has no ephemeral role yet, blocks the
+	// guild's worker on creating one.
+	handler.VoiceStateUpdate(&events.GuildVoiceStateUpdate{
+		GenericGuildVoiceState: &events.GenericGuildVoiceState{
+			GenericEvent: events.NewGenericEvent(session, 0, 0),
+			VoiceState: discord.VoiceState{
+				GuildID:   mock.TestGuild,
+				ChannelID: new(mock.TestChannel2),
+				UserID:    mock.TestUser,
+			},
+			Member: testUserMember,
+		},
+	})
+
+	time.Sleep(2 * testLivenessThreshold)
+	assert.ErrorContains(t, handler.Liveness(testLivenessThreshold), mock.TestGuild.String())
+
+	close(operationsGateway.release)
+	handler.Flush(mock.TestGuild)
+
+	assert.NoError(t, handler.Liveness(testLivenessThreshold))
+}
@@ -6,19 +6,21 @@ import (
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/disgo/gateway"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
 )
 
 const readyEventError = unableToProcessEvent + "Ready"
 
 // Ready is the callback function for the Ready event from Discord.
 func (handler *Handler) Ready(event *events.Ready) {
-	handler.ReadyCounter.Inc()
+	handler.ReadyCounter.WithLabelValues(monitor.ShardLabel(event.ShardID())).Inc()
 
 	err := event.Client().SetPresenceForShard(context.Background(), event.ShardID(),
 		gateway.WithOnlineStatus(discord.OnlineStatusOnline),
 		gateway.WithWatchingActivity("voice channels"),
 	)
 	if err != nil {
-		handler.Log.Error(readyEventError, "error", err)
+		handler.Log.Error(readyEventError, ShardIDKey, event.ShardID(), "error", err)
 	}
 }
@@ -0,0 +1,185 @@
+package callbacks
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/reason"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
+)
+
+const (
+	reconcile    = "Reconcile"
+	cleanup      = "Cleanup"
+	cleanupError = "unable to clean up guild roles"
+)
+
+// RoleStats returns how many ephemeral roles guildID has, and how many of its
+// cached members hold at least one of them.
+func (handler *Handler) RoleStats(client *bot.Client, guildID snowflake.ID) (roles, members int) {
+	ephemeralRoles := handler.ephemeralRoleIDs(client, guildID)
+
+	for member := range client.Caches.Members(guildID) {
+		if slices.ContainsFunc(member.RoleIDs, func(roleID snowflake.ID) bool {
+			return slices.Contains(ephemeralRoles, roleID)
+		}) {
+			members++
+		}
+	}
+
+	return len(ephemeralRoles), members
+}
+
+// EphemeralRoles returns how many ephemeral roles guildID has. Unlike
+// RoleStats, it doesn't walk the guild's member cache.
+func (handler *Handler) EphemeralRoles(client *bot.Client, guildID snowflake.ID) int {
+	return len(handler.ephemeralRoleIDs(client, guildID))
+}
+
+// Reconcile queues a pass over guildID's cached members, bringing each one's
+// ephemeral roles in line with the voice channel they're connected to, for
+// when missed or dropped events left roles stale. It reports false if the
+// guild's queue is full.
+//
+// Members that are neither connected nor holding an ephemeral role are
+// skipped, so a pass over a quiet guild makes no REST calls.
+func (handler *Handler) Reconcile(client *bot.Client, guildID snowflake.ID) bool {
+	ctx, span := handler.startEvent(reconcile, tracing.GuildIDKey.String(guildID.String()))
+
+	accepted := handler.sequencer.Submit(guildID, handler.eventJob(ctx, span, guildID, func(ctx context.Context) {
+		handler.handleReconcile(ctx, client, guildID)
+	}))
+	if !accepted {
+		tracing.End(span, errGuildQueueFull)
+	}
+
+	return accepted
+}
+
+func (handler *Handler) handleReconcile(ctx context.Context, client *bot.Client, guildID snowflake.ID) {
+	ephemeralRoles := handler.ephemeralRoleIDs(client, guildID)
+
+	var members []discord.Member
+
+	// Collect before applying: applying mutates the member cache, which the
+	// Members iterator holds a lock on for the duration of the range.
+	for member := range client.Caches.Members(guildID) {
+		members = append(members, member)
+	}
+
+	// The pass is a single event: every member's log lines share its ID.
+	eventID := newEventID()
+	reconciled := 0
+
+	for _, member := range members {
+		handler.sequencer.Progress(guildID)
+
+		voiceState, connected := client.Caches.VoiceState(guildID, member.User.ID)
+		if !connected {
+			voiceState = discord.VoiceState{GuildID: guildID, UserID: member.User.ID}
+		}
+
+		holdsEphemeralRole := slices.ContainsFunc(member.RoleIDs, func(roleID snowflake.ID) bool {
+			return slices.Contains(ephemeralRoles, roleID)
+		})
+
+		if voiceState.ChannelID == nil && !holdsEphemeralRole {
+			continue
+		}
+
+		correlation := handler.correlateGuildShard(client, newCorrelation(reconcile, eventID, voiceState))
+
+		handler.applyVoiceState(ctx, correlation, client, voiceState, &member)
+
+		reconciled++
+	}
+
+	handler.Log.InfoContext(ctx, "reconciled guild",
+		EventIDKey, eventID,
+		GuildIDKey, guildID,
+		"members", reconciled,
+	)
+}
+
+// Cleanup queues the deletion of guildID's orphaned ephemeral roles: those
+// not matching any of its current voice channels, left behind by a renamed
+// channel or a dropped ChannelDelete. It reports false if the guild's queue is
+// full.
+func (handler *Handler) Cleanup(client *bot.Client, guildID snowflake.ID) bool {
+	ctx, span := handler.startEvent(cleanup, tracing.GuildIDKey.String(guildID.String()))
+
+	accepted := handler.sequencer.Submit(guildID, handler.eventJob(ctx, span, guildID, func(ctx context.Context) {
+		handler.handleCleanup(ctx, client, guildID)
+	}))
+	if !accepted {
+		tracing.End(span, errGuildQueueFull)
+	}
+
+	return accepted
+}
+
+func (handler *Handler) handleCleanup(ctx context.Context, client *bot.Client, guildID snowflake.ID) {
+	current := make(map[string]bool)
+
+	for channel := range client.Caches.ChannelsForGuild(guildID) {
+		if channel.Type() == discord.ChannelTypeGuildVoice || channel.Type() == discord.ChannelTypeGuildStageVoice {
+			current[handler.RoleNameFromChannel(channel.Name())] = true
+		}
+	}
+
+	var orphaned []discord.Role
+
+	// Resolve the orphans before deleting them, as in handleChannelDelete.
+	for role := range client.Caches.Roles(guildID) {
+		if strings.HasPrefix(role.Name, handler.RolePrefix) && !current[role.Name] {
+			orphaned = append(orphaned, role)
+		}
+	}
+
+	correlation := handler.correlateGuildShard(client, &Correlation{Event: cleanup, EventID: newEventID(), GuildID: guildID})
+	log := handler.Log.With(correlation.LogAttrs()...)
+	deleted := 0
+
+	orphanedReason := handler.auditReason(client, guildID, reason.KindOrphanedRole, "")
+
+	for _, role := range orphaned {
+		handler.sequencer.Progress(guildID)
+
+		err := operations.DeleteRole(ctx, client, guildID, role.ID, orphanedReason)
+
+		handler.recordAudit(ctx, client, correlation, audit.Entry{
+			Action:   audit.ActionDeleteRole,
+			RoleID:   role.ID,
+			RoleName: role.Name,
+		}, err)
+
+		if err != nil {
+			log.ErrorContext(ctx, cleanupError, "roleID", role.ID, "error", err)
+			continue
+		}
+
+		deleted++
+	}
+
+	log.InfoContext(ctx, "cleaned up guild roles", "deleted", deleted)
+}
+
+// ephemeralRoleIDs returns the IDs of guildID's ephemeral roles.
+func (handler *Handler) ephemeralRoleIDs(client *bot.Client, guildID snowflake.ID) []snowflake.ID {
+	var roleIDs []snowflake.ID
+
+	for role := range client.Caches.Roles(guildID) {
+		if strings.HasPrefix(role.Name, handler.RolePrefix) {
+			roleIDs = append(roleIDs, role.ID)
+		}
+	}
+
+	return roleIDs
+}
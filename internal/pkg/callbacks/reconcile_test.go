@@ -0,0 +1,79 @@
+package callbacks_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+)
+
+const orphanedRole snowflake.ID = 999777
+
+func TestHandler_Reconcile(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	handler := &callbacks.Handler{
+		Log:               mock.NewLogger(),
+		RolePrefix:        rolePrefix,
+		OperationsGateway: operations.NewGateway(session),
+	}
+
+	roles, members := handler.RoleStats(session, mock.TestGuild)
+	assert.Equal(t, 1, roles)
+	assert.Equal(t, 2, members)
+	assert.Equal(t, roles, handler.EphemeralRoles(session, mock.TestGuild))
+
+	// No one is connected to voice, so the ephemeral role the mock members
+	// hold is stale.
+	require.True(t, handler.Reconcile(session, mock.TestGuild))
+	handler.Flush(mock.TestGuild)
+
+	member, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+	assert.NotContains(t, member.RoleIDs, mock.TestEphemeralRole)
+
+	_, members = handler.RoleStats(session, mock.TestGuild)
+	assert.Equal(t, 0, members)
+}
+
+func TestHandler_Cleanup(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	// The mock fixtures share channel IDs across guilds, so the channel cache
+	// holds the voice channels of the guild added last, TestGuildLarge.
+	session.Caches.AddRole(discord.Role{
+		ID:      orphanedRole,
+		GuildID: mock.TestGuildLarge,
+		Name:    rolePrefix + " renamedChannel",
+	})
+
+	handler := &callbacks.Handler{
+		Log:        mock.NewLogger(),
+		RolePrefix: rolePrefix,
+	}
+
+	require.True(t, handler.Cleanup(session, mock.TestGuildLarge))
+	handler.Flush(mock.TestGuildLarge)
+
+	var roleIDs []snowflake.ID
+
+	for role := range session.Caches.Roles(mock.TestGuildLarge) {
+		roleIDs = append(roleIDs, role.ID)
+	}
+
+	assert.False(t, slices.Contains(roleIDs, orphanedRole), "orphaned role not deleted")
+	assert.True(t, slices.Contains(roleIDs, mock.TestEphemeralRole), "current ephemeral role deleted")
+}
@@ -1,7 +1,10 @@
 package callbacks
 
 import (
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/disgoorg/snowflake/v2"
 )
@@ -23,7 +26,26 @@ const guildQueueBuffer = 64
 // processing. The zero value is ready to use.
 type guildSequencer struct {
 	mu     sync.Mutex
-	queues map[snowflake.ID]chan func()
+	queues map[snowflake.ID]*guildQueue
+}
+
+// guildQueue is a guild's job channel, with the progress of its worker
+// through it.
+type guildQueue struct {
+	jobs chan func()
+
+	// mu is held for reading while sending to jobs, and for writing to close
+	// it, so that no send races the close. closed is set by Remove, after
+	// which the queue accepts no more jobs.
+	mu     sync.RWMutex
+	closed bool
+
+	// pending counts the jobs submitted and not yet completed, and progress
+	// is when the worker last started or completed one, or the running one
+	// last reported Progress, or when the first of the pending jobs was
+	// submitted to an idle worker, in Unix nanoseconds.
+	pending  atomic.Int64
+	progress atomic.Int64
 }
 
 // Submit queues fn to run on guildID's dedicated worker, creating the worker
@@ -39,11 +61,11 @@ type guildSequencer struct {
 // risks at most a stale ephemeral role, which the member's next voice event
 // corrects.
 func (s *guildSequencer) Submit(guildID snowflake.ID, fn func()) bool {
-	select {
-	case s.queue(guildID) <- fn:
-		return true
-	default:
-		return false
+	for {
+		queued, closed := s.queue(guildID).send(fn, false)
+		if !closed {
+			return queued
+		}
 	}
 }
 
@@ -53,7 +75,12 @@ func (s *guildSequencer) Submit(guildID snowflake.ID, fn func()) bool {
 // after a Submit drop, tests) while still needing fn to run serialized on
 // the guild's worker.
 func (s *guildSequencer) SubmitWait(guildID snowflake.ID, fn func()) {
-	s.queue(guildID) <- fn
+	for {
+		_, closed := s.queue(guildID).send(fn, true)
+		if !closed {
+			return
+		}
+	}
 }
 
 // Flush blocks until every job submitted for guildID before this call has
@@ -66,29 +93,144 @@ func (s *guildSequencer) Flush(guildID snowflake.ID) {
 	<-done
 }
 
+// Remove forgets guildID's queue, for guilds the bot has left, and closes it:
+// its worker stops once the work already queued has completed. Like Submit it
+// never blocks: while a SubmitWait is blocked on the full queue, the close is
+// handed to a goroutine that waits for it.
+//
+// Work submitted after Remove, including by a SubmitWait or Flush racing it,
+// goes to a new queue, so it still runs and Flush still returns.
+func (s *guildSequencer) Remove(guildID snowflake.ID) {
+	s.mu.Lock()
+	queue, ok := s.queues[guildID]
+	delete(s.queues, guildID)
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if queue.mu.TryLock() {
+		queue.close()
+		return
+	}
+
+	go func() {
+		queue.mu.Lock()
+		queue.close()
+	}()
+}
+
+// Progress records that the job running on guildID's worker is making
+// progress, for jobs working through many steps, such as a pass over every
+// member of a guild, that would otherwise look stalled. It is called from the
+// job, between steps.
+func (s *guildSequencer) Progress(guildID snowflake.ID) {
+	s.mu.Lock()
+	queue, ok := s.queues[guildID]
+	s.mu.Unlock()
+
+	if ok {
+		queue.progress.Store(time.Now().UnixNano())
+	}
+}
+
+// Stalled returns the guilds whose worker has pending jobs but hasn't started
+// or completed one, nor reported Progress, for longer than threshold: a step
+// of a job has been running for that long, or the worker is wedged.
+func (s *guildSequencer) Stalled(threshold time.Duration) []snowflake.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stalled []snowflake.ID
+
+	cutoff := time.Now().Add(-threshold).UnixNano()
+
+	for guildID, queue := range s.queues {
+		if queue.pending.Load() > 0 && queue.progress.Load() < cutoff {
+			stalled = append(stalled, guildID)
+		}
+	}
+
+	slices.Sort(stalled)
+
+	return stalled
+}
+
 // queue returns guildID's job channel, creating it and starting its drain
 // worker on first use.
-func (s *guildSequencer) queue(guildID snowflake.ID) chan func() {
+func (s *guildSequencer) queue(guildID snowflake.ID) *guildQueue {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.queues == nil {
-		s.queues = make(map[snowflake.ID]chan func())
+		s.queues = make(map[snowflake.ID]*guildQueue)
 	}
 
 	queue, ok := s.queues[guildID]
 	if !ok {
-		queue = make(chan func(), guildQueueBuffer)
+		queue = &guildQueue{jobs: make(chan func(), guildQueueBuffer)}
 		s.queues[guildID] = queue
 
-		go drainGuildQueue(queue)
+		go queue.drain()
 	}
 
 	return queue
 }
 
-func drainGuildQueue(queue chan func()) {
-	for fn := range queue {
+// send sends fn to the queue, waiting for capacity if wait is set, and
+// reports whether it was queued, or whether the queue was closed instead, in
+// which case the caller must get a new one.
+func (queue *guildQueue) send(fn func(), wait bool) (queued, closed bool) {
+	queue.mu.RLock()
+	defer queue.mu.RUnlock()
+
+	if queue.closed {
+		return false, true
+	}
+
+	queue.submitted()
+
+	if wait {
+		queue.jobs <- fn
+		return true, false
+	}
+
+	select {
+	case queue.jobs <- fn:
+		return true, false
+	default:
+		queue.pending.Add(-1)
+		return false, false
+	}
+}
+
+// close stops the queue from accepting jobs, so its worker exits once it has
+// drained the remaining ones. The caller must hold queue.mu for writing,
+// which close releases.
+func (queue *guildQueue) close() {
+	defer queue.mu.Unlock()
+
+	queue.closed = true
+	close(queue.jobs)
+}
+
+// submitted counts a job about to be submitted to the queue. A job submitted
+// to an idle worker starts the clock on its progress.
+func (queue *guildQueue) submitted() {
+	if queue.pending.Add(1) == 1 {
+		queue.progress.Store(time.Now().UnixNano())
+	}
+}
+
+// drain runs the jobs sent to the queue until Remove closes it.
+func (queue *guildQueue) drain() {
+	for fn := range queue.jobs {
+		queue.progress.Store(time.Now().UnixNano())
+
 		fn()
+
+		queue.progress.Store(time.Now().UnixNano())
+		queue.pending.Add(-1)
 	}
 }
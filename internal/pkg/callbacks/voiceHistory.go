@@ -0,0 +1,138 @@
+package callbacks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/omit"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
+)
+
+// VoiceHistoryCommandName is the name of the slash command querying voice
+// history.
+const VoiceHistoryCommandName = "voicehistory"
+
+const (
+	voiceHistoryMemberOption  = "member"
+	voiceHistoryChannelOption = "channel"
+
+	// voiceHistoryDisplayLimit caps the sessions listed in a reply, keeping it
+	// well inside Discord's message length limit. The total time still covers
+	// every retained session.
+	voiceHistoryDisplayLimit = 10
+
+	voiceHistoryCommandError = unableToProcessEvent + "voice history command"
+)
+
+// VoiceHistoryCommand is the definition of the slash command querying voice
+// history, registered with Discord at startup. It reveals members' activity,
+// so by default only members who can manage the guild may use it; guilds can
+// change that in their integration settings.
+var VoiceHistoryCommand = discord.SlashCommandCreate{
+	Name:        VoiceHistoryCommandName,
+	Description: "Show recent voice channel sessions and total time connected",
+	Options: []discord.ApplicationCommandOption{
+		discord.ApplicationCommandOptionUser{
+			Name:        voiceHistoryMemberOption,
+			Description: "Only show sessions of this member",
+		},
+		discord.ApplicationCommandOptionChannel{
+			Name:         voiceHistoryChannelOption,
+			Description:  "Only show sessions in this voice channel",
+			ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildVoice, discord.ChannelTypeGuildStageVoice},
+		},
+	},
+	Contexts:                 []discord.InteractionContextType{discord.InteractionContextTypeGuild},
+	DefaultMemberPermissions: omit.NewPtr(discord.PermissionManageGuild),
+}
+
+// ApplicationCommand is the callback function for the
+// ApplicationCommandInteractionCreate event from Discord, dispatching the
+// bot's slash commands.
+//
+// Replying is a Discord REST call, so it runs off the shard's gateway read
+// loop. It doesn't touch guild roles, so it doesn't need the guild's
+// sequencer either.
+func (handler *Handler) ApplicationCommand(event *events.ApplicationCommandInteractionCreate) {
+	if event.Data.CommandName() != VoiceHistoryCommandName || event.GuildID() == nil {
+		return
+	}
+
+	go handler.handleVoiceHistoryCommand(event)
+}
+
+func (handler *Handler) handleVoiceHistoryCommand(event *events.ApplicationCommandInteractionCreate) {
+	content := "Voice history is not enabled."
+
+	if handler.VoiceHistory != nil {
+		data := event.SlashCommandInteractionData()
+		query := voicehistory.Query{GuildID: *event.GuildID()}
+
+		query.UserID, _ = data.OptSnowflake(voiceHistoryMemberOption)
+		query.ChannelID, _ = data.OptSnowflake(voiceHistoryChannelOption)
+
+		content = voiceHistoryMessage(query, handler.VoiceHistory.Query(query), time.Now())
+	}
+
+	ctx, cancel := operations.RequestContext(context.Background())
+	defer cancel()
+
+	err := event.CreateMessage(discord.MessageCreate{
+		Content:         content,
+		Flags:           discord.MessageFlagEphemeral,
+		AllowedMentions: &discord.AllowedMentions{},
+	}, rest.WithCtx(ctx))
+	if err != nil {
+		handler.Log.Debug(voiceHistoryCommandError, "guildID", *event.GuildID(), "error", err)
+	}
+}
+
+// voiceHistoryMessage returns the reply to a voice history query, listing the
+// most recent of the matching sessions and their total time as of now.
+func voiceHistoryMessage(query voicehistory.Query, sessions []voicehistory.Session, now time.Time) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString("Voice history")
+
+	if query.UserID != 0 {
+		_, _ = fmt.Fprintf(builder, " of <@%s>", query.UserID)
+	}
+
+	if query.ChannelID != 0 {
+		_, _ = fmt.Fprintf(builder, " in <#%s>", query.ChannelID)
+	}
+
+	if len(sessions) == 0 {
+		builder.WriteString(": no sessions recorded.")
+		return builder.String()
+	}
+
+	_, _ = fmt.Fprintf(builder, ": %s across %d sessions\n",
+		formatDuration(voicehistory.TotalDuration(sessions, now)), len(sessions),
+	)
+
+	for _, session := range sessions[:min(voiceHistoryDisplayLimit, len(sessions))] {
+		_, _ = fmt.Fprintf(builder, "- <@%s> in <#%s> <t:%d:f>, %s",
+			session.UserID, session.ChannelID, session.Start.Unix(), formatDuration(session.Duration(now)),
+		)
+
+		if session.Ongoing() {
+			builder.WriteString(" (ongoing)")
+		}
+
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func formatDuration(duration time.Duration) string {
+	return duration.Round(time.Second).String()
+}
@@ -0,0 +1,65 @@
+package callbacks_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
+)
+
+func TestHandler_ApplicationCommand_voiceHistory(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	voiceHistory := voicehistory.NewStore(&voicehistory.Config{})
+	start := time.Now().Add(-time.Hour)
+
+	voiceHistory.Transition(mock.TestGuild, mock.TestUser, nil, new(mock.TestChannel), start)
+	voiceHistory.Transition(mock.TestGuild, mock.TestUser, new(mock.TestChannel), nil, start.Add(90*time.Second))
+
+	handler := &callbacks.Handler{
+		Log:          mock.NewLogger(),
+		VoiceHistory: voiceHistory,
+	}
+
+	interaction := discord.ApplicationCommandInteraction{}
+	require.NoError(t, json.Unmarshal(fmt.Appendf(nil, `{
+		"id": "1", "application_id": "2", "type": 2, "token": "token", "guild_id": "%s",
+		"data": {
+			"id": "3", "type": 1, "name": %q,
+			"options": [{"name": "member", "type": 6, "value": "%s"}]
+		}
+	}`, mock.TestGuild, callbacks.VoiceHistoryCommandName, mock.TestUser), &interaction))
+
+	replies := make(chan discord.MessageCreate, 1)
+
+	handler.ApplicationCommand(&events.ApplicationCommandInteractionCreate{
+		GenericEvent:                  events.NewGenericEvent(session, 0, 0),
+		ApplicationCommandInteraction: interaction,
+		Respond: func(_ discord.InteractionResponseType, data discord.InteractionResponseData, _ ...rest.RequestOpt) error {
+			replies <- data.(discord.MessageCreate)
+			return nil
+		},
+	})
+
+	select {
+	case reply := <-replies:
+		assert.Equal(t, discord.MessageFlagEphemeral, reply.Flags)
+		assert.Contains(t, reply.Content, fmt.Sprintf("Voice history of <@%s>: 1m30s across 1 sessions", mock.TestUser))
+		assert.Contains(t, reply.Content, fmt.Sprintf("in <#%s>", mock.TestChannel))
+	case <-time.After(time.Second):
+		require.Fail(t, "no reply to voice history command")
+	}
+}
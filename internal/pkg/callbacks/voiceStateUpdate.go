@@ -1,18 +1,25 @@
 package callbacks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/snowflake/v2"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/reason"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
 )
 
 const (
@@ -22,6 +29,7 @@ const (
 
 type voiceStateUpdateMetadata struct {
 	Client        *bot.Client
+	Correlation   *Correlation
 	Guild         *discord.Guild
 	Member        *discord.Member
 	Channel       discord.GuildChannel
@@ -35,27 +43,85 @@ type voiceStateUpdateMetadata struct {
 // that can block on rate limiting, and this callback is invoked synchronously
 // from the shard's gateway read loop, so running that work here would risk
 // stalling heartbeat ACK processing.
+//
+// Each event is traced from here, through its wait in the guild's queue, to
+// the Discord REST calls made for it.
 func (handler *Handler) VoiceStateUpdate(event *events.GuildVoiceStateUpdate) {
-	handler.VoiceStateUpdateCounter.Inc()
+	handler.VoiceStateUpdateCounter.WithLabelValues(monitor.ShardLabel(event.ShardID())).Inc()
 
-	accepted := handler.sequencer.Submit(event.VoiceState.GuildID, func() {
-		handler.handleVoiceStateUpdate(event)
-	})
-	if !accepted {
-		handler.Log.Warn("dropping VoiceStateUpdate event: guild queue full",
-			"guildID", event.VoiceState.GuildID,
+	ctx, span := handler.startEvent(voiceStateUpdate, voiceStateAttributes(event.VoiceState)...)
+
+	transition, ok := monitor.VoiceTransition(event.OldVoiceState.ChannelID, event.VoiceState.ChannelID)
+	if ok && handler.VoiceTransitionsCounter != nil {
+		handler.VoiceTransitionsCounter.WithLabelValues(transition).Inc()
+	}
+
+	if ok && handler.VoiceHistory != nil {
+		handler.VoiceHistory.Transition(
+			event.VoiceState.GuildID, event.VoiceState.UserID,
+			event.OldVoiceState.ChannelID, event.VoiceState.ChannelID,
+			time.Now(),
 		)
 	}
+
+	correlation := handler.correlateShard(
+		newCorrelation(voiceStateUpdate, newEventID(), event.VoiceState),
+		event.ShardID(),
+	)
+
+	guildID := event.VoiceState.GuildID
+
+	accepted := handler.sequencer.Submit(guildID, handler.eventJob(ctx, span, guildID, func(ctx context.Context) {
+		handler.handleVoiceStateUpdate(ctx, correlation, event)
+	}))
+	if !accepted {
+		tracing.End(span, errGuildQueueFull)
+
+		handler.Log.WarnContext(ctx, "dropping VoiceStateUpdate event: guild queue full", correlation.LogAttrs()...)
+	}
 }
 
-func (handler *Handler) handleVoiceStateUpdate(event *events.GuildVoiceStateUpdate) {
-	metadata, err := handler.parseEvent(event.Client(), event.VoiceState, &event.Member)
+func (handler *Handler) handleVoiceStateUpdate(
+	ctx context.Context,
+	correlation *Correlation,
+	event *events.GuildVoiceStateUpdate,
+) {
+	handler.applyVoiceState(ctx, correlation, event.Client(), event.VoiceState, &event.Member)
+}
+
+// voiceStateAttributes returns the span attributes identifying voiceState.
+func voiceStateAttributes(voiceState discord.VoiceState) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		tracing.GuildIDKey.String(voiceState.GuildID.String()),
+		tracing.UserIDKey.String(voiceState.UserID.String()),
+	}
+
+	if voiceState.ChannelID != nil {
+		attrs = append(attrs, tracing.ChannelIDKey.String(voiceState.ChannelID.String()))
+	}
+
+	return attrs
+}
+
+// applyVoiceState brings member's ephemeral roles in line with voiceState:
+// the role for the channel they're connected to, if any, and no others. Log
+// lines are attributed to the event identified by correlation.
+func (handler *Handler) applyVoiceState(
+	ctx context.Context,
+	correlation *Correlation,
+	client *bot.Client,
+	voiceState discord.VoiceState,
+	member *discord.Member,
+) {
+	metadata, err := handler.parseEvent(ctx, correlation, client, voiceState, member)
 	if err != nil {
-		handler.handleParseEventError(event.Client(), err)
+		handler.handleParseEventError(ctx, correlation, client, err)
 		return
 	}
 
-	log := handler.Log.With(
+	metadata.Correlation = correlation
+
+	log := handler.Log.With(correlation.LogAttrs()...).With(
 		"guild", metadata.Guild.Name,
 		"member", metadata.Member.User.Username,
 	)
@@ -64,30 +130,34 @@ func (handler *Handler) handleVoiceStateUpdate(event *events.GuildVoiceStateUpda
 		return
 	}
 
-	if err := handler.removeEphemeralRoles(metadata); err != nil {
-		log.Error(voiceStateUpdateEventError, "error", err)
+	if err := handler.removeEphemeralRoles(ctx, metadata); err != nil {
+		log.ErrorContext(ctx, voiceStateUpdateEventError, "error", err)
 	}
 
 	if metadata.Channel == nil {
 		return
 	}
 
-	if err := handler.addEphemeralRole(metadata); err != nil {
+	if err := handler.addEphemeralRole(ctx, metadata); err != nil {
+		handler.reportForbidden(metadata.Guild.ID, metadata.EphemeralRole.ID, err)
+
 		if operations.ShouldLogDebug(err) {
-			log.Debug(voiceStateUpdateEventError, "error", err)
+			log.DebugContext(ctx, voiceStateUpdateEventError, "error", err)
 			return
 		}
 
-		log.Error(voiceStateUpdateEventError, "error", err)
+		log.ErrorContext(ctx, voiceStateUpdateEventError, "error", err)
 	}
 }
 
 func (handler *Handler) parseEvent(
+	ctx context.Context,
+	correlation *Correlation,
 	client *bot.Client,
 	voiceState discord.VoiceState,
 	member *discord.Member,
 ) (*voiceStateUpdateMetadata, error) {
-	guild, err := operations.LookupGuild(client, voiceState.GuildID)
+	guild, err := operations.LookupGuild(ctx, client, voiceState.GuildID)
 	if err != nil {
 		return nil, fmt.Errorf("unable to lookup Guild: %w", err)
 	}
@@ -109,7 +179,7 @@ func (handler *Handler) parseEvent(
 		return nil, &EventError{Kind: KindInsufficientPermissions, Guild: &guild, Member: member, Channel: channel, Err: err}
 	}
 
-	ephemeralRole, err := handler.ephemeralRoleForChannel(client, &guild, member, channel)
+	ephemeralRole, err := handler.ephemeralRoleForChannel(ctx, correlation, client, &guild, member, channel)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +194,8 @@ func (handler *Handler) parseEvent(
 }
 
 func (handler *Handler) ephemeralRoleForChannel(
+	ctx context.Context,
+	correlation *Correlation,
 	client *bot.Client,
 	guild *discord.Guild,
 	member *discord.Member,
@@ -135,7 +207,17 @@ func (handler *Handler) ephemeralRoleForChannel(
 		return &role, nil
 	}
 
-	role, err := handler.OperationsGateway.CreateRole(guild.ID, ephemeralRoleName, handler.RoleColor)
+	role, err := handler.OperationsGateway.CreateRole(
+		ctx, guild.ID, ephemeralRoleName, handler.RoleColor,
+		handler.auditReason(client, guild.ID, reason.KindChannelRole, channel.Name()),
+	)
+
+	handler.recordAudit(ctx, client, correlation, audit.Entry{
+		Action:   audit.ActionCreateRole,
+		RoleID:   role.ID,
+		RoleName: ephemeralRoleName,
+	}, err)
+
 	if err != nil {
 		eventErr := &EventError{Guild: guild, Member: member, Channel: channel, Err: err}
 
@@ -144,6 +226,8 @@ func (handler *Handler) ephemeralRoleForChannel(
 			eventErr.Kind = KindDeadlineExceeded
 		case operations.IsForbiddenResponse(err):
 			eventErr.Kind = KindInsufficientPermissions
+
+			handler.reportForbidden(guild.ID, 0, err)
 		case operations.IsMaxGuildsResponse(err):
 			eventErr.Kind = KindMaxNumberOfRoles
 		default:
@@ -156,37 +240,57 @@ func (handler *Handler) ephemeralRoleForChannel(
 	return &role, nil
 }
 
-func (handler *Handler) handleParseEventError(client *bot.Client, err error) {
+func (handler *Handler) handleParseEventError(
+	ctx context.Context,
+	correlation *Correlation,
+	client *bot.Client,
+	err error,
+) {
 	eventErr, ok := errors.AsType[*EventError](err)
 	if !ok {
-		handler.Log.Error(voiceStateUpdateEventError, "error", err)
+		handler.Log.ErrorContext(ctx, voiceStateUpdateEventError, append(correlation.LogAttrs(), "error", err)...)
 		return
 	}
 
+	if eventErr.Correlation == nil {
+		eventErr.Correlation = correlation
+	}
+
 	log := handler.newEventErrorLogger(eventErr)
 
-	log.Debug(voiceStateUpdateEventError, "error", eventErr)
+	log.DebugContext(ctx, voiceStateUpdateEventError, "error", eventErr)
 
 	if eventErr.Kind == KindDeadlineExceeded || eventErr.Guild == nil || eventErr.Member == nil {
 		return
 	}
 
 	metadata := &voiceStateUpdateMetadata{
-		Client: client,
-		Guild:  eventErr.Guild,
-		Member: eventErr.Member,
+		Client:      client,
+		Correlation: correlation,
+		Guild:       eventErr.Guild,
+		Member:      eventErr.Member,
 	}
 
-	if err := handler.removeEphemeralRoles(metadata); err != nil {
-		log.Debug(voiceStateUpdateEventError, "error", err)
+	if err := handler.removeEphemeralRoles(ctx, metadata); err != nil {
+		log.DebugContext(ctx, voiceStateUpdateEventError, "error", err)
 	}
 }
 
+// newEventErrorLogger returns a logger attributing log lines to the event
+// eventErr is about, and the guild, member, and channel it carries.
 func (handler *Handler) newEventErrorLogger(eventErr *EventError) *slog.Logger {
 	log := handler.Log
 
+	if eventErr.Correlation != nil {
+		log = log.With(eventErr.Correlation.LogAttrs()...)
+	}
+
 	if eventErr.Guild != nil {
 		log = log.With("guild", eventErr.Guild.Name)
+
+		if eventErr.Correlation == nil {
+			log = log.With(GuildIDKey, eventErr.Guild.ID)
+		}
 	}
 
 	if eventErr.Member != nil {
@@ -200,6 +304,20 @@ func (handler *Handler) newEventErrorLogger(eventErr *EventError) *slog.Logger {
 	return log
 }
 
+// removeReason returns the audit log reason for removing the member's
+// ephemeral roles: they moved to metadata.Channel, connected to a channel the
+// bot can't see, or disconnected.
+func (handler *Handler) removeReason(metadata *voiceStateUpdateMetadata) string {
+	switch {
+	case metadata.Channel != nil:
+		return handler.auditReason(metadata.Client, metadata.Guild.ID, reason.KindMovedChannel, metadata.Channel.Name())
+	case metadata.Correlation != nil && metadata.Correlation.ChannelID != nil:
+		return handler.auditReason(metadata.Client, metadata.Guild.ID, reason.KindChannelUnavailable, "")
+	default:
+		return handler.auditReason(metadata.Client, metadata.Guild.ID, reason.KindLeftChannel, "")
+	}
+}
+
 func lookupGuildRole(client *bot.Client, guildID snowflake.ID, roleName string) (discord.Role, bool) {
 	for role := range client.Caches.Roles(guildID) {
 		if role.Name == roleName {
@@ -210,21 +328,37 @@ func lookupGuildRole(client *bot.Client, guildID snowflake.ID, roleName string)
 	return discord.Role{}, false
 }
 
-func (*Handler) addEphemeralRole(metadata *voiceStateUpdateMetadata) error {
-	return operations.AddRoleToMember(metadata.Client, metadata.Guild.ID, metadata.Member.User.ID, metadata.EphemeralRole.ID)
+func (handler *Handler) addEphemeralRole(ctx context.Context, metadata *voiceStateUpdateMetadata) error {
+	err := operations.AddRoleToMember(
+		ctx, metadata.Client, metadata.Guild.ID, metadata.Member.User.ID, metadata.EphemeralRole.ID,
+		handler.auditReason(metadata.Client, metadata.Guild.ID, reason.KindJoinedChannel, metadata.Channel.Name()),
+	)
+
+	handler.recordAudit(ctx, metadata.Client, metadata.Correlation, audit.Entry{
+		Action:   audit.ActionAddRole,
+		RoleID:   metadata.EphemeralRole.ID,
+		RoleName: metadata.EphemeralRole.Name,
+		UserID:   metadata.Member.User.ID,
+	}, err)
+
+	return err
 }
 
-func (handler *Handler) removeEphemeralRoles(metadata *voiceStateUpdateMetadata) error {
+func (handler *Handler) removeEphemeralRoles(ctx context.Context, metadata *voiceStateUpdateMetadata) error {
 	var err error
 
 	for _, roleID := range metadata.Member.RoleIDs {
-		err = errors.Join(err, handler.removeEphemeralRole(metadata, roleID))
+		err = errors.Join(err, handler.removeEphemeralRole(ctx, metadata, roleID))
 	}
 
 	return err
 }
 
-func (handler *Handler) removeEphemeralRole(metadata *voiceStateUpdateMetadata, roleID snowflake.ID) error {
+func (handler *Handler) removeEphemeralRole(
+	ctx context.Context,
+	metadata *voiceStateUpdateMetadata,
+	roleID snowflake.ID,
+) error {
 	role, ok := metadata.Client.Caches.Role(metadata.Guild.ID, roleID)
 	if !ok {
 		return nil
@@ -234,10 +368,24 @@ func (handler *Handler) removeEphemeralRole(metadata *voiceStateUpdateMetadata,
 		return nil
 	}
 
-	if err := operations.RemoveRoleFromMember(metadata.Client, metadata.Guild.ID, metadata.Member.User.ID, role.ID); err != nil {
+	err := operations.RemoveRoleFromMember(
+		ctx, metadata.Client, metadata.Guild.ID, metadata.Member.User.ID, role.ID,
+		handler.removeReason(metadata),
+	)
+
+	handler.recordAudit(ctx, metadata.Client, metadata.Correlation, audit.Entry{
+		Action:   audit.ActionRemoveRole,
+		RoleID:   role.ID,
+		RoleName: role.Name,
+		UserID:   metadata.Member.User.ID,
+	}, err)
+
+	if err != nil {
 		if !operations.IsForbiddenResponse(err) {
 			return err
 		}
+
+		handler.reportForbidden(metadata.Guild.ID, role.ID, err)
 	}
 
 	return nil
@@ -1,8 +1,11 @@
 package callbacks_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"sync"
 	"testing"
@@ -12,12 +15,19 @@ import (
 	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/disgo/rest"
 	"github.com/disgoorg/snowflake/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/callbacks"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/diagnostics"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
 )
 
 func TestHandler_VoiceStateUpdate(t *testing.T) {
@@ -76,7 +86,7 @@ type errorGateway struct {
 	err error
 }
 
-func (gateway *errorGateway) CreateRole(snowflake.ID, string, int) (discord.Role, error) {
+func (gateway *errorGateway) CreateRole(context.Context, snowflake.ID, string, int, string) (discord.Role, error) {
 	return discord.Role{}, gateway.err
 }
 
@@ -133,6 +143,169 @@ func TestHandler_VoiceStateUpdate_createRoleErrors(t *testing.T) {
 	}
 }
 
+func TestHandler_VoiceStateUpdate_transitions(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := mock.NewLogger()
+
+	handler := &callbacks.Handler{
+		Log:                     log,
+		RolePrefix:              rolePrefix,
+		VoiceStateUpdateCounter: monitor.VoiceStateUpdateCounter(&monitor.Config{Log: log}),
+		VoiceTransitionsCounter: monitor.VoiceTransitionsCounter(&monitor.Config{Log: log}),
+		OperationsGateway:       operations.NewGateway(session),
+		VoiceHistory:            voicehistory.NewStore(&voicehistory.Config{}),
+	}
+
+	member, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+
+	// sendUpdate reports no previous voice state, so connecting is a join and
+	// disconnecting is not a transition at all.
+	sendUpdate(&sync.Mutex{}, session, handler, &member, new(mock.TestChannel))
+	sendUpdate(&sync.Mutex{}, session, handler, &member, nil)
+
+	assert.InDelta(t, 1, testutil.ToFloat64(handler.VoiceTransitionsCounter.WithLabelValues(monitor.VoiceTransitionJoin)), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(handler.VoiceTransitionsCounter.WithLabelValues(monitor.VoiceTransitionLeave)), 0)
+
+	sessions := handler.VoiceHistory.Query(voicehistory.Query{GuildID: mock.TestGuild, UserID: mock.TestUser})
+	require.Len(t, sessions, 1)
+	assert.Equal(t, mock.TestChannel, sessions[0].ChannelID)
+	assert.True(t, sessions[0].Ongoing())
+}
+
+func TestHandler_VoiceStateUpdate_traced(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := mock.NewLogger()
+	recorder := tracetest.NewSpanRecorder()
+
+	handler := &callbacks.Handler{
+		Log:                     log,
+		RolePrefix:              rolePrefix,
+		VoiceStateUpdateCounter: monitor.VoiceStateUpdateCounter(&monitor.Config{Log: log}),
+		OperationsGateway:       operations.NewGateway(session),
+		Tracer:                  sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"),
+	}
+
+	member, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+
+	// mock.TestChannel2 has no pre-existing ephemeral role, so the event
+	// creates one before adding it.
+	sendUpdate(&sync.Mutex{}, session, handler, &member, new(mock.TestChannel2))
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	root, ok := spans["VoiceStateUpdate"]
+	require.True(t, ok)
+	assert.Contains(t, root.Attributes(), tracing.ChannelIDKey.String(mock.TestChannel2.String()))
+
+	for _, name := range []string{"sequencer.wait", "operations.CreateRole", "operations.AddRoleToMember"} {
+		span, ok := spans[name]
+		require.True(t, ok, "missing span %s", name)
+
+		assert.Equal(t, root.SpanContext().TraceID(), span.SpanContext().TraceID())
+		assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+}
+
+func TestHandler_VoiceStateUpdate_correlated(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	log := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	handler := &callbacks.Handler{
+		Log:                     log,
+		RolePrefix:              rolePrefix,
+		VoiceStateUpdateCounter: monitor.VoiceStateUpdateCounter(&monitor.Config{Log: log}),
+		OperationsGateway: &errorGateway{
+			err: &rest.Error{Response: &http.Response{StatusCode: http.StatusForbidden}},
+		},
+	}
+
+	member, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+
+	sendUpdate(&sync.Mutex{}, session, handler, &member, new(mock.TestChannel2))
+
+	record := make(map[string]any)
+	require.NoError(t, json.NewDecoder(buf).Decode(&record))
+
+	assert.NotEmpty(t, record[callbacks.EventIDKey])
+	assert.Equal(t, mock.TestGuild.String(), record[callbacks.GuildIDKey])
+	assert.Equal(t, mock.TestUser.String(), record[callbacks.UserIDKey])
+	assert.Equal(t, mock.TestChannel2.String(), record[callbacks.ChannelIDKey])
+}
+
+type recordingReporter struct {
+	mu        sync.Mutex
+	reports   []snowflake.ID
+	forgotten []snowflake.ID
+}
+
+func (reporter *recordingReporter) Report(guildID, _ snowflake.ID) []diagnostics.Problem {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	reporter.reports = append(reporter.reports, guildID)
+
+	return nil
+}
+
+func (reporter *recordingReporter) Forget(guildID snowflake.ID) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	reporter.forgotten = append(reporter.forgotten, guildID)
+}
+
+func TestHandler_VoiceStateUpdate_reportsForbidden(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := mock.NewLogger()
+	reporter := &recordingReporter{}
+
+	handler := &callbacks.Handler{
+		Log:                     log,
+		RolePrefix:              rolePrefix,
+		VoiceStateUpdateCounter: monitor.VoiceStateUpdateCounter(&monitor.Config{Log: log}),
+		OperationsGateway: &errorGateway{
+			err: &rest.Error{Response: &http.Response{StatusCode: http.StatusForbidden}},
+		},
+		Diagnostics: reporter,
+	}
+
+	member, ok := session.Caches.Member(mock.TestGuild, mock.TestUser)
+	require.True(t, ok)
+
+	channelID := mock.TestChannel2
+
+	sendUpdate(&sync.Mutex{}, session, handler, &member, &channelID)
+
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	require.Equal(t, []snowflake.ID{mock.TestGuild}, reporter.reports)
+}
+
 func sendUpdate(
 	mutex *sync.Mutex,
 	session *bot.Client,
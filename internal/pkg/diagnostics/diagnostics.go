@@ -0,0 +1,280 @@
+// Package diagnostics detects guild configuration problems that prevent the
+// bot from managing ephemeral roles, and notifies guild administrators with
+// instructions on how to fix them.
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/operations"
+)
+
+// DefaultNotifyInterval is the minimum time between two notifications sent for
+// the same guild when Config.NotifyInterval is unset.
+const DefaultNotifyInterval = 24 * time.Hour
+
+// Problem messages.
+const (
+	MissingManageRolesMessage = "missing Manage Roles permission"
+	RoleHierarchyMessage      = "ephemeral role is above the bot's highest role"
+)
+
+const fixInstructions = "Open Server Settings → Roles and:\n" +
+	"1. Make sure the role for %[1]s has the **Manage Roles** permission.\n" +
+	"2. Drag the role for %[1]s to the top (or as near as possible) of the role list, " +
+	"above any role starting with `%[2]s`."
+
+// Problem classifies a guild configuration problem that prevents the bot from
+// managing ephemeral roles.
+type Problem int
+
+// Problem enumerations.
+const (
+	ProblemMissingManageRoles Problem = iota
+	ProblemRoleHierarchy
+)
+
+// Message returns the message for the Problem.
+func (problem Problem) Message() string {
+	switch problem {
+	case ProblemMissingManageRoles:
+		return MissingManageRolesMessage
+	case ProblemRoleHierarchy:
+		return RoleHierarchyMessage
+	default:
+		return "unknown problem"
+	}
+}
+
+// Config contains fields for configuring a Reporter.
+type Config struct {
+	Log        *slog.Logger
+	Client     *bot.Client
+	BotName    string
+	RolePrefix string
+
+	// NotifyInterval rate-limits notifications per guild. It defaults to
+	// DefaultNotifyInterval.
+	NotifyInterval time.Duration
+
+	// NotifyChannel, when set, returns the channel a guild has configured
+	// for bot notifications. Guilds without one have their owner notified
+	// by direct message instead.
+	NotifyChannel func(guildID snowflake.ID) (snowflake.ID, bool)
+}
+
+// Reporter detects guild configuration problems and notifies the guild's
+// administrators about them, at most once per NotifyInterval per guild.
+type Reporter struct {
+	*Config
+
+	mu       sync.Mutex
+	notified map[snowflake.ID]time.Time
+	sending  map[snowflake.ID]bool
+}
+
+// NewReporter returns a new *Reporter configured using the provided config.
+func NewReporter(config *Config) *Reporter {
+	if config.NotifyInterval <= 0 {
+		config.NotifyInterval = DefaultNotifyInterval
+	}
+
+	return &Reporter{
+		Config:   config,
+		notified: make(map[snowflake.ID]time.Time),
+		sending:  make(map[snowflake.ID]bool),
+	}
+}
+
+// Diagnose returns the problems preventing the bot from managing roleID in
+// guildID. A zero roleID skips the role hierarchy check, for failures that
+// happen before the role exists.
+func Diagnose(client *bot.Client, guildID, roleID snowflake.ID) []Problem {
+	selfMember, ok := client.Caches.SelfMember(guildID)
+	if !ok {
+		return nil
+	}
+
+	var problems []Problem
+
+	if !client.Caches.MemberPermissions(selfMember).Has(discord.PermissionManageRoles) {
+		problems = append(problems, ProblemMissingManageRoles)
+	}
+
+	if roleID == 0 {
+		return problems
+	}
+
+	role, ok := client.Caches.Role(guildID, roleID)
+	if !ok {
+		return problems
+	}
+
+	if highestRolePosition(client, selfMember) <= role.Position {
+		problems = append(problems, ProblemRoleHierarchy)
+	}
+
+	return problems
+}
+
+// Report diagnoses guildID and roleID like Diagnose and, if any problem is
+// found and the guild has not been notified within NotifyInterval, notifies
+// the guild's administrators. It returns the problems found.
+func (reporter *Reporter) Report(guildID, roleID snowflake.ID) []Problem {
+	problems := Diagnose(reporter.Client, guildID, roleID)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	log := reporter.Log.With("guildID", guildID, "problems", problemMessages(problems))
+
+	if !reporter.shouldNotify(guildID) {
+		log.Debug("guild configuration problem detected: notification rate-limited")
+		return problems
+	}
+
+	err := reporter.notify(guildID, problems)
+
+	reporter.sent(guildID, err == nil)
+
+	if err != nil {
+		log.Debug("unable to notify guild of configuration problem", "error", err)
+		return problems
+	}
+
+	log.Info("notified guild of configuration problem")
+
+	return problems
+}
+
+// Forget discards guildID's notification rate-limit state.
+func (reporter *Reporter) Forget(guildID snowflake.ID) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	delete(reporter.notified, guildID)
+}
+
+// shouldNotify reports whether guildID is due a notification and no other is
+// being sent and, if so, records that one is being sent. The caller must
+// report the outcome to sent.
+func (reporter *Reporter) shouldNotify(guildID snowflake.ID) bool {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	if reporter.sending[guildID] {
+		return false
+	}
+
+	if last, ok := reporter.notified[guildID]; ok && time.Since(last) < reporter.NotifyInterval {
+		return false
+	}
+
+	reporter.sending[guildID] = true
+
+	return true
+}
+
+// sent records the outcome of the notification of guildID. Only a successful
+// one starts the NotifyInterval, so a failed one, as when the owner's direct
+// messages are closed, is retried on the next problem.
+func (reporter *Reporter) sent(guildID snowflake.ID, ok bool) {
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+
+	delete(reporter.sending, guildID)
+
+	if ok {
+		reporter.notified[guildID] = time.Now()
+	}
+}
+
+func (reporter *Reporter) notify(guildID snowflake.ID, problems []Problem) error {
+	message := discord.MessageCreate{Content: reporter.message(guildID, problems)}
+
+	ctx, cancel := operations.RequestContext(context.Background())
+	defer cancel()
+
+	if reporter.NotifyChannel != nil {
+		if channelID, ok := reporter.NotifyChannel(guildID); ok {
+			_, err := reporter.Client.Rest.CreateMessage(channelID, message, rest.WithCtx(ctx))
+			if err != nil {
+				return fmt.Errorf("unable to post to notification channel: %w", err)
+			}
+
+			return nil
+		}
+	}
+
+	guild, err := operations.LookupGuild(ctx, reporter.Client, guildID)
+	if err != nil {
+		return err
+	}
+
+	dmChannel, err := reporter.Client.Rest.CreateDMChannel(guild.OwnerID, rest.WithCtx(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to open direct message with guild owner: %w", err)
+	}
+
+	if _, err := reporter.Client.Rest.CreateMessage(dmChannel.ID(), message, rest.WithCtx(ctx)); err != nil {
+		return fmt.Errorf("unable to direct message guild owner: %w", err)
+	}
+
+	return nil
+}
+
+func (reporter *Reporter) message(guildID snowflake.ID, problems []Problem) string {
+	guildName := guildID.String()
+	if guild, ok := reporter.Client.Caches.Guild(guildID); ok {
+		guildName = guild.Name
+	}
+
+	builder := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(builder, "%s is unable to manage ephemeral roles in **%s**:\n", reporter.BotName, guildName)
+
+	for _, problem := range problems {
+		_, _ = fmt.Fprintf(builder, "- %s\n", problem.Message())
+	}
+
+	builder.WriteString("\nTo fix this:\n")
+	builder.WriteString(FixInstructions(reporter.BotName, reporter.RolePrefix))
+
+	return builder.String()
+}
+
+// FixInstructions returns instructions for guild administrators on how to set
+// up the bot's role so it can manage ephemeral roles named with rolePrefix.
+func FixInstructions(botName, rolePrefix string) string {
+	return fmt.Sprintf(fixInstructions, botName, rolePrefix)
+}
+
+func highestRolePosition(client *bot.Client, member discord.Member) int {
+	position := 0
+
+	for _, role := range client.Caches.MemberRoles(member) {
+		position = max(position, role.Position)
+	}
+
+	return position
+}
+
+func problemMessages(problems []Problem) []string {
+	messages := make([]string, len(problems))
+
+	for i, problem := range problems {
+		messages[i] = problem.Message()
+	}
+
+	return messages
+}
@@ -0,0 +1,178 @@
+package diagnostics_test
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/diagnostics"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+const (
+	testBotName    = "testBot"
+	testRolePrefix = "{eph}"
+
+	botRoleID             snowflake.ID = 5000
+	notifyChannelID       snowflake.ID = 5001
+	botRolePosition                    = 10
+	ephemeralRolePosition              = 1
+)
+
+func TestProblem_Message(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, diagnostics.MissingManageRolesMessage, diagnostics.ProblemMissingManageRoles.Message())
+	assert.Equal(t, diagnostics.RoleHierarchyMessage, diagnostics.ProblemRoleHierarchy.Message())
+	assert.NotEmpty(t, diagnostics.Problem(-1).Message())
+}
+
+func TestDiagnose(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	// The mock bot member has neither Manage Roles nor a role positioned
+	// above the ephemeral role.
+	assert.Equal(t,
+		[]diagnostics.Problem{diagnostics.ProblemMissingManageRoles, diagnostics.ProblemRoleHierarchy},
+		diagnostics.Diagnose(session, mock.TestGuild, mock.TestEphemeralRole),
+	)
+
+	assert.Equal(t,
+		[]diagnostics.Problem{diagnostics.ProblemMissingManageRoles},
+		diagnostics.Diagnose(session, mock.TestGuild, 0),
+	)
+
+	grantBotRole(t, session, mock.TestGuild)
+
+	assert.Empty(t, diagnostics.Diagnose(session, mock.TestGuild, mock.TestEphemeralRole))
+	assert.Empty(t, diagnostics.Diagnose(session, snowflake.ID(999999), mock.TestEphemeralRole))
+}
+
+func TestReporter_Report(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	reporter := diagnostics.NewReporter(&diagnostics.Config{
+		Log:        mock.NewLogger(),
+		Client:     session,
+		BotName:    testBotName,
+		RolePrefix: testRolePrefix,
+	})
+
+	require.NotEmpty(t, reporter.Report(mock.TestGuild, mock.TestEphemeralRole))
+
+	// A second report within the notify interval is rate-limited.
+	require.NotEmpty(t, reporter.Report(mock.TestGuild, mock.TestEphemeralRole))
+
+	messages := mock.SentMessages(session)
+	require.Len(t, messages, 1)
+
+	content := messages[0].Message.Content
+	assert.Contains(t, content, testBotName)
+	assert.Contains(t, content, mock.TestGuildName)
+	assert.Contains(t, content, diagnostics.MissingManageRolesMessage)
+	assert.Contains(t, content, testRolePrefix)
+
+	// Forgetting the guild resets its rate limit.
+	reporter.Forget(mock.TestGuild)
+	reporter.Report(mock.TestGuild, mock.TestEphemeralRole)
+
+	require.Len(t, mock.SentMessages(session), 2)
+}
+
+func TestReporter_Report_notifyChannel(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	reporter := diagnostics.NewReporter(&diagnostics.Config{
+		Log:     mock.NewLogger(),
+		Client:  session,
+		BotName: testBotName,
+		NotifyChannel: func(snowflake.ID) (snowflake.ID, bool) {
+			return notifyChannelID, true
+		},
+	})
+
+	reporter.Report(mock.TestGuild, 0)
+
+	messages := mock.SentMessages(session)
+	require.Len(t, messages, 1)
+	assert.Equal(t, notifyChannelID, messages[0].ChannelID)
+}
+
+func TestReporter_Report_notifyFailure(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	// The guild owner doesn't accept direct messages.
+	guild, ok := session.Caches.Guild(mock.TestGuild)
+	require.True(t, ok)
+
+	mock.FailMessages(session, guild.OwnerID)
+
+	reporter := diagnostics.NewReporter(&diagnostics.Config{Log: mock.NewLogger(), Client: session})
+
+	reporter.Report(mock.TestGuild, 0)
+	require.Empty(t, mock.SentMessages(session))
+
+	// A failed notification doesn't rate-limit the next one.
+	reporter.NotifyChannel = func(snowflake.ID) (snowflake.ID, bool) {
+		return notifyChannelID, true
+	}
+
+	reporter.Report(mock.TestGuild, 0)
+	require.Len(t, mock.SentMessages(session), 1)
+}
+
+func TestReporter_Report_noProblems(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	grantBotRole(t, session, mock.TestGuild)
+
+	reporter := diagnostics.NewReporter(&diagnostics.Config{Log: mock.NewLogger(), Client: session})
+
+	assert.Empty(t, reporter.Report(mock.TestGuild, mock.TestEphemeralRole))
+	assert.Empty(t, mock.SentMessages(session))
+}
+
+// grantBotRole gives the mock bot member a Manage Roles role positioned above
+// the mock ephemeral role.
+func grantBotRole(t *testing.T, session *bot.Client, guildID snowflake.ID) {
+	t.Helper()
+
+	session.Caches.AddRole(discord.Role{
+		ID:          botRoleID,
+		GuildID:     guildID,
+		Name:        testBotName,
+		Position:    botRolePosition,
+		Permissions: discord.PermissionManageRoles,
+	})
+
+	ephemeralRole, ok := session.Caches.Role(guildID, mock.TestEphemeralRole)
+	require.True(t, ok)
+
+	ephemeralRole.Position = ephemeralRolePosition
+	session.Caches.AddRole(ephemeralRole)
+
+	selfMember, ok := session.Caches.SelfMember(guildID)
+	require.True(t, ok)
+
+	selfMember.RoleIDs = append(selfMember.RoleIDs, botRoleID)
+	session.Caches.AddMember(selfMember)
+}
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+// Admin API endpoints, served only when AdminConfig.Token is set.
+const (
+	AdminGuildsEndpoint    = "GET /admin/guilds"
+	AdminReconcileEndpoint = "POST /admin/guilds/{guildID}/reconcile"
+	AdminCleanupEndpoint   = "POST /admin/guilds/{guildID}/cleanup"
+)
+
+const bearerPrefix = "Bearer "
+
+// GuildAdministrator is an interface abstraction for the guild role
+// maintenance operations exposed by the admin API.
+type GuildAdministrator interface {
+	GuildRoleStats
+	Reconcile(client *bot.Client, guildID snowflake.ID) bool
+	Cleanup(client *bot.Client, guildID snowflake.ID) bool
+}
+
+// AdminConfig contains fields for configuring the admin API.
+type AdminConfig struct {
+	// Token is the bearer token every admin request must present. It also
+	// guards LogLevelEndpoint and VoiceHistoryEndpoint.
+	Token string
+
+	Guilds GuildAdministrator
+
+	// Audit is served on AdminAuditEndpoint. The endpoint is not registered
+	// when nil.
+	Audit *audit.Store
+
+	// Settings stores the audit log channels set on
+	// AdminAuditChannelEndpoint, and the notification channels set on
+	// AdminNotificationChannelEndpoint. The endpoints are not registered when
+	// nil.
+	Settings *settings.Store
+}
+
+// AdminGuild is a guild as listed by AdminGuildsEndpoint, with its ephemeral
+// role stats.
+type AdminGuild struct {
+	ID                   snowflake.ID `json:"id"`
+	Name                 string       `json:"name"`
+	MemberCount          int          `json:"memberCount"`
+	EphemeralRoles       int          `json:"ephemeralRoles"`
+	EphemeralRoleMembers int          `json:"ephemeralRoleMembers"`
+}
+
+// registerAdminHandlers registers the admin API on mux, behind bearer token
+// authentication.
+func registerAdminHandlers(mux *http.ServeMux, log *slog.Logger, client *bot.Client, config *AdminConfig) {
+	mux.Handle(AdminGuildsEndpoint, requireToken(config.Token, adminGuildsHandler(log, client, config.Guilds)))
+	mux.Handle(AdminReconcileEndpoint, requireToken(config.Token, adminGuildActionHandler(client, config.Guilds.Reconcile)))
+	mux.Handle(AdminCleanupEndpoint, requireToken(config.Token, adminGuildActionHandler(client, config.Guilds.Cleanup)))
+
+	registerAuditHandlers(mux, log, client, config)
+	registerNotificationHandlers(mux, log, client, config)
+}
+
+// requireToken rejects requests not presenting token as a bearer token. The
+// comparison is constant-time, so response timing doesn't leak the token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func adminGuildsHandler(log *slog.Logger, client *bot.Client, guilds GuildAdministrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		adminGuilds := make([]AdminGuild, 0, client.Caches.GuildsLen())
+
+		for guild := range client.Caches.Guilds() {
+			adminGuilds = append(adminGuilds, AdminGuild{
+				ID:          guild.ID,
+				Name:        guild.Name,
+				MemberCount: guild.MemberCount,
+			})
+		}
+
+		// Stats are gathered outside the Guilds range: they range over the
+		// member and role caches, and the guild cache lock is held for the
+		// duration of a range.
+		for i := range adminGuilds {
+			adminGuilds[i].EphemeralRoles, adminGuilds[i].EphemeralRoleMembers = guilds.RoleStats(client, adminGuilds[i].ID)
+		}
+
+		slices.SortFunc(adminGuilds, func(a, b AdminGuild) int {
+			return cmp.Compare(b.MemberCount, a.MemberCount)
+		})
+
+		adminGuildsJSON, err := json.MarshalIndent(adminGuilds, "", "    ")
+		if err != nil {
+			log.Error("Error marshaling admin guilds to JSON", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err = w.Write(adminGuildsJSON)
+		if err != nil {
+			log.Error("Error writing admin guilds response", "error", err)
+			return
+		}
+	}
+}
+
+// adminGuildActionHandler queues action for the guild named in the request
+// path. Actions run asynchronously on the guild's sequencer, so success is
+// reported as 202 Accepted.
+func adminGuildActionHandler(
+	client *bot.Client,
+	action func(client *bot.Client, guildID snowflake.ID) bool,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		guildID, err := snowflake.Parse(r.PathValue("guildID"))
+		if err != nil {
+			http.Error(w, "invalid guild ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := client.Caches.Guild(guildID); !ok {
+			http.Error(w, "guild not found", http.StatusNotFound)
+			return
+		}
+
+		if !action(client, guildID) {
+			http.Error(w, "guild queue full", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
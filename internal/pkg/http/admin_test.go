@@ -0,0 +1,149 @@
+package http_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+const testAdminToken = "testAdminToken"
+
+type fakeAdministrator struct {
+	mu         sync.Mutex
+	reconciled []snowflake.ID
+	cleaned    []snowflake.ID
+}
+
+func (*fakeAdministrator) RoleStats(*bot.Client, snowflake.ID) (roles, members int) {
+	return 1, 2
+}
+
+func (*fakeAdministrator) EphemeralRoles(*bot.Client, snowflake.ID) int {
+	return 1
+}
+
+func (admin *fakeAdministrator) Reconcile(_ *bot.Client, guildID snowflake.ID) bool {
+	admin.mu.Lock()
+	defer admin.mu.Unlock()
+
+	admin.reconciled = append(admin.reconciled, guildID)
+
+	return true
+}
+
+func (admin *fakeAdministrator) Cleanup(_ *bot.Client, guildID snowflake.ID) bool {
+	admin.mu.Lock()
+	defer admin.mu.Unlock()
+
+	admin.cleaned = append(admin.cleaned, guildID)
+
+	return true
+}
+
+func TestNewServer_admin(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	admin := &fakeAdministrator{}
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		Admin:  &internalHTTP.AdminConfig{Token: testAdminToken, Guilds: admin},
+	}).Handler)
+	defer testServer.Close()
+
+	guildPath := "/admin/guilds/" + mock.TestGuild.String()
+
+	testCases := []struct {
+		name, method, path, token, body string
+		status                          int
+	}{
+		{name: "no token", method: http.MethodGet, path: "/admin/guilds", status: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/admin/guilds", token: "wrong", status: http.StatusUnauthorized},
+		{name: "reconcile", method: http.MethodPost, path: guildPath + "/reconcile", token: testAdminToken, status: http.StatusAccepted},
+		{name: "cleanup", method: http.MethodPost, path: guildPath + "/cleanup", token: testAdminToken, status: http.StatusAccepted},
+		{name: "unknown guild", method: http.MethodPost, path: "/admin/guilds/1/cleanup", token: testAdminToken, status: http.StatusNotFound},
+		{name: "invalid guild", method: http.MethodPost, path: "/admin/guilds/x/cleanup", token: testAdminToken, status: http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		resp := doAdminRequest(t, testServer.URL, testCase.method, testCase.path, testCase.token, testCase.body)
+		drainCloseResponse(resp)
+
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+
+	admin.mu.Lock()
+	assert.Equal(t, []snowflake.ID{mock.TestGuild}, admin.reconciled)
+	assert.Equal(t, []snowflake.ID{mock.TestGuild}, admin.cleaned)
+	admin.mu.Unlock()
+
+	resp := doAdminRequest(t, testServer.URL, http.MethodGet, "/admin/guilds", testAdminToken, "")
+
+	defer func() { _ = resp.Body.Close() }()
+
+	adminGuilds := make([]internalHTTP.AdminGuild, 0)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&adminGuilds))
+
+	require.Len(t, adminGuilds, 2)
+	assert.Equal(t, mock.TestGuildLarge, adminGuilds[0].ID)
+	assert.Equal(t, 1, adminGuilds[0].EphemeralRoles)
+	assert.Equal(t, 2, adminGuilds[0].EphemeralRoleMembers)
+}
+
+func TestNewServer_adminDisabled(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		Admin:  &internalHTTP.AdminConfig{Guilds: &fakeAdministrator{}},
+	}).Handler)
+	defer testServer.Close()
+
+	resp := doAdminRequest(t, testServer.URL, http.MethodPost, "/admin/guilds/"+mock.TestGuild.String()+"/cleanup", "", "")
+	drainCloseResponse(resp)
+
+	// Without a token the admin API isn't registered at all, so the request
+	// falls through to the root handler.
+	assert.NotEqual(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func doAdminRequest(t *testing.T, serverURL, method, path, token, body string) *http.Response {
+	t.Helper()
+
+	var reqBody io.Reader = http.NoBody
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), method, serverURL+path, reqBody)
+	require.NoError(t, err)
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
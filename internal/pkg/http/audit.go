@@ -0,0 +1,265 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+// Audit admin API endpoints, served only when AdminConfig.Token is set.
+// AdminAuditEndpoint requires AdminConfig.Audit, and the audit log channel
+// and reasons endpoints require AdminConfig.Settings.
+const (
+	AdminAuditEndpoint             = "GET /admin/guilds/{guildID}/audit"
+	AdminAuditChannelEndpoint      = "PUT /admin/guilds/{guildID}/audit/channel"
+	AdminAuditChannelClearEndpoint = "DELETE /admin/guilds/{guildID}/audit/channel"
+	AdminAuditReasonsEndpoint      = "PUT /admin/guilds/{guildID}/audit/reasons"
+)
+
+const (
+	defaultAuditLimit = 100
+
+	maxChannelRequestBody      = 1 << 10
+	maxAuditReasonsRequestBody = 1 << 10
+)
+
+// AuditChannel is the request body of AdminAuditChannelEndpoint.
+type AuditChannel struct {
+	ChannelID snowflake.ID `json:"channelID"`
+}
+
+// AuditReasons is the request body of AdminAuditReasonsEndpoint. Locale is a
+// Discord locale, such as "de" or "es-ES"; when empty, reasons are given in
+// the guild's preferred locale.
+type AuditReasons struct {
+	Enabled bool           `json:"enabled"`
+	Locale  discord.Locale `json:"locale,omitempty"`
+}
+
+// registerAuditHandlers registers the audit admin API on mux, behind bearer
+// token authentication.
+func registerAuditHandlers(mux *http.ServeMux, log *slog.Logger, client *bot.Client, config *AdminConfig) {
+	if config.Audit != nil {
+		mux.Handle(AdminAuditEndpoint, requireToken(config.Token, auditHandler(log, config.Audit)))
+	}
+
+	if config.Settings != nil {
+		mux.Handle(AdminAuditChannelEndpoint, requireToken(config.Token, guildChannelHandler(log, client, config.Settings.SetAuditLogChannel, true)))
+		mux.Handle(AdminAuditChannelClearEndpoint, requireToken(config.Token, guildChannelHandler(log, client, config.Settings.SetAuditLogChannel, false)))
+		mux.Handle(AdminAuditReasonsEndpoint, requireToken(config.Token, auditReasonsHandler(log, config.Settings)))
+	}
+}
+
+// auditHandler serves the audit trail of the guild named in the request path,
+// most recent first, narrowed by the optional member, role, action, since
+// (RFC 3339), and limit query parameters.
+func auditHandler(log *slog.Logger, store *audit.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		guildID, err := snowflake.Parse(r.PathValue("guildID"))
+		if err != nil {
+			http.Error(w, "invalid guild ID", http.StatusBadRequest)
+			return
+		}
+
+		query, err := parseAuditQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query.GuildID = guildID
+
+		entries := store.Query(query)
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+
+		entriesJSON, err := json.MarshalIndent(entries, "", "    ")
+		if err != nil {
+			log.Error("Error marshaling audit entries to JSON", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err = w.Write(entriesJSON)
+		if err != nil {
+			log.Error("Error writing audit response", "error", err)
+			return
+		}
+	}
+}
+
+func parseAuditQuery(values url.Values) (audit.Query, error) {
+	query := audit.Query{Limit: defaultAuditLimit}
+
+	var err error
+
+	if member := values.Get("member"); member != "" {
+		if query.UserID, err = snowflake.Parse(member); err != nil {
+			return query, fmt.Errorf("invalid member: %w", err)
+		}
+	}
+
+	if role := values.Get("role"); role != "" {
+		if query.RoleID, err = snowflake.Parse(role); err != nil {
+			return query, fmt.Errorf("invalid role: %w", err)
+		}
+	}
+
+	switch action := audit.Action(values.Get("action")); action {
+	case "", audit.ActionCreateRole, audit.ActionAddRole, audit.ActionRemoveRole, audit.ActionDeleteRole:
+		query.Action = action
+	default:
+		return query, fmt.Errorf("invalid action: %q", action)
+	}
+
+	if since := values.Get("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return query, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("invalid limit: %q", value)
+		}
+	}
+
+	return query, nil
+}
+
+// guildChannelHandler sets a channel setting of the guild named in the
+// request path, with setChannel, to the one in the request body, an
+// AuditChannel or NotificationChannel, or clears it when set is false. The
+// channel must belong to the guild, so that a guild's role mutations or
+// notifications can't be posted to another guild.
+func guildChannelHandler(
+	log *slog.Logger,
+	client *bot.Client,
+	setChannel func(guildID snowflake.ID, channelID *snowflake.ID) error,
+	set bool,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		guildID, err := snowflake.Parse(r.PathValue("guildID"))
+		if err != nil {
+			http.Error(w, "invalid guild ID", http.StatusBadRequest)
+			return
+		}
+
+		if !set {
+			saveSettings(w, log, setChannel(guildID, nil))
+			return
+		}
+
+		guildChannel := AuditChannel{}
+
+		err = json.NewDecoder(io.LimitReader(r.Body, maxChannelRequestBody)).Decode(&guildChannel)
+		if err != nil || guildChannel.ChannelID == 0 {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		channelGuildID, err := guildOfChannel(r.Context(), client, guildChannel.ChannelID)
+		if err != nil {
+			http.Error(w, "unknown channel", http.StatusBadRequest)
+			return
+		}
+
+		if channelGuildID != guildID {
+			http.Error(w, "channel not in guild", http.StatusBadRequest)
+			return
+		}
+
+		saveSettings(w, log, setChannel(guildID, &guildChannel.ChannelID))
+	}
+}
+
+// auditReasonsHandler enables or disables the audit log reasons of the guild
+// named in the request path, and sets their locale, from the request body.
+func auditReasonsHandler(log *slog.Logger, store *settings.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		guildID, err := snowflake.Parse(r.PathValue("guildID"))
+		if err != nil {
+			http.Error(w, "invalid guild ID", http.StatusBadRequest)
+			return
+		}
+
+		auditReasons := AuditReasons{}
+
+		err = json.NewDecoder(io.LimitReader(r.Body, maxAuditReasonsRequestBody)).Decode(&auditReasons)
+		if err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := discord.Locales[auditReasons.Locale]; auditReasons.Locale != "" && !ok {
+			http.Error(w, fmt.Sprintf("invalid locale: %q", auditReasons.Locale), http.StatusBadRequest)
+			return
+		}
+
+		saveSettings(w, log, store.SetAuditLogReasons(guildID, auditReasons.Enabled, auditReasons.Locale))
+	}
+}
+
+// guildOfChannel returns the guild channelID belongs to, from the cache or
+// else Discord, for channels of guilds on other shards.
+func guildOfChannel(ctx context.Context, client *bot.Client, channelID snowflake.ID) (snowflake.ID, error) {
+	if channel, ok := client.Caches.Channel(channelID); ok {
+		return channel.GuildID(), nil
+	}
+
+	channel, err := client.Rest.GetChannel(channelID, rest.WithCtx(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("unable to get channel: %w", err)
+	}
+
+	guildChannel, ok := channel.(discord.GuildChannel)
+	if !ok {
+		return 0, nil
+	}
+
+	return guildChannel.GuildID(), nil
+}
+
+// saveSettings responds to a settings change, which failed to be saved if err
+// is not nil: the change is still applied, but won't survive a restart.
+func saveSettings(w http.ResponseWriter, log *slog.Logger, err error) {
+	if err != nil {
+		log.Error("Error saving settings", "error", err)
+		http.Error(w, "unable to save settings", http.StatusInternalServerError)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
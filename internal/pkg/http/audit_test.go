@@ -0,0 +1,162 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/audit"
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+func TestNewServer_audit(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	store := audit.NewStore(&audit.Config{})
+	now := time.Now()
+
+	for _, entry := range []audit.Entry{
+		{Time: now.Add(-2 * time.Minute), GuildID: mock.TestGuild, Action: audit.ActionAddRole, UserID: mock.TestUser},
+		{Time: now.Add(-time.Minute), GuildID: mock.TestGuild, Action: audit.ActionRemoveRole, UserID: mock.TestUser},
+		{Time: now, GuildID: mock.TestGuild, Action: audit.ActionDeleteRole},
+	} {
+		require.NoError(t, store.Record(entry))
+	}
+
+	settingsStore := settings.NewStore()
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		Admin: &internalHTTP.AdminConfig{
+			Token:    testAdminToken,
+			Guilds:   &fakeAdministrator{},
+			Audit:    store,
+			Settings: settingsStore,
+		},
+	}).Handler)
+	defer testServer.Close()
+
+	auditPath := "/admin/guilds/" + mock.TestGuild.String() + "/audit"
+
+	testCases := []struct {
+		name, query string
+		status      int
+		actions     []audit.Action
+	}{
+		{
+			name:    "all",
+			status:  http.StatusOK,
+			actions: []audit.Action{audit.ActionDeleteRole, audit.ActionRemoveRole, audit.ActionAddRole},
+		},
+		{
+			name:    "member",
+			query:   "?member=" + mock.TestUser.String(),
+			status:  http.StatusOK,
+			actions: []audit.Action{audit.ActionRemoveRole, audit.ActionAddRole},
+		},
+		{
+			name:    "action and limit",
+			query:   "?action=addRole&limit=1",
+			status:  http.StatusOK,
+			actions: []audit.Action{audit.ActionAddRole},
+		},
+		{
+			name:    "since",
+			query:   "?since=" + now.Add(-90*time.Second).Format(time.RFC3339),
+			status:  http.StatusOK,
+			actions: []audit.Action{audit.ActionDeleteRole, audit.ActionRemoveRole},
+		},
+		{name: "invalid action", query: "?action=x", status: http.StatusBadRequest},
+		{name: "invalid since", query: "?since=x", status: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=0", status: http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		resp := doAdminRequest(t, testServer.URL, http.MethodGet, auditPath+testCase.query, testAdminToken, "")
+
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+
+		if testCase.status == http.StatusOK {
+			entries := make([]audit.Entry, 0)
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&entries), testCase.name)
+
+			actions := make([]audit.Action, 0, len(entries))
+			for _, entry := range entries {
+				actions = append(actions, entry.Action)
+			}
+
+			assert.Equal(t, testCase.actions, actions, testCase.name)
+		}
+
+		drainCloseResponse(resp)
+	}
+
+	// The mock guilds share channel IDs, which end up cached as channels of
+	// TestGuildLarge, added last.
+	channelPath := "/admin/guilds/" + mock.TestGuildLarge.String() + "/audit/channel"
+
+	for _, testCase := range []struct {
+		name, path, body string
+	}{
+		{name: "no channel", path: channelPath, body: `{}`},
+		{name: "unknown channel", path: channelPath, body: `{"channelID":"1"}`},
+		{name: "channel of another guild", path: auditPath + "/channel", body: `{"channelID":"` + mock.TestChannel.String() + `"}`},
+	} {
+		resp := doAdminRequest(t, testServer.URL, http.MethodPut, testCase.path, testAdminToken, testCase.body)
+		drainCloseResponse(resp)
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, testCase.name)
+	}
+
+	_, ok := settingsStore.AuditLogChannel(mock.TestGuild)
+	require.False(t, ok, "channel of another guild set")
+
+	resp := doAdminRequest(t, testServer.URL, http.MethodPut, channelPath, testAdminToken, `{"channelID":"`+mock.TestChannel.String()+`"}`)
+	drainCloseResponse(resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	channelID, ok := settingsStore.AuditLogChannel(mock.TestGuildLarge)
+	require.True(t, ok)
+	assert.Equal(t, mock.TestChannel, channelID)
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodDelete, channelPath, testAdminToken, "")
+	drainCloseResponse(resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, ok = settingsStore.AuditLogChannel(mock.TestGuildLarge)
+	assert.False(t, ok)
+
+	reasonsPath := auditPath + "/reasons"
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodPut, reasonsPath, testAdminToken, `{"enabled":true,"locale":"de"}`)
+	drainCloseResponse(resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	enabled, locale := settingsStore.AuditLogReasons(mock.TestGuild)
+	assert.True(t, enabled)
+	assert.Equal(t, discord.LocaleGerman, locale)
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodPut, reasonsPath, testAdminToken, `{"enabled":true,"locale":"xx"}`)
+	drainCloseResponse(resp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodPut, reasonsPath, testAdminToken, `{"enabled":false}`)
+	drainCloseResponse(resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	enabled, locale = settingsStore.AuditLogReasons(mock.TestGuild)
+	assert.False(t, enabled)
+	assert.Empty(t, locale)
+}
@@ -0,0 +1,381 @@
+package http
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Media types served by GuildsEndpoint, chosen by the request's Accept header.
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeCSV  = "text/csv"
+)
+
+// Sort keys accepted by the sort query parameter of GuildsEndpoint.
+const (
+	GuildsSortMembers        = "members"
+	GuildsSortName           = "name"
+	GuildsSortID             = "id"
+	GuildsSortEphemeralRoles = "ephemeralRoles"
+	GuildsSortVoiceMembers   = "voiceMembers"
+)
+
+// GuildsTotalCountHeader is the response header of GuildsEndpoint carrying
+// the number of guilds matching the filters, before pagination.
+const GuildsTotalCountHeader = "X-Total-Count"
+
+// guildsCSVHeader is the header row of the CSV served by GuildsEndpoint.
+var guildsCSVHeader = []string{"id", "name", "memberCount", "ephemeralRoles", "voiceMembers"}
+
+// csvFormulaPrefixes are the leading characters spreadsheet applications
+// evaluate a CSV cell starting with as a formula.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// GuildRoleStats is an interface abstraction for counting a guild's
+// ephemeral roles and the members holding them.
+type GuildRoleStats interface {
+	RoleStats(client *bot.Client, guildID snowflake.ID) (roles, members int)
+}
+
+// GuildEphemeralRoles is an interface abstraction for counting a guild's
+// ephemeral roles, cheaper than GuildRoleStats as it doesn't walk the member
+// cache.
+type GuildEphemeralRoles interface {
+	EphemeralRoles(client *bot.Client, guildID snowflake.ID) int
+}
+
+// SortableGuild is a representation of a guild as listed by GuildsEndpoint.
+type SortableGuild struct {
+	ID             snowflake.ID `json:"id"`
+	Name           string       `json:"name"`
+	MemberCount    int          `json:"memberCount"`
+	EphemeralRoles int          `json:"ephemeralRoles"`
+	VoiceMembers   int          `json:"voiceMembers"`
+}
+
+// SortableGuilds is a slice of SortableGuild structs.
+type SortableGuilds []SortableGuild
+
+// guildsQuery is the query parameters of GuildsEndpoint.
+type guildsQuery struct {
+	sort       string
+	ascending  bool
+	name       string
+	minMembers int
+	offset     int
+	limit      int
+}
+
+// GuildsHandler serves the guilds returned by guilds for each request, largest
+// first, as JSON or, if the request's Accept header prefers it, CSV. When set,
+// stats fills in the ephemeral role and voice member counts of the guilds it
+// is given, which guilds leaves out: it is only called for the page served,
+// unless sorting by one of the counts. The optional query parameters are:
+//
+//   - name: only guilds whose name contains it, ignoring case
+//   - minMembers: only guilds with at least that many members
+//   - sort: one of the GuildsSort keys, members by default
+//   - order: asc or desc, desc by default
+//   - offset and limit: the page of matching guilds to list, all by default
+//
+// The number of matching guilds is reported in GuildsTotalCountHeader.
+func GuildsHandler(log *slog.Logger, guilds func() SortableGuilds, stats func(SortableGuilds)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		// The response depends on the Accept header, which caches must key
+		// it by.
+		w.Header().Add("Vary", "Accept")
+
+		mediaType, ok := negotiateGuildsMediaType(r.Header.Get("Accept"))
+		if !ok {
+			http.Error(w, "supported media types: "+mediaTypeJSON+", "+mediaTypeCSV, http.StatusNotAcceptable)
+			return
+		}
+
+		query, err := parseGuildsQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		selected := filterGuilds(guilds(), query)
+
+		w.Header().Set(GuildsTotalCountHeader, strconv.Itoa(len(selected)))
+
+		sortsByStat := query.sort == GuildsSortEphemeralRoles || query.sort == GuildsSortVoiceMembers
+		if stats != nil && sortsByStat {
+			stats(selected)
+		}
+
+		sortGuilds(selected, query)
+
+		selected = selected[min(query.offset, len(selected)):]
+		if query.limit > 0 {
+			selected = selected[:min(query.limit, len(selected))]
+		}
+
+		if stats != nil && !sortsByStat {
+			stats(selected)
+		}
+
+		if mediaType == mediaTypeCSV {
+			w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+
+			if err := writeGuildsCSV(w, selected); err != nil {
+				log.Error("Error writing guilds CSV response", "error", err)
+			}
+
+			return
+		}
+
+		guildsJSON, err := json.MarshalIndent(selected, "", "    ")
+		if err != nil {
+			log.Error("Error marshaling sorted guilds to JSON", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", mediaTypeJSON)
+
+		_, err = w.Write(guildsJSON)
+		if err != nil {
+			log.Error("Error writing sorted guilds response", "error", err)
+			return
+		}
+	}
+}
+
+// cachedGuilds returns the guilds in the client's cache, without their stats.
+func cachedGuilds(client *bot.Client) SortableGuilds {
+	guilds := make(SortableGuilds, 0, client.Caches.GuildsLen())
+
+	for guild := range client.Caches.Guilds() {
+		guilds = append(guilds, SortableGuild{
+			ID:          guild.ID,
+			Name:        guild.Name,
+			MemberCount: guild.MemberCount,
+		})
+	}
+
+	return guilds
+}
+
+// cachedGuildStats fills in the stats of guilds from the client's cache, with
+// their ephemeral role counts from ephemeralRoles, if any.
+//
+// It must not be called while ranging over the guild cache: the stats range
+// over the role and voice state caches, and the guild cache lock is held for
+// the duration of a range.
+func cachedGuildStats(client *bot.Client, ephemeralRoles GuildEphemeralRoles, guilds SortableGuilds) {
+	for i := range guilds {
+		if ephemeralRoles != nil {
+			guilds[i].EphemeralRoles = ephemeralRoles.EphemeralRoles(client, guilds[i].ID)
+		}
+
+		for voiceState := range client.Caches.VoiceStates(guilds[i].ID) {
+			if voiceState.ChannelID != nil {
+				guilds[i].VoiceMembers++
+			}
+		}
+	}
+}
+
+// filterGuilds returns the guilds matching query's filters.
+func filterGuilds(guilds SortableGuilds, query guildsQuery) SortableGuilds {
+	name := strings.ToLower(query.name)
+
+	return slices.DeleteFunc(slices.Clone(guilds), func(guild SortableGuild) bool {
+		return guild.MemberCount < query.minMembers || !strings.Contains(strings.ToLower(guild.Name), name)
+	})
+}
+
+// sortGuilds sorts guilds as query requests.
+func sortGuilds(guilds SortableGuilds, query guildsQuery) {
+	slices.SortStableFunc(guilds, func(a, b SortableGuild) int {
+		// Ties are broken by ID, so pages are stable.
+		order := cmp.Or(compareGuilds(query.sort, a, b), cmp.Compare(a.ID, b.ID))
+		if !query.ascending {
+			return -order
+		}
+
+		return order
+	})
+}
+
+// compareGuilds compares a and b by key, ascending.
+func compareGuilds(key string, a, b SortableGuild) int {
+	switch key {
+	case GuildsSortName:
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case GuildsSortID:
+		return cmp.Compare(a.ID, b.ID)
+	case GuildsSortEphemeralRoles:
+		return cmp.Compare(a.EphemeralRoles, b.EphemeralRoles)
+	case GuildsSortVoiceMembers:
+		return cmp.Compare(a.VoiceMembers, b.VoiceMembers)
+	default:
+		return cmp.Compare(a.MemberCount, b.MemberCount)
+	}
+}
+
+func parseGuildsQuery(values url.Values) (guildsQuery, error) {
+	query := guildsQuery{
+		sort: cmp.Or(values.Get("sort"), GuildsSortMembers),
+		name: values.Get("name"),
+	}
+
+	switch query.sort {
+	case GuildsSortMembers, GuildsSortName, GuildsSortID, GuildsSortEphemeralRoles, GuildsSortVoiceMembers:
+	default:
+		return query, fmt.Errorf("invalid sort: %q", query.sort)
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		query.ascending = true
+	default:
+		return query, fmt.Errorf("invalid order: %q", order)
+	}
+
+	for param, value := range map[string]*int{
+		"minMembers": &query.minMembers,
+		"offset":     &query.offset,
+		"limit":      &query.limit,
+	} {
+		raw := values.Get(param)
+		if raw == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			return query, fmt.Errorf("invalid %s: %q", param, raw)
+		}
+
+		*value = parsed
+	}
+
+	return query, nil
+}
+
+// negotiateGuildsMediaType returns the media type to serve for the Accept
+// header accept: the supported one with the highest quality, JSON on ties or
+// when accept is empty. A media type's quality is that of the most specific
+// range matching it, so "text/csv;q=0, */*" refuses CSV. It reports false if
+// accept accepts neither.
+func negotiateGuildsMediaType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return mediaTypeJSON, true
+	}
+
+	quality := map[string]float64{mediaTypeJSON: -1, mediaTypeCSV: -1}
+	specificity := map[string]int{mediaTypeJSON: -1, mediaTypeCSV: -1}
+
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		for supported := range quality {
+			matched := mediaRangeSpecificity(mediaType, supported)
+
+			switch {
+			case matched < 0 || matched < specificity[supported]:
+			case matched > specificity[supported]:
+				specificity[supported] = matched
+				quality[supported] = q
+			default:
+				quality[supported] = max(quality[supported], q)
+			}
+		}
+	}
+
+	switch {
+	case quality[mediaTypeCSV] > 0 && quality[mediaTypeCSV] > quality[mediaTypeJSON]:
+		return mediaTypeCSV, true
+	case quality[mediaTypeJSON] > 0:
+		return mediaTypeJSON, true
+	default:
+		return "", false
+	}
+}
+
+// mediaRangeSpecificity returns how specifically the media range in an Accept
+// header matches mediaType: 2 for the media type itself, 1 for its type's
+// subtypes, such as "text/*", 0 for "*/*", and -1 if it doesn't match.
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	}
+
+	rangeType, ok := strings.CutSuffix(mediaRange, "/*")
+	if ok && strings.HasPrefix(mediaType, rangeType+"/") {
+		return 1
+	}
+
+	return -1
+}
+
+func writeGuildsCSV(w io.Writer, guilds SortableGuilds) error {
+	csvWriter := csv.NewWriter(w)
+
+	if err := csvWriter.Write(guildsCSVHeader); err != nil {
+		return err
+	}
+
+	for _, guild := range guilds {
+		err := csvWriter.Write([]string{
+			guild.ID.String(),
+			csvSafe(guild.Name),
+			strconv.Itoa(guild.MemberCount),
+			strconv.Itoa(guild.EphemeralRoles),
+			strconv.Itoa(guild.VoiceMembers),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+// csvSafe returns cell prefixed with a single quote if it starts like a
+// formula, so guild names can't inject formulas into spreadsheets opening the
+// CSV.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
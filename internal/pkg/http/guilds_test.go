@@ -0,0 +1,205 @@
+package http_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+func TestNewServer_guilds(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	session.Caches.AddGuild(discord.Guild{ID: snowflake.ID(3002), Name: "testGuild2", MemberCount: 3})
+	session.Caches.AddGuild(discord.Guild{ID: snowflake.ID(3003), Name: "testGuild3", MemberCount: 4})
+	session.Caches.AddVoiceState(discord.VoiceState{GuildID: 3002, UserID: 1, ChannelID: new(snowflake.ID(1))})
+	session.Caches.AddVoiceState(discord.VoiceState{GuildID: 3002, UserID: 2, ChannelID: new(snowflake.ID(1))})
+	session.Caches.AddVoiceState(discord.VoiceState{GuildID: 3002, UserID: 3})
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:            mock.NewLogger(),
+		Client:         session,
+		EphemeralRoles: &fakeAdministrator{},
+	}).Handler)
+	defer testServer.Close()
+
+	testCases := []struct {
+		name          string
+		query         string
+		expectedIDs   []snowflake.ID
+		expectedTotal string
+	}{
+		{name: "default", query: "", expectedIDs: []snowflake.ID{2000, 3003, 3002, 1000}, expectedTotal: "4"},
+		{name: "name", query: "?name=GUILD3", expectedIDs: []snowflake.ID{3003}, expectedTotal: "1"},
+		{name: "min members", query: "?minMembers=3", expectedIDs: []snowflake.ID{2000, 3003, 3002}, expectedTotal: "3"},
+		{name: "sort by name", query: "?sort=name&order=asc", expectedIDs: []snowflake.ID{1000, 3002, 3003, 2000}, expectedTotal: "4"},
+		{name: "sort by voice members", query: "?sort=voiceMembers&limit=1", expectedIDs: []snowflake.ID{3002}, expectedTotal: "4"},
+		{name: "page", query: "?offset=1&limit=2", expectedIDs: []snowflake.ID{3003, 3002}, expectedTotal: "4"},
+		{name: "past the end", query: "?offset=10", expectedIDs: []snowflake.ID{}, expectedTotal: "4"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.GuildsEndpoint+testCase.query)
+			require.NoError(t, err)
+
+			defer drainCloseResponse(resp)
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, testCase.expectedTotal, resp.Header.Get(internalHTTP.GuildsTotalCountHeader))
+
+			guilds := make(internalHTTP.SortableGuilds, 0)
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&guilds))
+
+			actualIDs := make([]snowflake.ID, 0, len(guilds))
+			for _, guild := range guilds {
+				actualIDs = append(actualIDs, guild.ID)
+			}
+
+			assert.Equal(t, testCase.expectedIDs, actualIDs)
+
+			for _, guild := range guilds {
+				assert.Equal(t, 1, guild.EphemeralRoles)
+			}
+		})
+	}
+
+	for _, query := range []string{"?sort=size", "?order=up", "?limit=-1", "?offset=x", "?minMembers=1.5"} {
+		resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.GuildsEndpoint+query)
+		require.NoError(t, err)
+
+		drainCloseResponse(resp)
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+// countingEphemeralRoles counts the guilds whose ephemeral roles are counted.
+type countingEphemeralRoles struct {
+	calls atomic.Int64
+}
+
+func (counter *countingEphemeralRoles) EphemeralRoles(*bot.Client, snowflake.ID) int {
+	counter.calls.Add(1)
+	return 1
+}
+
+func TestNewServer_guildsStatsPaged(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	ephemeralRoles := &countingEphemeralRoles{}
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:            mock.NewLogger(),
+		Client:         session,
+		EphemeralRoles: ephemeralRoles,
+	}).Handler)
+	defer testServer.Close()
+
+	testCases := []struct {
+		query         string
+		expectedCalls int64
+	}{
+		{query: "?limit=1", expectedCalls: 1},
+		{query: "?name=large", expectedCalls: 1},
+		{query: "?offset=5", expectedCalls: 0},
+		{query: "?sort=ephemeralRoles&limit=1", expectedCalls: 2},
+	}
+
+	for _, testCase := range testCases {
+		ephemeralRoles.calls.Store(0)
+
+		resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.GuildsEndpoint+testCase.query)
+		require.NoError(t, err)
+
+		drainCloseResponse(resp)
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, testCase.expectedCalls, ephemeralRoles.calls.Load(), testCase.query)
+	}
+}
+
+func TestNewServer_guildsCSV(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	session.Caches.AddVoiceState(discord.VoiceState{GuildID: mock.TestGuild, UserID: mock.TestUser, ChannelID: new(mock.TestChannel)})
+	session.Caches.AddGuild(discord.Guild{ID: snowflake.ID(3004), Name: "=HYPERLINK(\"https://example.com\")", MemberCount: 1})
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+	}).Handler)
+	defer testServer.Close()
+
+	testCases := []struct {
+		accept   string
+		expected string
+	}{
+		{accept: "text/csv", expected: "text/csv; charset=utf-8"},
+		{accept: "application/json;q=0.5, text/*", expected: "text/csv; charset=utf-8"},
+		{accept: "text/csv;q=0.5, */*", expected: "application/json"},
+		{accept: "text/csv;q=0, application/json", expected: "application/json"},
+		{accept: "text/csv;q=0, */*", expected: "application/json"},
+		{accept: "*/*;q=0.1, text/csv", expected: "text/csv; charset=utf-8"},
+	}
+
+	for _, testCase := range testCases {
+		resp := doGuildsRequest(t, testServer, testCase.accept)
+		drainCloseResponse(resp)
+
+		assert.Equal(t, testCase.expected, resp.Header.Get("Content-Type"), testCase.accept)
+		assert.Equal(t, "Accept", resp.Header.Get("Vary"), testCase.accept)
+	}
+
+	resp := doGuildsRequest(t, testServer, "text/html")
+	drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	resp = doGuildsRequest(t, testServer, "text/csv")
+	defer drainCloseResponse(resp)
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		{"id", "name", "memberCount", "ephemeralRoles", "voiceMembers"},
+		{"2000", "testGuildLarge", "3002", "0", "0"},
+		{mock.TestGuild.String(), "testGuild", "2", "0", "1"},
+		{"3004", "'=HYPERLINK(\"https://example.com\")", "1", "0", "0"},
+	}, records)
+}
+
+func doGuildsRequest(t *testing.T, testServer *httptest.Server, accept string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, testServer.URL+internalHTTP.GuildsEndpoint, http.NoBody)
+	require.NoError(t, err)
+
+	req.Header.Set("Accept", accept)
+
+	resp, err := testServer.Client().Do(req)
+	require.NoError(t, err)
+
+	return resp
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/shards"
+)
+
+// Identify lock API endpoints, served only when IdentifyLockConfig.Token is
+// set. A holder takes or renews the lease on a max_concurrency bucket with
+// IdentifyLockEndpoint, answered 204 No Content if it has the lease and 409
+// Conflict if another holder does, and gives it up with
+// IdentifyUnlockEndpoint.
+const (
+	IdentifyLockEndpoint   = "PUT /identify/{bucket}"
+	IdentifyUnlockEndpoint = "DELETE /identify/{bucket}"
+)
+
+// IdentifyHolderParam is the query parameter naming the holder of a lease on
+// the identify lock API.
+const IdentifyHolderParam = "holder"
+
+// IdentifyLockConfig contains fields for configuring the identify lock API.
+type IdentifyLockConfig struct {
+	// Token is the bearer token every identify lock request must present.
+	Token string
+
+	Leases *shards.Leases
+}
+
+// registerIdentifyLockHandlers registers the identify lock API on mux, behind
+// bearer token authentication.
+func registerIdentifyLockHandlers(mux *http.ServeMux, config *IdentifyLockConfig) {
+	mux.Handle(IdentifyLockEndpoint, requireToken(config.Token, identifyLeaseHandler(config.Leases, true)))
+	mux.Handle(IdentifyUnlockEndpoint, requireToken(config.Token, identifyLeaseHandler(config.Leases, false)))
+}
+
+// identifyLeaseHandler takes the lease on the bucket named in the request path
+// for the holder named in the query, or gives it up when acquire is false.
+func identifyLeaseHandler(leases *shards.Leases, acquire bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+
+		bucket, err := strconv.Atoi(r.PathValue("bucket"))
+		if err != nil || bucket < 0 {
+			http.Error(w, "invalid bucket", http.StatusBadRequest)
+			return
+		}
+
+		holder := r.URL.Query().Get(IdentifyHolderParam)
+		if holder == "" {
+			http.Error(w, "missing holder", http.StatusBadRequest)
+			return
+		}
+
+		if !acquire {
+			leases.Release(bucket, holder)
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		if !leases.TryAcquire(bucket, holder) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewIdentifyLock returns a shards.IdentifyLock on the leases served by the
+// identify lock API at baseURL, authenticating with token. Requests that fail,
+// as while the serving process is starting, are retried until the lease is
+// taken.
+func NewIdentifyLock(client *http.Client, baseURL, token string) shards.IdentifyLock {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	do := func(ctx context.Context, method string, bucket int, holder string) (int, error) {
+		leaseURL := fmt.Sprintf("%s/identify/%d?%s=%s", baseURL, bucket, IdentifyHolderParam, url.QueryEscape(holder))
+
+		req, err := http.NewRequestWithContext(ctx, method, leaseURL, http.NoBody)
+		if err != nil {
+			return 0, fmt.Errorf("unable to create identify lock request: %w", err)
+		}
+
+		req.Header.Set("Authorization", bearerPrefix+token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("unable to make identify lock request: %w", err)
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		return resp.StatusCode, nil
+	}
+
+	return shards.NewLeaseLock(
+		func(ctx context.Context, bucket int, holder string) (bool, error) {
+			status, err := do(ctx, http.MethodPut, bucket, holder)
+
+			switch {
+			case err != nil:
+				return false, err
+			case status == http.StatusNoContent:
+				return true, nil
+			case status == http.StatusConflict:
+				return false, nil
+			default:
+				return false, fmt.Errorf("unexpected identify lock response: %d", status)
+			}
+		},
+		func(ctx context.Context, bucket int, holder string) error {
+			status, err := do(ctx, http.MethodDelete, bucket, holder)
+			if err != nil {
+				return err
+			}
+
+			if status != http.StatusNoContent {
+				return fmt.Errorf("unexpected identify unlock response: %d", status)
+			}
+
+			return nil
+		},
+	)
+}
@@ -0,0 +1,61 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/shards"
+)
+
+const testIdentifyLockToken = "identify-token"
+
+func TestNewIdentifyLock(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		IdentifyLock: &internalHTTP.IdentifyLockConfig{
+			Token:  testIdentifyLockToken,
+			Leases: shards.NewLeases(0),
+		},
+	}).Handler)
+	defer testServer.Close()
+
+	lock := internalHTTP.NewIdentifyLock(testServer.Client(), testServer.URL+"/", testIdentifyLockToken)
+	other := internalHTTP.NewIdentifyLock(testServer.Client(), testServer.URL, testIdentifyLockToken)
+
+	require.NoError(t, lock.Acquire(t.Context(), 0))
+	require.NoError(t, other.Acquire(t.Context(), 1))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, other.Acquire(ctx, 0), context.DeadlineExceeded)
+
+	require.NoError(t, lock.Release(t.Context(), 0))
+	require.NoError(t, other.Acquire(t.Context(), 0))
+	require.NoError(t, other.Release(t.Context(), 0))
+
+	unauthorized := internalHTTP.NewIdentifyLock(testServer.Client(), testServer.URL, "wrong")
+
+	ctx, cancel = context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, unauthorized.Acquire(ctx, 2), context.DeadlineExceeded)
+
+	resp := doAdminRequest(t, testServer.URL, http.MethodPut, "/identify/0", testIdentifyLockToken, "")
+	drainCloseResponse(resp)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "missing holder")
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"crypto/subtle"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Endpoints of the internal server.
+const (
+	MetricsEndpoint = "/metrics"
+	PprofEndpoint   = "/debug/pprof/"
+
+	pprofCmdlineEndpoint = "/debug/pprof/cmdline"
+	pprofProfileEndpoint = "/debug/pprof/profile"
+	pprofSymbolEndpoint  = "/debug/pprof/symbol"
+	pprofTraceEndpoint   = "/debug/pprof/trace"
+)
+
+const internalRealm = `Basic realm="internal"`
+
+// InternalServerConfig contains fields for configuring the server returned by
+// NewInternalServer.
+type InternalServerConfig struct {
+	Log *slog.Logger
+
+	// Addr is the address to listen on, such as "127.0.0.1:8082" to serve
+	// only on loopback.
+	Addr string
+
+	// Profiling registers the pprof endpoints. Profiles expose memory
+	// contents, such as tokens, and the profile and trace endpoints are
+	// costly, so production deployments may want them off.
+	Profiling bool
+
+	// Username and Password, when both set, are the basic auth credentials
+	// every request must present.
+	Username string
+	Password string
+}
+
+// NewInternalServer returns a new pre-configured *http.Server for operators
+// and monitoring rather than the public: it serves MetricsEndpoint and, if
+// enabled, the pprof endpoints under PprofEndpoint.
+func NewInternalServer(config *InternalServerConfig) *http.Server {
+	mux := http.NewServeMux()
+
+	mux.Handle(MetricsEndpoint, promhttp.Handler())
+
+	if config.Profiling {
+		mux.HandleFunc(PprofEndpoint, pprof.Index)
+		mux.HandleFunc(pprofCmdlineEndpoint, pprof.Cmdline)
+		mux.HandleFunc(pprofProfileEndpoint, pprof.Profile)
+		mux.HandleFunc(pprofSymbolEndpoint, pprof.Symbol)
+		mux.HandleFunc(pprofTraceEndpoint, pprof.Trace)
+	}
+
+	var handler http.Handler = mux
+
+	if config.Username != "" && config.Password != "" {
+		handler = requireBasicAuth(config.Username, config.Password, mux)
+	}
+
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(config.Log.Handler(), slog.LevelError),
+	}
+}
+
+// requireBasicAuth rejects requests not presenting username and password as
+// basic auth credentials. Like requireToken, the comparisons are
+// constant-time.
+func requireBasicAuth(username, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presentedUsername, presentedPassword, ok := r.BasicAuth()
+
+		// Both are compared whatever the outcome of the first, so timing
+		// doesn't reveal which one is wrong.
+		usernameMatch := subtle.ConstantTimeCompare([]byte(presentedUsername), []byte(username))
+		passwordMatch := subtle.ConstantTimeCompare([]byte(presentedPassword), []byte(password))
+
+		if !ok || usernameMatch&passwordMatch != 1 {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+
+			w.Header().Set("WWW-Authenticate", internalRealm)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
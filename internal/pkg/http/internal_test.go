@@ -0,0 +1,117 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+const (
+	testInternalUsername = "testUsername"
+	testInternalPassword = "testPassword"
+)
+
+func TestNewInternalServer(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		profiling bool
+		endpoint  string
+		expected  int
+	}{
+		{name: "metrics", endpoint: internalHTTP.MetricsEndpoint, expected: http.StatusOK},
+		{name: "profiling", profiling: true, endpoint: internalHTTP.PprofEndpoint, expected: http.StatusOK},
+		{name: "profiling disabled", endpoint: internalHTTP.PprofEndpoint, expected: http.StatusNotFound},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			testServer := httptest.NewServer(internalHTTP.NewInternalServer(&internalHTTP.InternalServerConfig{
+				Log:       mock.NewLogger(),
+				Profiling: testCase.profiling,
+			}).Handler)
+			defer testServer.Close()
+
+			resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+testCase.endpoint)
+			require.NoError(t, err)
+
+			drainCloseResponse(resp)
+
+			assert.Equal(t, testCase.expected, resp.StatusCode)
+		})
+	}
+}
+
+func TestNewInternalServer_basicAuth(t *testing.T) {
+	t.Parallel()
+
+	testServer := httptest.NewServer(internalHTTP.NewInternalServer(&internalHTTP.InternalServerConfig{
+		Log:       mock.NewLogger(),
+		Profiling: true,
+		Username:  testInternalUsername,
+		Password:  testInternalPassword,
+	}).Handler)
+	defer testServer.Close()
+
+	testCases := []struct {
+		name     string
+		username string
+		password string
+		expected int
+	}{
+		{name: "no credentials", expected: http.StatusUnauthorized},
+		{name: "wrong username", username: "wrong", password: testInternalPassword, expected: http.StatusUnauthorized},
+		{name: "wrong password", username: testInternalUsername, password: "wrong", expected: http.StatusUnauthorized},
+		{name: "valid", username: testInternalUsername, password: testInternalPassword, expected: http.StatusOK},
+	}
+
+	for _, endpoint := range []string{internalHTTP.MetricsEndpoint, internalHTTP.PprofEndpoint} {
+		for _, testCase := range testCases {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, testServer.URL+endpoint, http.NoBody)
+			require.NoError(t, err)
+
+			if testCase.username != "" {
+				req.SetBasicAuth(testCase.username, testCase.password)
+			}
+
+			resp, err := testServer.Client().Do(req)
+			require.NoError(t, err)
+
+			drainCloseResponse(resp)
+
+			assert.Equal(t, testCase.expected, resp.StatusCode, endpoint+": "+testCase.name)
+		}
+	}
+}
+
+func TestNewServer_noProfiling(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+	}).Handler)
+	defer testServer.Close()
+
+	// The public server falls back to the root handler, which serves nothing.
+	for _, endpoint := range []string{internalHTTP.MetricsEndpoint, internalHTTP.PprofEndpoint + "heap"} {
+		resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+endpoint)
+		require.NoError(t, err)
+
+		assert.Zero(t, resp.ContentLength, endpoint)
+
+		drainCloseResponse(resp)
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+// LogLevelEndpoint reads the logging level on GET and sets it on PUT, when the
+// admin API is enabled.
+const LogLevelEndpoint = "/loglevel"
+
+// GuildDebugEndpoint enables debug logging for a single guild on PUT and
+// disables it on DELETE, when the admin API is enabled.
+const GuildDebugEndpoint = LogLevelEndpoint + "/guilds/{guildID}"
+
+const maxLogLevelRequestBody = 1 << 10
+
+// LevelController is an interface abstraction for reading and changing the
+// logging level at runtime.
+type LevelController interface {
+	Level() string
+	UpdateLevel(level string, attrs ...any)
+	DebugGuilds() []string
+	SetGuildDebug(guildID string, enabled bool, attrs ...any)
+}
+
+// LogLevel is the request and response body of LogLevelEndpoint. DebugGuilds,
+// the guilds logged at debug level whatever the logging level, is only
+// reported.
+type LogLevel struct {
+	Level       string   `json:"level"`
+	DebugGuilds []string `json:"debugGuilds,omitempty"`
+}
+
+// registerLogLevelHandlers registers LogLevelEndpoint on mux. Reading the
+// level, which reveals the guilds being debugged, and changing it both
+// require the admin token; neither is possible without one.
+func registerLogLevelHandlers(mux *http.ServeMux, log *slog.Logger, level LevelController, admin *AdminConfig) {
+	if admin == nil || admin.Token == "" {
+		return
+	}
+
+	mux.Handle(http.MethodGet+" "+LogLevelEndpoint, requireToken(admin.Token, getLogLevelHandler(log, level)))
+	mux.Handle(http.MethodPut+" "+LogLevelEndpoint, requireToken(admin.Token, putLogLevelHandler(level)))
+	mux.Handle(http.MethodPut+" "+GuildDebugEndpoint, requireToken(admin.Token, guildDebugHandler(level, true)))
+	mux.Handle(http.MethodDelete+" "+GuildDebugEndpoint, requireToken(admin.Token, guildDebugHandler(level, false)))
+}
+
+func getLogLevelHandler(log *slog.Logger, level LevelController) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(LogLevel{Level: level.Level(), DebugGuilds: level.DebugGuilds()}); err != nil {
+			log.Error("Error writing log level response", "error", err)
+		}
+	}
+}
+
+func putLogLevelHandler(level LevelController) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		logLevel := LogLevel{}
+
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxLogLevelRequestBody)).Decode(&logLevel); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !logging.ValidLevel(logLevel.Level) {
+			http.Error(w, "invalid log level", http.StatusBadRequest)
+			return
+		}
+
+		// The logger audits the change itself; identify where it came from.
+		level.UpdateLevel(logLevel.Level, "source", "http", "remoteAddr", r.RemoteAddr)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func guildDebugHandler(level LevelController, enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_ = r.Body.Close()
+		}()
+
+		guildID, err := snowflake.Parse(r.PathValue("guildID"))
+		if err != nil {
+			http.Error(w, "invalid guild ID", http.StatusBadRequest)
+			return
+		}
+
+		level.SetGuildDebug(guildID.String(), enabled, "source", "http", "remoteAddr", r.RemoteAddr)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
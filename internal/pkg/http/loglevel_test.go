@@ -0,0 +1,101 @@
+package http_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+func TestNewServer_logLevel(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := logging.New(logging.OptionalOutput(io.Discard), logging.OptionalLogLevel(logging.InfoLevel))
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:      mock.NewLogger(),
+		Client:   session,
+		Admin:    &internalHTTP.AdminConfig{Token: testAdminToken, Guilds: &fakeAdministrator{}},
+		LogLevel: log,
+	}).Handler)
+	defer testServer.Close()
+
+	guildPath := internalHTTP.LogLevelEndpoint + "/guilds/" + mock.TestGuild.String()
+
+	testCases := []struct {
+		name, method, path, token, body string
+		status                          int
+	}{
+		{name: "read no token", method: http.MethodGet, status: http.StatusUnauthorized},
+		{name: "no token", method: http.MethodPut, body: `{"level":"debug"}`, status: http.StatusUnauthorized},
+		{name: "invalid level", method: http.MethodPut, token: testAdminToken, body: `{"level":"verbose"}`, status: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPut, token: testAdminToken, body: `debug`, status: http.StatusBadRequest},
+		{name: "set level", method: http.MethodPut, token: testAdminToken, body: `{"level":"debug"}`, status: http.StatusNoContent},
+		{name: "guild debug no token", method: http.MethodPut, path: guildPath, status: http.StatusUnauthorized},
+		{name: "invalid guild", method: http.MethodPut, path: internalHTTP.LogLevelEndpoint + "/guilds/x", token: testAdminToken, status: http.StatusBadRequest},
+		{name: "enable guild debug", method: http.MethodPut, path: guildPath, token: testAdminToken, status: http.StatusNoContent},
+		{name: "enable guild 2 debug", method: http.MethodPut, path: guildPath + "0", token: testAdminToken, status: http.StatusNoContent},
+		{name: "disable guild 2 debug", method: http.MethodDelete, path: guildPath + "0", token: testAdminToken, status: http.StatusNoContent},
+	}
+
+	for _, testCase := range testCases {
+		path := testCase.path
+		if path == "" {
+			path = internalHTTP.LogLevelEndpoint
+		}
+
+		resp := doAdminRequest(t, testServer.URL, testCase.method, path, testCase.token, testCase.body)
+		drainCloseResponse(resp)
+
+		assert.Equal(t, testCase.status, resp.StatusCode, testCase.name)
+	}
+
+	resp := doAdminRequest(t, testServer.URL, http.MethodGet, internalHTTP.LogLevelEndpoint, testAdminToken, "")
+
+	defer func() { _ = resp.Body.Close() }()
+
+	logLevel := internalHTTP.LogLevel{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&logLevel))
+
+	assert.Equal(t, logging.DebugLevel, logLevel.Level)
+	assert.Equal(t, []string{mock.TestGuild.String()}, logLevel.DebugGuilds)
+}
+
+func TestNewServer_logLevelDisabled(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	log := logging.New(logging.OptionalOutput(io.Discard), logging.OptionalLogLevel(logging.InfoLevel))
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:      mock.NewLogger(),
+		Client:   session,
+		LogLevel: log,
+	}).Handler)
+	defer testServer.Close()
+
+	// Without an admin token the endpoint isn't registered at all, so the
+	// level can't be changed.
+	resp := doAdminRequest(t, testServer.URL, http.MethodPut, internalHTTP.LogLevelEndpoint, "", `{"level":"debug"}`)
+	drainCloseResponse(resp)
+
+	assert.Equal(t, logging.InfoLevel, log.Level())
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodGet, internalHTTP.LogLevelEndpoint, "", "")
+	drainCloseResponse(resp)
+
+	assert.Zero(t, resp.ContentLength, "level served without an admin token")
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Notification admin API endpoints, served only when AdminConfig.Token and
+// AdminConfig.Settings are set.
+const (
+	AdminNotificationChannelEndpoint      = "PUT /admin/guilds/{guildID}/notifications/channel"
+	AdminNotificationChannelClearEndpoint = "DELETE /admin/guilds/{guildID}/notifications/channel"
+)
+
+// NotificationChannel is the request body of
+// AdminNotificationChannelEndpoint: the channel the guild's configuration
+// problems are posted to, rather than direct messaged to its owner.
+type NotificationChannel struct {
+	ChannelID snowflake.ID `json:"channelID"`
+}
+
+// registerNotificationHandlers registers the notification admin API on mux,
+// behind bearer token authentication.
+func registerNotificationHandlers(mux *http.ServeMux, log *slog.Logger, client *bot.Client, config *AdminConfig) {
+	if config.Settings == nil {
+		return
+	}
+
+	mux.Handle(AdminNotificationChannelEndpoint,
+		requireToken(config.Token, guildChannelHandler(log, client, config.Settings.SetNotificationChannel, true)))
+	mux.Handle(AdminNotificationChannelClearEndpoint,
+		requireToken(config.Token, guildChannelHandler(log, client, config.Settings.SetNotificationChannel, false)))
+}
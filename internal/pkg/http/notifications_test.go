@@ -0,0 +1,74 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+func TestNewServer_notifications(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	settingsStore := settings.NewStore()
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		Admin: &internalHTTP.AdminConfig{
+			Token:    testAdminToken,
+			Guilds:   &fakeAdministrator{},
+			Settings: settingsStore,
+		},
+	}).Handler)
+	defer testServer.Close()
+
+	// The mock guilds share channel IDs, which end up cached as channels of
+	// TestGuildLarge, added last.
+	channelPath := "/admin/guilds/" + mock.TestGuildLarge.String() + "/notifications/channel"
+	otherGuildPath := "/admin/guilds/" + mock.TestGuild.String() + "/notifications/channel"
+
+	resp := doAdminRequest(t, testServer.URL, http.MethodPut, channelPath, "", `{"channelID":"`+mock.TestChannel.String()+`"}`)
+	drainCloseResponse(resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	for _, testCase := range []struct {
+		name, path, body string
+	}{
+		{name: "no channel", path: channelPath, body: `{}`},
+		{name: "unknown channel", path: channelPath, body: `{"channelID":"1"}`},
+		{name: "channel of another guild", path: otherGuildPath, body: `{"channelID":"` + mock.TestChannel.String() + `"}`},
+	} {
+		resp := doAdminRequest(t, testServer.URL, http.MethodPut, testCase.path, testAdminToken, testCase.body)
+		drainCloseResponse(resp)
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, testCase.name)
+	}
+
+	_, ok := settingsStore.NotificationChannel(mock.TestGuild)
+	require.False(t, ok, "channel of another guild set")
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodPut, channelPath, testAdminToken, `{"channelID":"`+mock.TestChannel.String()+`"}`)
+	drainCloseResponse(resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	channelID, ok := settingsStore.NotificationChannel(mock.TestGuildLarge)
+	require.True(t, ok)
+	assert.Equal(t, mock.TestChannel, channelID)
+
+	resp = doAdminRequest(t, testServer.URL, http.MethodDelete, channelPath, testAdminToken, "")
+	drainCloseResponse(resp)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, ok = settingsStore.NotificationChannel(mock.TestGuildLarge)
+	assert.False(t, ok)
+}
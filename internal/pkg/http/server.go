@@ -2,65 +2,187 @@ package http
 
 import (
 	"cmp"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"net/http/pprof"
-	"slices"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/gateway"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
 )
 
 // Supported endpoints.
 const (
-	RootEndpoint   = "/"
-	GuildsEndpoint = "/guilds"
-	ReadyzEndpoint = "/readyz"
+	RootEndpoint         = "/"
+	GuildsEndpoint       = "/guilds"
+	ReadyzEndpoint       = "/readyz"
+	LivezEndpoint        = "/livez"
+	ShardsEndpoint       = "/shards"
+	VoiceHistoryEndpoint = "/voicehistory"
+)
+
+// Default timeouts of the server returned by NewServer.
+const (
+	DefaultReadTimeout  = 30 * time.Second
+	DefaultWriteTimeout = time.Minute
+	DefaultIdleTimeout  = 2 * time.Minute
 )
 
 const (
 	readHeaderTimeout = 3 * time.Second
 
-	metricsEndpoint      = "/metrics"
-	pprofIndexEndpoint   = "/debug/pprof/"
-	pprofCmdlineEndpoint = "/debug/pprof/cmdline"
-	pprofProfileEndpoint = "/debug/pprof/profile"
-	pprofSymbolEndpoint  = "/debug/pprof/symbol"
-	pprofTraceEndpoint   = "/debug/pprof/trace"
+	defaultVoiceHistoryLimit = 100
+
+	// DefaultLivenessThreshold is the default time LivezEndpoint lets event
+	// handling go without progress.
+	DefaultLivenessThreshold = 2 * time.Minute
 )
 
-// SortableGuild is a representation of a guild that can be sorted by member
-// count.
-type SortableGuild struct {
-	Name        string `json:"name"`
-	MemberCount int    `json:"memberCount"`
+// ShardStatuses is the response body of ReadyzEndpoint: the gateway status of
+// each shard the process manages, by shard ID, or ShardStatusUnhealthy.
+type ShardStatuses map[int]string
+
+// ShardStatusUnhealthy is the status reported by ReadyzEndpoint for shards the
+// watchdog has given up on recovering.
+const ShardStatusUnhealthy = "Unhealthy"
+
+// LivenessChecker is an interface abstraction for checking that event
+// handling is making progress.
+type LivenessChecker interface {
+	Liveness(threshold time.Duration) error
 }
 
-// SortableGuilds is a slice of SortableGuild structs.
-type SortableGuilds []SortableGuild
+// ServerTimeouts are the timeouts of the server returned by NewServer, bounding
+// how long a slow or idle client can hold a connection. Zero values use the
+// defaults.
+type ServerTimeouts struct {
+	// ReadHeader bounds reading a request's headers.
+	ReadHeader time.Duration
+
+	// Read bounds reading a whole request, body included.
+	Read time.Duration
+
+	// Write bounds writing a response, from the end of reading the request's
+	// headers, or from the TLS handshake over TLS.
+	Write time.Duration
+
+	// Idle bounds waiting for the next request on a keep-alive connection.
+	Idle time.Duration
+}
+
+// ServerConfig contains fields for configuring the server returned by
+// NewServer.
+type ServerConfig struct {
+	Log    *slog.Logger
+	Client *bot.Client
+	Port   string
+
+	// TLS, when set, such as from NewTLSConfig, serves HTTPS, and HTTP/2 with
+	// clients that negotiate it, rather than plain HTTP. It requires the
+	// server to be started with ListenAndServe.
+	TLS *tls.Config
+
+	// UnencryptedHTTP2 accepts HTTP/2 without TLS from clients that know the
+	// server supports it, as a proxy in front of the server can.
+	UnencryptedHTTP2 bool
 
-// NewServer returns a new pre-configured *http.Server..
-func NewServer(log *slog.Logger, client *bot.Client, port string) *http.Server {
+	Timeouts ServerTimeouts
+
+	// ShardIDs are the shards the process manages, reported on by
+	// ReadyzEndpoint. When empty, it reports on the shards opened so far.
+	ShardIDs []int
+
+	// EphemeralRoles provides the ephemeral role counts listed by
+	// GuildsEndpoint. When nil, they are listed as zero.
+	EphemeralRoles GuildEphemeralRoles
+
+	// Liveness is checked by LivezEndpoint, which fails when event handling
+	// has made no progress for LivenessThreshold, DefaultLivenessThreshold
+	// if zero. When nil, the endpoint only reports the server is up.
+	Liveness          LivenessChecker
+	LivenessThreshold time.Duration
+
+	// Shards is served on ShardsEndpoint, and shards it reports unhealthy are
+	// not ready on ReadyzEndpoint. The endpoint is not registered when nil.
+	Shards *monitor.ShardTracker
+
+	// VoiceHistory is served on VoiceHistoryEndpoint, to requests presenting
+	// the admin token: it reveals members' activity. The endpoint is not
+	// registered when nil or without an admin token.
+	VoiceHistory *voicehistory.Store
+
+	// Admin configures the admin API. It is not registered when nil or
+	// without a token.
+	Admin *AdminConfig
+
+	// LogLevel is served on LogLevelEndpoint, to requests presenting the
+	// admin token. The endpoint is not registered when nil or without an
+	// admin token.
+	LogLevel LevelController
+
+	// IdentifyLock configures the identify lock API, for processes serving
+	// it to the others. It is not registered when nil or without a token.
+	IdentifyLock *IdentifyLockConfig
+}
+
+// NewServer returns a new pre-configured *http.Server for the public
+// endpoints. Metrics and profiling are served by NewInternalServer.
+func NewServer(config *ServerConfig) *http.Server {
+	log := config.Log
 	mux := http.NewServeMux()
 
 	mux.HandleFunc(RootEndpoint, rootHandler())
-	mux.HandleFunc(GuildsEndpoint, guildsHandler(log, client))
-	mux.HandleFunc(ReadyzEndpoint, readyzHandler(client))
-	mux.HandleFunc(pprofIndexEndpoint, pprof.Index)
-	mux.HandleFunc(pprofCmdlineEndpoint, pprof.Cmdline)
-	mux.HandleFunc(pprofProfileEndpoint, pprof.Profile)
-	mux.HandleFunc(pprofSymbolEndpoint, pprof.Symbol)
-	mux.HandleFunc(pprofTraceEndpoint, pprof.Trace)
-	mux.Handle(metricsEndpoint, promhttp.Handler())
+	mux.HandleFunc(GuildsEndpoint, GuildsHandler(log, func() SortableGuilds {
+		return cachedGuilds(config.Client)
+	}, func(guilds SortableGuilds) {
+		cachedGuildStats(config.Client, config.EphemeralRoles, guilds)
+	}))
+	mux.HandleFunc(ReadyzEndpoint, readyzHandler(log, config.Client, config.ShardIDs, config.Shards))
+	mux.HandleFunc(LivezEndpoint, livezHandler(log, config.Liveness, cmp.Or(config.LivenessThreshold, DefaultLivenessThreshold)))
+
+	if config.Shards != nil {
+		mux.HandleFunc(ShardsEndpoint, shardsHandler(log, config.Shards))
+	}
+
+	if config.Admin != nil && config.Admin.Token != "" {
+		registerAdminHandlers(mux, log, config.Client, config.Admin)
+
+		if config.VoiceHistory != nil {
+			mux.Handle(VoiceHistoryEndpoint, requireToken(config.Admin.Token, voiceHistoryHandler(log, config.VoiceHistory)))
+		}
+	}
+
+	if config.LogLevel != nil {
+		registerLogLevelHandlers(mux, log, config.LogLevel, config.Admin)
+	}
+
+	if config.IdentifyLock != nil && config.IdentifyLock.Token != "" {
+		registerIdentifyLockHandlers(mux, config.IdentifyLock)
+	}
+
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(config.UnencryptedHTTP2)
 
 	return &http.Server{
-		Addr:              "0.0.0.0:" + port,
+		Addr:              "0.0.0.0:" + config.Port,
 		Handler:           mux,
-		ReadHeaderTimeout: readHeaderTimeout,
+		TLSConfig:         config.TLS,
+		Protocols:         protocols,
+		ReadHeaderTimeout: cmp.Or(config.Timeouts.ReadHeader, readHeaderTimeout),
+		ReadTimeout:       cmp.Or(config.Timeouts.Read, DefaultReadTimeout),
+		WriteTimeout:      cmp.Or(config.Timeouts.Write, DefaultWriteTimeout),
+		IdleTimeout:       cmp.Or(config.Timeouts.Idle, DefaultIdleTimeout),
 		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelError),
 	}
 }
@@ -73,14 +195,40 @@ func rootHandler() http.HandlerFunc {
 	}
 }
 
-// readyzHandler reports 200 once every shard this process manages has
-// completed its gateway handshake and reached gateway.StatusReady, and 503
-// otherwise. Kubernetes uses this to gate the StatefulSet's OrderedReady
-// rollout: each pod is one shard, and disgo's IdentifyRateLimiter only spaces
-// IDENTIFY calls out within a single process, so without this gate multiple
-// pods starting up in quick succession can IDENTIFY within the same window
-// and have Discord invalidate the colliding sessions.
-func readyzHandler(client *bot.Client) http.HandlerFunc {
+// livezHandler reports 200 while event handling is making progress, and 503
+// once it is wedged, for Kubernetes to restart the pod: unlike an unready
+// pod, a wedged one doesn't recover on its own, and silently drops events.
+func livezHandler(log *slog.Logger, liveness LivenessChecker, threshold time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+
+		if liveness == nil {
+			return
+		}
+
+		if err := liveness.Liveness(threshold); err != nil {
+			log.Error("Liveness check failed", "error", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// readyzHandler reports 200 once every shard in shardIDs has completed its
+// gateway handshake and reached gateway.StatusReady, and 503 otherwise, with
+// the status of each shard. Shards that tracker reports unhealthy are not
+// ready whatever their status. Unless pods coordinate through an identify lock,
+// Kubernetes uses this to gate the StatefulSet's OrderedReady rollout:
+// disgo's IdentifyRateLimiter only spaces IDENTIFY calls out within a single
+// process, so without this gate multiple pods starting up in quick succession
+// can IDENTIFY within the same window and have Discord invalidate the
+// colliding sessions.
+func readyzHandler(
+	log *slog.Logger,
+	client *bot.Client,
+	shardIDs []int,
+	tracker *monitor.ShardTracker,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		_, _ = io.Copy(io.Discard, r.Body)
 		_ = r.Body.Close()
@@ -90,47 +238,162 @@ func readyzHandler(client *bot.Client) http.HandlerFunc {
 			return
 		}
 
+		statuses, ready := shardStatuses(client, shardIDs, tracker)
+
+		statusesJSON, err := json.Marshal(statuses)
+		if err != nil {
+			log.Error("Error marshaling shard statuses to JSON", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		_, _ = w.Write(statusesJSON)
+	}
+}
+
+// shardStatuses returns the gateway status of each shard in shardIDs, or of
+// each shard opened if shardIDs is empty, and whether all of them are ready.
+// A shard that hasn't been opened is reported as unconnected, and one that
+// tracker, if any, reports unhealthy as ShardStatusUnhealthy.
+func shardStatuses(client *bot.Client, shardIDs []int, tracker *monitor.ShardTracker) (ShardStatuses, bool) {
+	statuses := make(ShardStatuses)
+	ready := true
+
+	report := func(shardID int, status gateway.Status) {
+		if tracker != nil && tracker.Unhealthy(shardID) {
+			statuses[shardID] = ShardStatusUnhealthy
+			ready = false
+
+			return
+		}
+
+		statuses[shardID] = status.String()
+		ready = ready && status == gateway.StatusReady
+	}
+
+	if len(shardIDs) == 0 {
 		for shard := range client.ShardManager.Shards() {
-			if shard.Status() != gateway.StatusReady {
-				w.WriteHeader(http.StatusServiceUnavailable)
-				return
-			}
+			report(shard.ShardID(), shard.Status())
 		}
 
-		_, _ = w.Write(nil)
+		return statuses, ready
+	}
+
+	for _, shardID := range shardIDs {
+		status := gateway.StatusUnconnected
+
+		if shard := client.ShardManager.Shard(shardID); shard != nil {
+			status = shard.Status()
+		}
+
+		report(shardID, status)
 	}
+
+	return statuses, ready
 }
 
-func guildsHandler(log *slog.Logger, client *bot.Client) http.HandlerFunc {
+// shardsHandler serves the health of each shard the process manages, for
+// spotting shards that are connected but no longer receiving events.
+func shardsHandler(log *slog.Logger, tracker *monitor.ShardTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_ = r.Body.Close()
+
+		healthJSON, err := json.MarshalIndent(tracker.Health(), "", "    ")
+		if err != nil {
+			log.Error("Error marshaling shard health to JSON", "error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err = w.Write(healthJSON)
+		if err != nil {
+			log.Error("Error writing shard health response", "error", err)
+			return
+		}
+	}
+}
+
+// VoiceHistory is the response of VoiceHistoryEndpoint: the matching voice
+// sessions, most recent first, and their total time.
+type VoiceHistory struct {
+	TotalSeconds float64                `json:"totalSeconds"`
+	Sessions     []voicehistory.Session `json:"sessions"`
+}
+
+// voiceHistoryHandler serves the voice history of a guild, selected by the
+// required guild query parameter and narrowed by the optional member, channel,
+// and limit parameters. The total time covers every matching session, while
+// limit caps only the sessions listed.
+func voiceHistoryHandler(log *slog.Logger, store *voicehistory.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			_, _ = io.Copy(io.Discard, r.Body)
 			_ = r.Body.Close()
 		}()
 
-		sortedGuilds := make(SortableGuilds, 0, client.Caches.GuildsLen())
-
-		for guild := range client.Caches.Guilds() {
-			sortedGuilds = append(sortedGuilds, SortableGuild{
-				Name:        guild.Name,
-				MemberCount: guild.MemberCount,
-			})
+		query, limit, err := parseVoiceHistoryQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		slices.SortFunc(sortedGuilds, func(a, b SortableGuild) int {
-			return cmp.Compare(b.MemberCount, a.MemberCount)
-		})
+		sessions := store.Query(query)
+
+		history := VoiceHistory{
+			TotalSeconds: voicehistory.TotalDuration(sessions, time.Now()).Seconds(),
+			Sessions:     sessions[:min(limit, len(sessions))],
+		}
 
-		sortedGuildsJSON, err := json.MarshalIndent(sortedGuilds, "", "    ")
+		historyJSON, err := json.MarshalIndent(history, "", "    ")
 		if err != nil {
-			log.Error("Error marshaling sorted guilds to JSON", "error", err)
+			log.Error("Error marshaling voice history to JSON", "error", err)
 			return
 		}
 
-		_, err = w.Write(sortedGuildsJSON)
+		w.Header().Set("Content-Type", "application/json")
+
+		_, err = w.Write(historyJSON)
 		if err != nil {
-			log.Error("Error writing sorted guilds response", "error", err)
+			log.Error("Error writing voice history response", "error", err)
 			return
 		}
 	}
 }
+
+func parseVoiceHistoryQuery(values url.Values) (voicehistory.Query, int, error) {
+	query := voicehistory.Query{}
+	limit := defaultVoiceHistoryLimit
+
+	var err error
+
+	if query.GuildID, err = snowflake.Parse(values.Get("guild")); err != nil {
+		return query, 0, fmt.Errorf("invalid guild: %w", err)
+	}
+
+	if member := values.Get("member"); member != "" {
+		if query.UserID, err = snowflake.Parse(member); err != nil {
+			return query, 0, fmt.Errorf("invalid member: %w", err)
+		}
+	}
+
+	if channel := values.Get("channel"); channel != "" {
+		if query.ChannelID, err = snowflake.Parse(channel); err != nil {
+			return query, 0, fmt.Errorf("invalid channel: %w", err)
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			return query, 0, fmt.Errorf("invalid limit: %q", value)
+		}
+	}
+
+	return query, limit, nil
+}
@@ -3,18 +3,24 @@ package http_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/disgoorg/disgo/sharding"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
 	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
 )
 
 const (
@@ -37,7 +43,16 @@ func TestNewServer(t *testing.T) {
 	session.Caches.AddGuild(discord.Guild{ID: snowflake.ID(3002), Name: "testGuild2", MemberCount: 3})
 	session.Caches.AddGuild(discord.Guild{ID: snowflake.ID(3003), Name: "testGuild3", MemberCount: 4})
 
-	testServer := internalHTTP.NewServer(log, session, testPort)
+	voiceHistory := voicehistory.NewStore(&voicehistory.Config{})
+	voiceHistory.Transition(mock.TestGuild, mock.TestUser, nil, new(mock.TestChannel), time.Now().Add(-time.Minute))
+
+	testServer := internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:          log,
+		Client:       session,
+		Port:         testPort,
+		VoiceHistory: voiceHistory,
+		Admin:        &internalHTTP.AdminConfig{Token: testAdminToken, Guilds: &fakeAdministrator{}},
+	})
 
 	go func() {
 		assert.ErrorIs(t, testServer.ListenAndServe(), http.ErrServerClosed)
@@ -50,6 +65,7 @@ func TestNewServer(t *testing.T) {
 	testRootEndpoint(t, client)
 	testGuildsEndpoint(t, client)
 	testReadyzEndpoint(t, client)
+	testVoiceHistoryEndpoint(t)
 
 	ctx, cancelContext := context.WithTimeout(t.Context(), time.Second)
 	defer cancelContext()
@@ -80,6 +96,178 @@ func testReadyzEndpoint(t *testing.T, client *http.Client) {
 	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
 }
 
+func TestNewServer_readyzShards(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	// The shard manager is never opened, so none of its shards are ready.
+	session.ShardManager = sharding.New("", nil, sharding.WithShardIDs(0, 1), sharding.WithShardCount(2))
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:      mock.NewLogger(),
+		Client:   session,
+		ShardIDs: []int{0, 1},
+	}).Handler)
+	defer testServer.Close()
+
+	resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.ReadyzEndpoint)
+	require.NoError(t, err)
+
+	defer drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	statuses := make(internalHTTP.ShardStatuses)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+
+	assert.Equal(t, internalHTTP.ShardStatuses{
+		0: gateway.StatusUnconnected.String(),
+		1: gateway.StatusUnconnected.String(),
+	}, statuses)
+}
+
+func TestNewServer_shards(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	session.ShardManager = sharding.New("", nil, sharding.WithShardIDs(0, 1), sharding.WithShardCount(2))
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		Shards: monitor.NewShardTracker(&monitor.Config{Log: mock.NewLogger()}, session, 2, []int{0, 1}),
+	}).Handler)
+	defer testServer.Close()
+
+	resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.ShardsEndpoint)
+	require.NoError(t, err)
+
+	defer drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var health []monitor.ShardHealth
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+
+	// Both mock guilds are on shard 0.
+	assert.Equal(t, []monitor.ShardHealth{
+		{ShardID: 0, Status: gateway.StatusUnconnected.String(), Guilds: 2},
+		{ShardID: 1, Status: gateway.StatusUnconnected.String()},
+	}, health)
+}
+
+func TestNewServer_readyzUnhealthy(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	session.ShardManager = mock.NewShardManager(mock.NewGateway(0, gateway.StatusReady))
+
+	config := &monitor.Config{Log: mock.NewLogger()}
+	tracker := monitor.NewShardTracker(config, session, 1, []int{0})
+
+	testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:      mock.NewLogger(),
+		Client:   session,
+		ShardIDs: []int{0},
+		Shards:   tracker,
+	}).Handler)
+	defer testServer.Close()
+
+	readyz := func() (int, internalHTTP.ShardStatuses) {
+		resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.ReadyzEndpoint)
+		require.NoError(t, err)
+
+		defer drainCloseResponse(resp)
+
+		statuses := make(internalHTTP.ShardStatuses)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&statuses))
+
+		return resp.StatusCode, statuses
+	}
+
+	status, statuses := readyz()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, internalHTTP.ShardStatuses{0: gateway.StatusReady.String()}, statuses)
+
+	// The shard never dispatches a heartbeat ACK, so the watchdog gives up on
+	// it at its first check.
+	watchdog := monitor.NewWatchdog(config, &monitor.WatchdogConfig{
+		Tracker:          tracker,
+		HeartbeatTimeout: time.Millisecond,
+		MaxFailures:      1,
+	})
+
+	time.Sleep(10 * time.Millisecond)
+	watchdog.Check(t.Context())
+
+	status, statuses = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, internalHTTP.ShardStatuses{0: internalHTTP.ShardStatusUnhealthy}, statuses)
+}
+
+// livenessFunc is an internalHTTP.LivenessChecker from a function.
+type livenessFunc func(threshold time.Duration) error
+
+func (liveness livenessFunc) Liveness(threshold time.Duration) error {
+	return liveness(threshold)
+}
+
+func TestNewServer_livez(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		liveness internalHTTP.LivenessChecker
+		expected int
+	}{
+		{name: "no checker", expected: http.StatusOK},
+		{
+			name: "live",
+			liveness: livenessFunc(func(threshold time.Duration) error {
+				assert.Equal(t, internalHTTP.DefaultLivenessThreshold, threshold)
+				return nil
+			}),
+			expected: http.StatusOK,
+		},
+		{
+			name: "wedged",
+			liveness: livenessFunc(func(time.Duration) error {
+				return errors.New("wedged")
+			}),
+			expected: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			testServer := httptest.NewServer(internalHTTP.NewServer(&internalHTTP.ServerConfig{
+				Log:      mock.NewLogger(),
+				Client:   session,
+				Liveness: testCase.liveness,
+			}).Handler)
+			defer testServer.Close()
+
+			resp, err := doRequest(t.Context(), testServer.Client(), testServer.URL+internalHTTP.LivezEndpoint)
+			require.NoError(t, err)
+
+			drainCloseResponse(resp)
+
+			assert.Equal(t, testCase.expected, resp.StatusCode)
+		})
+	}
+}
+
 func testGuildsEndpoint(t *testing.T, client *http.Client) {
 	t.Helper()
 
@@ -101,3 +289,31 @@ func testGuildsEndpoint(t *testing.T, client *http.Client) {
 
 	assert.Equal(t, expectedGuilds, actualGuilds)
 }
+
+func testVoiceHistoryEndpoint(t *testing.T) {
+	t.Helper()
+
+	resp := doAdminRequest(t, testURL, http.MethodGet, internalHTTP.VoiceHistoryEndpoint, "", "")
+	drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "admin token not required")
+
+	resp = doAdminRequest(t, testURL, http.MethodGet, internalHTTP.VoiceHistoryEndpoint, testAdminToken, "")
+	drainCloseResponse(resp)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "guild parameter not required")
+
+	resp = doAdminRequest(t, testURL, http.MethodGet,
+		internalHTTP.VoiceHistoryEndpoint+"?guild="+mock.TestGuild.String()+"&member="+mock.TestUser.String(),
+		testAdminToken, "",
+	)
+
+	defer func() { _ = resp.Body.Close() }()
+
+	history := internalHTTP.VoiceHistory{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+
+	require.Len(t, history.Sessions, 1)
+	assert.Equal(t, mock.TestChannel, history.Sessions[0].ChannelID)
+	assert.GreaterOrEqual(t, history.TotalSeconds, time.Minute.Seconds())
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"cmp"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCertificateCheckInterval is the default minimum time between two
+// checks of the certificate files for changes.
+const DefaultCertificateCheckInterval = time.Minute
+
+// CertificateReloader serves a TLS certificate loaded from files, reloading
+// it when they change, so that a renewed certificate, such as one written by
+// cert-manager to a mounted Secret, is picked up without a restart.
+//
+// The files are checked during TLS handshakes, at most once per
+// CheckInterval, rather than watched. A certificate that fails to load is
+// logged, and the previous one kept, as the files are not necessarily
+// written at once.
+type CertificateReloader struct {
+	Log           *slog.Logger
+	CertFile      string
+	KeyFile       string
+	CheckInterval time.Duration
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+	checkedAt   time.Time
+}
+
+// NewCertificateReloader returns a new *CertificateReloader for the
+// certificate and key in certFile and keyFile, checked for changes every
+// checkInterval, DefaultCertificateCheckInterval if zero. It returns an error
+// if the certificate can't be loaded.
+func NewCertificateReloader(
+	log *slog.Logger,
+	certFile, keyFile string,
+	checkInterval time.Duration,
+) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		Log:           log,
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CheckInterval: cmp.Or(checkInterval, DefaultCertificateCheckInterval),
+	}
+
+	modTimes, err := reloader.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reloader.load(modTimes); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if its
+// files have changed. It satisfies tls.Config.GetCertificate.
+func (reloader *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	if time.Since(reloader.checkedAt) < reloader.CheckInterval {
+		return reloader.certificate, nil
+	}
+
+	reloader.checkedAt = time.Now()
+
+	modTimes, err := reloader.stat()
+	if err != nil {
+		reloader.Log.Error("Unable to check TLS certificate for changes: keeping the current one", "error", err)
+		return reloader.certificate, nil
+	}
+
+	if modTimes == reloader.modTimes {
+		return reloader.certificate, nil
+	}
+
+	if err := reloader.load(modTimes); err != nil {
+		reloader.Log.Error("Unable to reload TLS certificate: keeping the current one", "error", err)
+		return reloader.certificate, nil
+	}
+
+	reloader.Log.Info("Reloaded TLS certificate", "certFile", reloader.CertFile)
+
+	return reloader.certificate, nil
+}
+
+// stat returns the modification times of the certificate and key files.
+func (reloader *CertificateReloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+
+	for i, path := range []string{reloader.CertFile, reloader.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, fmt.Errorf("unable to stat TLS certificate file: %w", err)
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// load loads the certificate, recording the modification times of its files
+// it was loaded at. Once the reloader serves handshakes, the caller must hold
+// reloader.mu.
+func (reloader *CertificateReloader) load(modTimes [2]time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(reloader.CertFile, reloader.KeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load TLS certificate: %w", err)
+	}
+
+	reloader.certificate = &certificate
+	reloader.modTimes = modTimes
+	reloader.checkedAt = time.Now()
+
+	return nil
+}
+
+// NewTLSConfig returns a new pre-configured *tls.Config serving the
+// certificate of reloader.
+func NewTLSConfig(reloader *CertificateReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+}
+
+// ListenAndServe listens on the server's address and serves it, over TLS if
+// it has a TLS config, such as one from NewTLSConfig.
+func ListenAndServe(server *http.Server) error {
+	if server.TLSConfig == nil {
+		return server.ListenAndServe()
+	}
+
+	// The certificate is provided by the TLS config, not files.
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,169 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	internalHTTP "github.com/ewohltman/ephemeral-roles/internal/pkg/http"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+)
+
+const testCertificateCheckInterval = 10 * time.Millisecond
+
+func TestNewServer_tls(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeTestCertificate(t, certFile, keyFile, "first", time.Now())
+
+	reloader, err := internalHTTP.NewCertificateReloader(mock.NewLogger(), certFile, keyFile, testCertificateCheckInterval)
+	require.NoError(t, err)
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	server := internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log:    mock.NewLogger(),
+		Client: session,
+		TLS:    internalHTTP.NewTLSConfig(reloader),
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		assert.ErrorIs(t, server.ServeTLS(listener, "", ""), http.ErrServerClosed)
+	}()
+
+	defer func() { _ = server.Close() }()
+
+	serverURL := "https://" + listener.Addr().String() + internalHTTP.LivezEndpoint
+
+	resp := doTLSRequest(t, serverURL)
+	assert.Equal(t, 2, resp.ProtoMajor, "HTTP/2 not negotiated")
+	assert.Equal(t, "first", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// Modification times are set explicitly, as the rewrite may fall within
+	// the file system's timestamp granularity.
+	writeTestCertificate(t, certFile, keyFile, "second", time.Now().Add(time.Minute))
+	time.Sleep(2 * testCertificateCheckInterval)
+
+	resp = doTLSRequest(t, serverURL)
+	assert.Equal(t, "second", resp.TLS.PeerCertificates[0].Subject.CommonName, "certificate not reloaded")
+
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.NoError(t, os.Chtimes(certFile, time.Time{}, time.Now().Add(2*time.Minute)))
+	time.Sleep(2 * testCertificateCheckInterval)
+
+	resp = doTLSRequest(t, serverURL)
+	assert.Equal(t, "second", resp.TLS.PeerCertificates[0].Subject.CommonName, "invalid certificate not ignored")
+}
+
+func TestNewCertificateReloader_invalid(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	_, err := internalHTTP.NewCertificateReloader(mock.NewLogger(), certFile, keyFile, 0)
+	require.Error(t, err, "missing certificate accepted")
+
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+
+	_, err = internalHTTP.NewCertificateReloader(mock.NewLogger(), certFile, keyFile, 0)
+	require.Error(t, err, "invalid certificate accepted")
+}
+
+func TestNewServer_timeouts(t *testing.T) {
+	t.Parallel()
+
+	server := internalHTTP.NewServer(&internalHTTP.ServerConfig{Log: mock.NewLogger()})
+
+	assert.Equal(t, internalHTTP.DefaultReadTimeout, server.ReadTimeout)
+	assert.Equal(t, internalHTTP.DefaultWriteTimeout, server.WriteTimeout)
+	assert.Equal(t, internalHTTP.DefaultIdleTimeout, server.IdleTimeout)
+	assert.Positive(t, server.ReadHeaderTimeout)
+	assert.Nil(t, server.TLSConfig)
+
+	server = internalHTTP.NewServer(&internalHTTP.ServerConfig{
+		Log: mock.NewLogger(),
+		Timeouts: internalHTTP.ServerTimeouts{
+			ReadHeader: time.Second,
+			Read:       2 * time.Second,
+			Write:      3 * time.Second,
+			Idle:       4 * time.Second,
+		},
+	})
+
+	assert.Equal(t, time.Second, server.ReadHeaderTimeout)
+	assert.Equal(t, 2*time.Second, server.ReadTimeout)
+	assert.Equal(t, 3*time.Second, server.WriteTimeout)
+	assert.Equal(t, 4*time.Second, server.IdleTimeout)
+}
+
+// doTLSRequest requests serverURL over a new connection, so that the server's
+// current certificate is presented.
+func doTLSRequest(t *testing.T, serverURL string) *http.Response {
+	t.Helper()
+
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // Self-signed test certificate.
+		ForceAttemptHTTP2: true,
+	}
+	defer transport.CloseIdleConnections()
+
+	resp, err := doRequest(t.Context(), &http.Client{Transport: transport}, serverURL)
+	require.NoError(t, err)
+
+	drainCloseResponse(resp)
+
+	return resp
+}
+
+// writeTestCertificate writes a self-signed certificate for commonName and its
+// key to certFile and keyFile, modified at modTime.
+func writeTestCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	for _, path := range []string{certFile, keyFile} {
+		require.NoError(t, os.Chtimes(path, time.Time{}, modTime))
+	}
+}
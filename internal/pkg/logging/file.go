@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File sink rotation defaults, used when the corresponding FileSinkConfig
+// field is unset.
+const (
+	DefaultFileMaxSize    = 100 << 20
+	DefaultFileMaxBackups = 5
+
+	rotatedFileTimeFormat = "20060102T150405.000000000"
+)
+
+// FileSinkConfig contains fields for configuring a rotated local log file.
+type FileSinkConfig struct {
+	// Path is the file written to. Rotated files are kept alongside it, with
+	// the rotation time inserted before the extension.
+	Path string
+
+	// Level gates the records written. When empty, the shared logging level is
+	// followed, including runtime changes.
+	Level string
+
+	// MaxSize is the size in bytes a file may reach before it is rotated. It
+	// defaults to DefaultFileMaxSize.
+	MaxSize int64
+
+	// MaxAge is how long a file is written before it is rotated, regardless of
+	// size. Zero disables time-based rotation.
+	MaxAge time.Duration
+
+	// MaxBackups is how many rotated files are kept. It defaults to
+	// DefaultFileMaxBackups.
+	MaxBackups int
+}
+
+// OptionalFileSink returns an OptionFunc to configure a *Logger to also write
+// JSON logs to a rotated local file.
+func OptionalFileSink(config FileSinkConfig) OptionFunc {
+	return func(log *Logger) {
+		log.fileSink = &config
+	}
+}
+
+// rotatingFile is an io.WriteCloser appending to a file, which it rotates
+// once the file exceeds a size or age, pruning the oldest rotated files.
+type rotatingFile struct {
+	config FileSinkConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func newRotatingFile(config FileSinkConfig) (*rotatingFile, error) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultFileMaxSize
+	}
+
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = DefaultFileMaxBackups
+	}
+
+	rotating := &rotatingFile{config: config}
+
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+
+	return rotating, nil
+}
+
+// Write appends p to the file, rotating first if p would take the file past
+// MaxSize or the file has been written for longer than MaxAge. A record is
+// never split across files.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	expired := r.config.MaxAge > 0 && time.Since(r.openedAt) >= r.config.MaxAge
+
+	if r.size > 0 && (r.size+int64(len(p)) > r.config.MaxSize || expired) {
+		// A failed rotation still leaves a file to write to, unless the
+		// file can't be reopened at all.
+		if err := r.rotate(); err != nil && r.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.config.Path), 0o750); err != nil {
+		return fmt.Errorf("unable to create log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(r.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+
+	return nil
+}
+
+// rotate renames the current file aside, opens a new one, and prunes rotated
+// files beyond MaxBackups. If the file can't be renamed, it is reopened to keep
+// appending to it, and rotation is retried on the next write. The caller must
+// hold r.mu.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("unable to close log file: %w", err)
+	}
+
+	r.file = nil
+
+	if err := os.Rename(r.config.Path, r.rotatedPath(time.Now())); err != nil {
+		openedAt := r.openedAt
+
+		if openErr := r.open(); openErr != nil {
+			return errors.Join(fmt.Errorf("unable to rotate log file: %w", err), openErr)
+		}
+
+		// Keep the file's age, so an age-based rotation is retried too.
+		r.openedAt = openedAt
+
+		return fmt.Errorf("unable to rotate log file: %w", err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.prune()
+
+	return nil
+}
+
+func (r *rotatingFile) rotatedPath(at time.Time) string {
+	ext := filepath.Ext(r.config.Path)
+
+	return strings.TrimSuffix(r.config.Path, ext) + "-" + at.UTC().Format(rotatedFileTimeFormat) + ext
+}
+
+// prune removes the oldest rotated files beyond MaxBackups. Only files named
+// as rotatedPath names them are considered, so that other files alongside the
+// log file, sharing its prefix, are never removed. Rotated file names sort by
+// rotation time. Failures are ignored: a leftover file is retried on the next
+// rotation.
+func (r *rotatingFile) prune() {
+	ext := filepath.Ext(r.config.Path)
+	prefix := strings.TrimSuffix(r.config.Path, ext) + "-"
+
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return
+	}
+
+	rotated := slices.DeleteFunc(matches, func(path string) bool {
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(path, prefix), ext)
+		_, err := time.Parse(rotatedFileTimeFormat, timestamp)
+
+		return err != nil || len(timestamp) != len(rotatedFileTimeFormat)
+	})
+
+	if len(rotated) <= r.config.MaxBackups {
+		return
+	}
+
+	slices.Sort(rotated)
+
+	for _, path := range rotated[:len(rotated)-r.config.MaxBackups] {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,85 @@
+package logging_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+func TestLogger_FileSink(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ephemeral-roles.log")
+
+	// Shares the log file's prefix and sorts before the rotated files, but
+	// isn't one of them, so must not be pruned.
+	unrelated := filepath.Join(dir, "ephemeral-roles-1.log")
+	require.NoError(t, os.WriteFile(unrelated, nil, 0o600))
+
+	log := logging.New(
+		logging.OptionalOutput(io.Discard),
+		logging.OptionalLogLevel(logging.DebugLevel),
+		logging.OptionalFileSink(logging.FileSinkConfig{
+			Path:       path,
+			Level:      logging.WarningLevel,
+			MaxSize:    512,
+			MaxBackups: 2,
+		}),
+	)
+
+	log.Info("below-file-level")
+
+	for range 20 {
+		log.Warn("rotated-record", "padding", strings.Repeat("x", 100))
+	}
+
+	log.Warn("last-record")
+	log.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 4, "expected the current file, MaxBackups rotated files and the unrelated file")
+	assert.Contains(t, files, unrelated, "unrelated file pruned")
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(current), "last-record")
+	assert.LessOrEqual(t, len(current), 512)
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.NotContains(t, string(contents), "below-file-level")
+	}
+}
+
+func TestLogger_FileSinkError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(blocker, nil, 0o600))
+
+	buf := &strings.Builder{}
+
+	// The directory can't be created under a regular file, so the sink is
+	// skipped with a warning rather than failing the logger.
+	log := logging.New(
+		logging.OptionalOutput(buf),
+		logging.OptionalFileSink(logging.FileSinkConfig{Path: filepath.Join(blocker, "sub", "log")}),
+	)
+	defer log.Close()
+
+	assert.Contains(t, buf.String(), "error configuring log sink: skipping")
+
+	log.Info("still-logged")
+	assert.Contains(t, buf.String(), "still-logged")
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// GuildIDKey is the attribute key identifying the guild a log record is
+// about. Records carrying it, directly or through Logger.With, are matched
+// against the guilds with debug logging enabled.
+const GuildIDKey = "guildID"
+
+// guildOverrides is the set of guild IDs with debug logging enabled. Reads
+// are lock-free, since they happen on every record below the logging level;
+// writes copy the set.
+type guildOverrides struct {
+	mu     sync.Mutex
+	guilds atomic.Pointer[map[string]struct{}]
+}
+
+func (o *guildOverrides) set(guildID string, enabled bool) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	guilds := make(map[string]struct{})
+
+	if current := o.guilds.Load(); current != nil {
+		maps.Copy(guilds, *current)
+	}
+
+	_, wasEnabled := guilds[guildID]
+	if wasEnabled == enabled {
+		return false
+	}
+
+	if enabled {
+		guilds[guildID] = struct{}{}
+	} else {
+		delete(guilds, guildID)
+	}
+
+	o.guilds.Store(&guilds)
+
+	return true
+}
+
+func (o *guildOverrides) has(guildID string) bool {
+	guilds := o.guilds.Load()
+	if guilds == nil {
+		return false
+	}
+
+	_, ok := (*guilds)[guildID]
+
+	return ok
+}
+
+func (o *guildOverrides) any() bool {
+	guilds := o.guilds.Load()
+
+	return guilds != nil && len(*guilds) > 0
+}
+
+func (o *guildOverrides) list() []string {
+	guilds := o.guilds.Load()
+	if guilds == nil {
+		return nil
+	}
+
+	return slices.Sorted(maps.Keys(*guilds))
+}
+
+// OptionalDebugGuilds returns an OptionFunc to configure a *Logger to log at
+// debug level for the provided guild IDs.
+func OptionalDebugGuilds(guildIDs ...string) OptionFunc {
+	return func(log *Logger) {
+		for _, guildID := range guildIDs {
+			log.overrides.set(guildID, true)
+		}
+	}
+}
+
+// SetGuildDebug enables or disables debug logging for records about guildID,
+// whatever the logging level. Records about other guilds, or no guild, are
+// unaffected. Like UpdateLevel, every change is audited with a warning
+// carrying attrs.
+func (l *Logger) SetGuildDebug(guildID string, enabled bool, attrs ...any) {
+	if !l.overrides.set(guildID, enabled) {
+		return
+	}
+
+	attrs = append([]any{GuildIDKey, guildID, "enabled", enabled}, attrs...)
+
+	l.Warn("guild debug logging changed", attrs...)
+}
+
+// DebugGuilds returns the guild IDs with debug logging enabled, sorted.
+func (l *Logger) DebugGuilds() []string {
+	return l.overrides.list()
+}
+
+// guildLevelHandler wraps a slog.Handler and gates records by a slog.Leveler,
+// except that records about a guild with debug logging enabled pass at debug
+// level. The wrapped handler must itself accept debug records.
+type guildLevelHandler struct {
+	level     slog.Leveler
+	overrides *guildOverrides
+	handler   slog.Handler
+
+	// guildID is the guild bound through WithAttrs, if any.
+	guildID string
+}
+
+// Enabled reports whether a record at level may be handled. Below the
+// logging level that depends on the record's attributes, which aren't known
+// until Handle, so it only rules records out when no override could apply.
+func (h *guildLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if level >= h.level.Level() {
+		return h.handler.Enabled(ctx, level)
+	}
+
+	if level < slog.LevelDebug {
+		return false
+	}
+
+	if h.guildID != "" {
+		return h.overrides.has(h.guildID)
+	}
+
+	return h.overrides.any()
+}
+
+// Handle forwards the record to the wrapped handler if it is at or above the
+// logging level, or about a guild with debug logging enabled.
+//
+//nolint:gocritic // slog.Handler requires slog.Record to be passed by value.
+func (h *guildLevelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= h.level.Level() {
+		return h.handler.Handle(ctx, record)
+	}
+
+	guildID := h.guildID
+
+	if guildID == "" {
+		record.Attrs(func(attr slog.Attr) bool {
+			if attr.Key == GuildIDKey {
+				guildID = attr.Value.String()
+				return false
+			}
+
+			return true
+		})
+	}
+
+	if guildID == "" || !h.overrides.has(guildID) {
+		return nil
+	}
+
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a new guildLevelHandler wrapping the underlying handler
+// with the attributes applied, remembering the guild they identify, if any.
+func (h *guildLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.handler = h.handler.WithAttrs(attrs)
+
+	for _, attr := range attrs {
+		if attr.Key == GuildIDKey {
+			handler.guildID = attr.Value.String()
+		}
+	}
+
+	return &handler
+}
+
+// WithGroup returns a new guildLevelHandler wrapping the underlying handler
+// with the group applied.
+func (h *guildLevelHandler) WithGroup(name string) slog.Handler {
+	handler := *h
+	handler.handler = h.handler.WithGroup(name)
+
+	return &handler
+}
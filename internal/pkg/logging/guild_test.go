@@ -0,0 +1,43 @@
+package logging_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+func TestLogger_SetGuildDebug(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	log := logging.New(
+		logging.OptionalOutput(buf),
+		logging.OptionalLogLevel(logging.InfoLevel),
+		logging.OptionalDebugGuilds("1000"),
+	)
+
+	log.SetGuildDebug("2000", true, "source", "test")
+	assert.Equal(t, []string{"1000", "2000"}, log.DebugGuilds())
+	assert.Contains(t, buf.String(), `"msg":"guild debug logging changed","guildID":"2000","enabled":true,"source":"test"`)
+
+	log.Debug("record-guild-shown", logging.GuildIDKey, "1000")
+	log.With(logging.GuildIDKey, "2000").Debug("bound-guild-shown")
+	log.Debug("other-guild-hidden", logging.GuildIDKey, "3000")
+	log.Debug("no-guild-hidden")
+	log.With(logging.GuildIDKey, "3000").Info("other-guild-info-shown")
+
+	log.SetGuildDebug("1000", false)
+	log.Debug("disabled-guild-hidden", logging.GuildIDKey, "1000")
+
+	out := buf.String()
+	assert.Contains(t, out, "record-guild-shown")
+	assert.Contains(t, out, "bound-guild-shown")
+	assert.Contains(t, out, "other-guild-info-shown")
+	assert.NotContains(t, out, "other-guild-hidden")
+	assert.NotContains(t, out, "no-guild-hidden")
+	assert.NotContains(t, out, "disabled-guild-hidden")
+	assert.Equal(t, []string{"2000"}, log.DebugGuilds())
+}
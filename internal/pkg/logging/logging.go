@@ -1,7 +1,7 @@
 // Package logging provides a log/slog logging implementation. Configuration is
 // determined via environment variables upon startup and the logging level may
-// be changed at runtime. Logs are written to stdout and, when a Discord webhook
-// is configured, to Discord as well.
+// be changed at runtime. Logs are written to stdout and, when configured, to a
+// Discord webhook, a rotated local file, and an OTLP logs exporter as well.
 package logging
 
 import (
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	slogdiscord "github.com/Bufferoverflovv/slog-discord"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 )
 
 // Logging level strings.
@@ -40,25 +41,38 @@ const (
 type OptionFunc func(*Logger)
 
 // Logger owns the slog logging configuration and exposes an embedded
-// *slog.Logger that fans out to stdout and, when configured, a Discord webhook.
+// *slog.Logger that fans out to stdout and, when configured, a Discord
+// webhook, a rotated local file, and an OTLP logs exporter.
 type Logger struct {
 	*slog.Logger
 
 	level       *slog.LevelVar
+	overrides   *guildOverrides
 	location    *time.Location
 	webhookURL  string
+	webhook     *webhookSink
 	baseAttrs   []any
 	badTimezone string
 	output      io.Writer
+
+	webhookWindow   time.Duration
+	webhookMaxPosts int
+
+	fileSink     *FileSinkConfig
+	file         *rotatingFile
+	otlpSink     *OTLPSinkConfig
+	otlpProvider *sdklog.LoggerProvider
+	sinkErrors   []error
 }
 
 // New returns a new *Logger instance configured with the OptionFunc arguments
 // provided.
 func New(options ...OptionFunc) *Logger {
 	log := &Logger{
-		level:    &slog.LevelVar{},
-		location: time.UTC,
-		output:   os.Stdout,
+		level:     &slog.LevelVar{},
+		overrides: &guildOverrides{},
+		location:  time.UTC,
+		output:    os.Stdout,
 	}
 
 	log.level.Set(slog.LevelInfo)
@@ -73,9 +87,30 @@ func New(options ...OptionFunc) *Logger {
 		log.Warn("error parsing timezone location", "location", log.badTimezone)
 	}
 
+	for _, err := range log.sinkErrors {
+		log.Warn("error configuring log sink: skipping", "error", err)
+	}
+
 	return log
 }
 
+// Close flushes the records pending for asynchronous sinks, the Discord
+// webhook and OTLP exporter, and closes the sinks. Records logged afterwards
+// are still written to stdout.
+func (l *Logger) Close() {
+	if l.webhook != nil {
+		l.webhook.close()
+	}
+
+	if l.otlpProvider != nil {
+		_ = shutdownOTLP(l.otlpProvider)
+	}
+
+	if l.file != nil {
+		_ = l.file.Close()
+	}
+}
+
 // OptionalOutput returns an OptionFunc to configure a *Logger to set where log
 // messages should output to.
 func OptionalOutput(output io.Writer) OptionFunc {
@@ -92,6 +127,19 @@ func OptionalShardID(shardID int) OptionFunc {
 	}
 }
 
+// OptionalShardIDs returns an OptionFunc to configure a *Logger for a process
+// managing shardIDs. A single shard is included as a shardID field, as with
+// OptionalShardID, and several as a shardIDs field.
+func OptionalShardIDs(shardIDs ...int) OptionFunc {
+	if len(shardIDs) == 1 {
+		return OptionalShardID(shardIDs[0])
+	}
+
+	return func(log *Logger) {
+		log.baseAttrs = append(log.baseAttrs, slog.Any("shardIDs", shardIDs))
+	}
+}
+
 // OptionalLogLevel returns an OptionFunc to configure a *Logger log level.
 func OptionalLogLevel(logLevel string) OptionFunc {
 	return func(log *Logger) {
@@ -125,17 +173,42 @@ func OptionalDiscordWebhook(webhookURL string) OptionFunc {
 // UpdateLevel allows for runtime updates of the logging level. Both the stdout
 // and Discord handlers share the same LevelVar, so the change takes effect on
 // each of them live.
-func (l *Logger) UpdateLevel(level string) {
-	l.level.Set(parseLevel(level))
+//
+// Every change is audited with a warning carrying attrs, which callers use to
+// identify where the change came from. The warning is logged under the more
+// verbose of the old and new levels, before or after the change, so it is
+// emitted whichever way the level moves, unless both are above warning.
+func (l *Logger) UpdateLevel(level string, attrs ...any) {
+	oldLevel := l.level.Level()
+	newLevel := parseLevel(level)
+
+	attrs = append([]any{"from", levelName(oldLevel), "to", levelName(newLevel)}, attrs...)
+
+	if newLevel > oldLevel {
+		l.Warn("log level changed", attrs...)
+		l.level.Set(newLevel)
+
+		return
+	}
+
+	l.level.Set(newLevel)
+	l.Warn("log level changed", attrs...)
+}
+
+// Level returns the current logging level string.
+func (l *Logger) Level() string {
+	return levelName(l.level.Level())
 }
 
 // build (re)constructs the *slog.Logger from the current configuration, fanning
-// out to Discord when a webhook is configured.
+// out to each configured sink. Each sink has its own level gate.
 func (l *Logger) build() {
-	var handler slog.Handler = slog.NewJSONHandler(l.output, &slog.HandlerOptions{
-		Level:       l.level,
-		ReplaceAttr: l.replaceAttr,
-	})
+	// stdout accepts debug records; guildLevelHandler gates them by the shared
+	// LevelVar, letting through those for guilds with debug logging enabled.
+	// The other sinks aren't subject to the per-guild overrides.
+	handlers := []slog.Handler{
+		&guildLevelHandler{level: l.level, overrides: l.overrides, handler: l.newJSONHandler(l.output)},
+	}
 
 	if l.webhookURL != "" {
 		discordHandler := slogdiscord.NewDiscordHandler(slogdiscord.DiscordWebhookConfig{
@@ -154,9 +227,48 @@ func (l *Logger) build() {
 		// Debug, so an "info" configuration would leak debug records to Discord.
 		// Gate it with the shared LevelVar instead, which also lets runtime
 		// UpdateLevel calls take effect on the Discord output.
-		gatedDiscord := &levelHandler{level: l.level, handler: discordHandler}
+		//
+		// Posting happens asynchronously and rate limited, through the sink, so
+		// a burst of errors neither blocks the caller nor floods the webhook.
+		l.webhook = newWebhookSink(discordHandler, l.webhookWindow, l.webhookMaxPosts)
+
+		handlers = append(handlers, &levelHandler{
+			level:   l.level,
+			handler: &asyncHandler{sink: l.webhook, handler: discordHandler},
+		})
+	}
 
-		handler = &fanoutHandler{handlers: []slog.Handler{handler, gatedDiscord}}
+	if l.fileSink != nil {
+		file, err := newRotatingFile(*l.fileSink)
+		if err != nil {
+			l.sinkErrors = append(l.sinkErrors, err)
+		} else {
+			l.file = file
+
+			handlers = append(handlers, &levelHandler{
+				level:   l.sinkLevel(l.fileSink.Level),
+				handler: l.newJSONHandler(file),
+			})
+		}
+	}
+
+	if l.otlpSink != nil {
+		otlpHandler, provider, err := newOTLPHandler(l.otlpSink)
+		if err != nil {
+			l.sinkErrors = append(l.sinkErrors, err)
+		} else {
+			l.otlpProvider = provider
+
+			handlers = append(handlers, &levelHandler{
+				level:   l.sinkLevel(l.otlpSink.Level),
+				handler: otlpHandler,
+			})
+		}
+	}
+
+	handler := handlers[0]
+	if len(handlers) > 1 {
+		handler = &fanoutHandler{handlers: handlers}
 	}
 
 	slogLogger := slog.New(handler)
@@ -168,6 +280,26 @@ func (l *Logger) build() {
 	l.Logger = slogLogger
 }
 
+// newJSONHandler returns a handler writing JSON records to output, with the
+// IDs of the trace span they were logged in. It accepts debug records: gating
+// is left to the handler wrapping it.
+func (l *Logger) newJSONHandler(output io.Writer) slog.Handler {
+	return &traceHandler{handler: slog.NewJSONHandler(output, &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		ReplaceAttr: l.replaceAttr,
+	})}
+}
+
+// sinkLevel returns the level gate for a sink configured with level: the
+// shared LevelVar when level is empty, or else the fixed level.
+func (l *Logger) sinkLevel(level string) slog.Leveler {
+	if level == "" {
+		return l.level
+	}
+
+	return parseLevel(level)
+}
+
 // replaceAttr rewrites the record timestamp into the configured location.
 func (l *Logger) replaceAttr(_ []string, attr slog.Attr) slog.Attr {
 	if l.location != nil && attr.Key == slog.TimeKey && attr.Value.Kind() == slog.KindTime {
@@ -284,17 +416,45 @@ func discordEmbed(record slog.Record, levelColors slogdiscord.LevelColors) *slog
 	return embed
 }
 
+// ValidLevel reports whether level is one of the logging level strings.
+func ValidLevel(level string) bool {
+	_, ok := lookupLevel(level)
+	return ok
+}
+
 func parseLevel(level string) slog.Level {
+	slogLevel, ok := lookupLevel(level)
+	if !ok {
+		return slog.LevelInfo
+	}
+
+	return slogLevel
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level <= slog.LevelDebug:
+		return DebugLevel
+	case level <= slog.LevelInfo:
+		return InfoLevel
+	case level <= slog.LevelWarn:
+		return WarningLevel
+	default:
+		return ErrorLevel
+	}
+}
+
+func lookupLevel(level string) (slog.Level, bool) {
 	switch strings.ToLower(strings.TrimSpace(level)) {
 	case DebugLevel:
-		return slog.LevelDebug
+		return slog.LevelDebug, true
 	case InfoLevel:
-		return slog.LevelInfo
+		return slog.LevelInfo, true
 	case WarningLevel:
-		return slog.LevelWarn
+		return slog.LevelWarn, true
 	case ErrorLevel, FatalLevel, PanicLevel:
-		return slog.LevelError
+		return slog.LevelError, true
 	default:
-		return slog.LevelInfo
+		return slog.LevelInfo, false
 	}
 }
@@ -40,11 +40,37 @@ func TestLogger_UpdateLevel(t *testing.T) {
 	assert.NotContains(t, buf.String(), "debug-hidden")
 
 	log.UpdateLevel(logging.DebugLevel)
+	assert.Equal(t, logging.DebugLevel, log.Level())
 
 	log.Debug("debug-shown")
 	assert.Contains(t, buf.String(), "debug-shown")
 }
 
+func TestLogger_UpdateLevelAudited(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	log := logging.New(
+		logging.OptionalOutput(buf),
+		logging.OptionalLogLevel(logging.InfoLevel),
+	)
+
+	// Raising the level past the audit record's would hide it, unless it is
+	// logged before the change.
+	log.UpdateLevel(logging.ErrorLevel, "source", "test")
+	assert.Equal(t, logging.ErrorLevel, log.Level())
+
+	assert.Contains(t, buf.String(), `"level":"WARN","msg":"log level changed"`)
+	assert.Contains(t, buf.String(), `"from":"info","to":"error","source":"test"`)
+
+	buf.Reset()
+
+	log.UpdateLevel(logging.InfoLevel, "source", "test")
+
+	assert.Contains(t, buf.String(), `"level":"WARN","msg":"log level changed"`)
+	assert.Contains(t, buf.String(), `"from":"error","to":"info","source":"test"`)
+}
+
 func TestLogger_LevelParsing(t *testing.T) {
 	t.Parallel()
 
@@ -134,6 +160,19 @@ func TestLogger_ShardIDAndTimezone(t *testing.T) {
 	assert.NotContains(t, out, "error parsing timezone location")
 }
 
+func TestLogger_ShardIDs(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	logging.New(logging.OptionalOutput(buf), logging.OptionalShardIDs(3)).Info("hello")
+	assert.Contains(t, buf.String(), `"shardID":3`)
+
+	buf.Reset()
+	logging.New(logging.OptionalOutput(buf), logging.OptionalShardIDs(0, 1, 2)).Info("hello")
+	assert.Contains(t, buf.String(), `"shardIDs":[0,1,2]`)
+	assert.NotContains(t, buf.String(), `"shardID"`)
+}
+
 func TestLogger_InvalidTimezoneWarns(t *testing.T) {
 	t.Parallel()
 
@@ -221,3 +260,11 @@ func TestLogger_DiscordRespectsInfoLevel(t *testing.T) {
 	default:
 	}
 }
+
+func TestValidLevel(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, logging.ValidLevel(logging.DebugLevel))
+	assert.True(t, logging.ValidLevel(" WARNING "))
+	assert.False(t, logging.ValidLevel("verbose"))
+}
@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+const (
+	defaultOTLPServiceName = "ephemeral-roles"
+
+	otlpShutdownTimeout = 5 * time.Second
+)
+
+// OTLPSinkConfig contains fields for configuring an OpenTelemetry logs
+// exporter.
+type OTLPSinkConfig struct {
+	// Endpoint is the URL logs are exported to over OTLP/HTTP, for example
+	// http://otel-collector:4318/v1/logs. Headers, such as for
+	// authentication, are read from the standard OTEL_EXPORTER_OTLP_HEADERS
+	// environment variable.
+	Endpoint string
+
+	// Level gates the records exported. When empty, the shared logging level
+	// is followed, including runtime changes.
+	Level string
+
+	// ServiceName is reported as the service.name resource attribute. It
+	// defaults to ephemeral-roles.
+	ServiceName string
+}
+
+// OptionalOTLPSink returns an OptionFunc to configure a *Logger to also
+// export logs over OTLP/HTTP.
+func OptionalOTLPSink(config OTLPSinkConfig) OptionFunc {
+	return func(log *Logger) {
+		log.otlpSink = &config
+	}
+}
+
+// newOTLPHandler returns a slog.Handler exporting records in batches to the
+// configured endpoint, and the provider that must be shut down to flush them.
+func newOTLPHandler(config *OTLPSinkConfig) (slog.Handler, *sdklog.LoggerProvider, error) {
+	exporter, err := otlploghttp.New(context.Background(), otlploghttp.WithEndpointURL(config.Endpoint))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create OTLP log exporter: %w", err)
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultOTLPServiceName
+	}
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	handler := otelslog.NewHandler(serviceName, otelslog.WithLoggerProvider(provider))
+
+	return handler, provider, nil
+}
+
+// shutdownOTLP flushes the records pending export and stops exporting.
+func shutdownOTLP(provider *sdklog.LoggerProvider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+
+	return provider.Shutdown(ctx)
+}
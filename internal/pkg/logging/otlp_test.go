@@ -0,0 +1,82 @@
+package logging_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+// collectorStub is an OTLP/HTTP logs endpoint recording the bodies of the log
+// records it receives.
+type collectorStub struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (stub *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	request := &collogspb.ExportLogsServiceRequest{}
+	if err := proto.Unmarshal(payload, request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	stub.mu.Lock()
+
+	for _, resourceLogs := range request.GetResourceLogs() {
+		for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+			for _, record := range scopeLogs.GetLogRecords() {
+				stub.bodies = append(stub.bodies, record.GetBody().GetStringValue())
+			}
+		}
+	}
+
+	stub.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestLogger_OTLPSink(t *testing.T) {
+	t.Parallel()
+
+	stub := &collectorStub{}
+
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	log := logging.New(
+		logging.OptionalOutput(io.Discard),
+		logging.OptionalLogLevel(logging.DebugLevel),
+		logging.OptionalOTLPSink(logging.OTLPSinkConfig{
+			Endpoint: server.URL + "/v1/logs",
+			Level:    logging.ErrorLevel,
+		}),
+	)
+
+	log.Warn("below-otlp-level")
+	log.Error("exported-record")
+
+	// Close flushes the batch processor.
+	log.Close()
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	require.Equal(t, []string{"exported-record"}, stub.bodies)
+	assert.NotContains(t, stub.bodies, "below-otlp-level")
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys identifying the trace span a log record was written in, for
+// records logged with a context carrying one.
+const (
+	TraceIDKey = "traceID"
+	SpanIDKey  = "spanID"
+)
+
+// traceHandler wraps a slog.Handler, adding the IDs of the trace span in the
+// record's context, if any, so log lines can be matched to traces.
+type traceHandler struct {
+	handler slog.Handler
+}
+
+// Enabled defers to the wrapped handler.
+func (h *traceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle adds the span IDs in ctx to the record and forwards it to the wrapped
+// handler.
+//
+//nolint:gocritic // slog.Handler requires slog.Record to be passed by value.
+func (h *traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record = record.Clone()
+		record.AddAttrs(
+			slog.String(TraceIDKey, spanContext.TraceID().String()),
+			slog.String(SpanIDKey, spanContext.SpanID().String()),
+		)
+	}
+
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a new traceHandler wrapping the underlying handler with the
+// attributes applied.
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a new traceHandler wrapping the underlying handler with the
+// group applied.
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{handler: h.handler.WithGroup(name)}
+}
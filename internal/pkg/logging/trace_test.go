@@ -0,0 +1,37 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+func TestLogger_TraceIDs(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	log := logging.New(logging.OptionalOutput(buf))
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(t.Context(), "test")
+	defer span.End()
+
+	log.InfoContext(ctx, "traced")
+
+	record := make(map[string]any)
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+
+	assert.Equal(t, span.SpanContext().TraceID().String(), record[logging.TraceIDKey])
+	assert.Equal(t, span.SpanContext().SpanID().String(), record[logging.SpanIDKey])
+
+	buf.Reset()
+
+	log.InfoContext(t.Context(), "untraced")
+
+	assert.NotContains(t, buf.String(), logging.TraceIDKey)
+}
@@ -0,0 +1,240 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Webhook rate limiting defaults, used unless OptionalWebhookRateLimit is
+// provided. Discord allows a webhook around 30 posts a minute.
+const (
+	DefaultWebhookWindow   = time.Minute
+	DefaultWebhookMaxPosts = 20
+
+	webhookQueueSize = 256
+)
+
+// OptionalWebhookRateLimit returns an OptionFunc to configure how a *Logger
+// rate limits its Discord webhook: at most maxPosts distinct records are posted
+// per window, and repeats of a record within a window are posted once, as a
+// count, when the window ends.
+func OptionalWebhookRateLimit(window time.Duration, maxPosts int) OptionFunc {
+	return func(log *Logger) {
+		log.webhookWindow = window
+		log.webhookMaxPosts = maxPosts
+	}
+}
+
+// webhookEntry is a record queued for the webhook, with the handler it was
+// logged through, carrying that logger's attributes.
+type webhookEntry struct {
+	handler slog.Handler
+	record  slog.Record
+}
+
+// webhookBatch tracks a distinct record posted in the current window.
+type webhookBatch struct {
+	latest  webhookEntry
+	repeats int
+}
+
+// webhookSink posts records to a webhook from a single worker goroutine,
+// deduplicating and rate limiting them, so that an outage logging the same
+// error thousands of times produces a handful of posts instead of getting the
+// webhook rate limited.
+//
+// The first occurrence of a record in a window is posted right away, so
+// alerts aren't delayed; repeats are counted and posted once when the window
+// ends. Records beyond the window's post limit, and records arriving while the
+// queue is full, are dropped and reported in a summary when the window ends.
+type webhookSink struct {
+	handler  slog.Handler
+	window   time.Duration
+	maxPosts int
+
+	queue   chan webhookEntry
+	dropped atomic.Int64
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// Owned by the worker goroutine.
+	batches    map[string]*webhookBatch
+	posts      int
+	suppressed int
+}
+
+func newWebhookSink(handler slog.Handler, window time.Duration, maxPosts int) *webhookSink {
+	if window <= 0 {
+		window = DefaultWebhookWindow
+	}
+
+	if maxPosts <= 0 {
+		maxPosts = DefaultWebhookMaxPosts
+	}
+
+	sink := &webhookSink{
+		handler:  handler,
+		window:   window,
+		maxPosts: maxPosts,
+		queue:    make(chan webhookEntry, webhookQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		batches:  make(map[string]*webhookBatch),
+	}
+
+	go sink.run()
+
+	return sink
+}
+
+// enqueue queues a record for the worker. It never blocks: when the queue is
+// full the record is dropped and counted.
+//
+//nolint:gocritic // slog.Record is passed by value, as slog.Handler does.
+func (s *webhookSink) enqueue(handler slog.Handler, record slog.Record) {
+	select {
+	case s.queue <- webhookEntry{handler: handler, record: record.Clone()}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *webhookSink) close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	<-s.done
+}
+
+func (s *webhookSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-s.queue:
+			s.add(entry)
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			for {
+				select {
+				case entry := <-s.queue:
+					s.add(entry)
+				default:
+					s.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *webhookSink) add(entry webhookEntry) {
+	key := entry.record.Level.String() + "\x00" + entry.record.Message
+
+	if batch, ok := s.batches[key]; ok {
+		batch.latest = entry
+		batch.repeats++
+
+		return
+	}
+
+	if s.posts >= s.maxPosts {
+		s.suppressed++
+		return
+	}
+
+	s.batches[key] = &webhookBatch{latest: entry}
+	s.post(entry)
+}
+
+// flush starts a new window, posting the drop summary and repeat counts for
+// the window ending. They count against the new window's post limit, so that
+// no window posts more than maxPosts records; repeat counts beyond it are
+// dropped, and reported in the new window's summary.
+func (s *webhookSink) flush() {
+	var repeats []webhookEntry
+
+	for _, batch := range s.batches {
+		if batch.repeats == 0 {
+			continue
+		}
+
+		record := batch.latest.record.Clone()
+		record.AddAttrs(slog.Int("repeated", batch.repeats))
+
+		repeats = append(repeats, webhookEntry{handler: batch.latest.handler, record: record})
+	}
+
+	suppressed, dropped := s.suppressed, s.dropped.Swap(0)
+
+	clear(s.batches)
+	s.posts = 0
+	s.suppressed = 0
+
+	if suppressed > 0 || dropped > 0 {
+		record := slog.NewRecord(time.Now(), slog.LevelWarn, "webhook log records dropped", 0)
+		record.AddAttrs(slog.Int("rateLimited", suppressed), slog.Int64("queueFull", dropped))
+
+		s.post(webhookEntry{handler: s.handler, record: record})
+	}
+
+	for _, entry := range repeats {
+		if s.posts >= s.maxPosts {
+			s.suppressed++
+			continue
+		}
+
+		s.post(entry)
+	}
+}
+
+// post sends a record to the webhook. Errors are discarded: there is nowhere
+// left to report them that wouldn't loop back here, and the record was also
+// written to stdout.
+func (s *webhookSink) post(entry webhookEntry) {
+	s.posts++
+
+	_ = entry.handler.Handle(context.Background(), entry.record)
+}
+
+// asyncHandler is a slog.Handler that hands records to a webhookSink instead
+// of handling them on the caller's goroutine, so logging never blocks on the
+// webhook.
+type asyncHandler struct {
+	sink    *webhookSink
+	handler slog.Handler
+}
+
+// Enabled defers to the wrapped handler.
+func (h *asyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle queues the record for the sink's worker.
+//
+//nolint:gocritic // slog.Handler requires slog.Record to be passed by value.
+func (h *asyncHandler) Handle(_ context.Context, record slog.Record) error {
+	h.sink.enqueue(h.handler, record)
+
+	return nil
+}
+
+// WithAttrs returns a new asyncHandler sharing the sink, wrapping the
+// underlying handler with the attributes applied.
+func (h *asyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &asyncHandler{sink: h.sink, handler: h.handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a new asyncHandler sharing the sink, wrapping the
+// underlying handler with the group applied.
+func (h *asyncHandler) WithGroup(name string) slog.Handler {
+	return &asyncHandler{sink: h.sink, handler: h.handler.WithGroup(name)}
+}
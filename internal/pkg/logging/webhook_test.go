@@ -0,0 +1,130 @@
+package logging_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/logging"
+)
+
+type webhookRecorder struct {
+	mu     sync.Mutex
+	bodies []string
+	delay  time.Duration
+}
+
+func (recorder *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	time.Sleep(recorder.delay)
+
+	recorder.mu.Lock()
+	recorder.bodies = append(recorder.bodies, string(body))
+	recorder.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (recorder *webhookRecorder) posts() []string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	return append([]string(nil), recorder.bodies...)
+}
+
+func TestLogger_WebhookDeduplicates(t *testing.T) {
+	t.Parallel()
+
+	recorder := &webhookRecorder{}
+
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	log := logging.New(
+		logging.OptionalOutput(io.Discard),
+		logging.OptionalDiscordWebhook(server.URL),
+		logging.OptionalWebhookRateLimit(time.Hour, 3),
+	)
+
+	for range 50 {
+		log.Error("repeated-error")
+	}
+
+	for _, message := range []string{"distinct-1", "distinct-2", "distinct-3", "distinct-4"} {
+		log.Error(message)
+	}
+
+	// Close ends the window, flushing the repeat count and drop summary.
+	log.Close()
+
+	posts := recorder.posts()
+	require.Len(t, posts, 5)
+
+	assert.Contains(t, posts[0], "repeated-error")
+	assert.Contains(t, posts[1], "distinct-1")
+	assert.Contains(t, posts[2], "distinct-2")
+
+	rest := strings.Join(posts[3:], "\n")
+	assert.Contains(t, rest, "repeated-error")
+	assert.Contains(t, rest, "49")
+	assert.Contains(t, rest, "webhook log records dropped")
+}
+
+func TestLogger_WebhookFlushWithinLimit(t *testing.T) {
+	t.Parallel()
+
+	recorder := &webhookRecorder{}
+
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	log := logging.New(
+		logging.OptionalOutput(io.Discard),
+		logging.OptionalDiscordWebhook(server.URL),
+		logging.OptionalWebhookRateLimit(time.Hour, 2),
+	)
+
+	for _, message := range []string{"first", "first", "second", "second", "third"} {
+		log.Error(message)
+	}
+
+	log.Close()
+
+	// The flush posts the drop summary and one of the two repeat counts:
+	// together they stay within the limit of the window they start.
+	posts := recorder.posts()
+	require.Len(t, posts, 4)
+
+	assert.Contains(t, posts[2], "webhook log records dropped")
+	assert.Contains(t, posts[3], "repeated")
+}
+
+func TestLogger_WebhookNeverBlocks(t *testing.T) {
+	t.Parallel()
+
+	recorder := &webhookRecorder{delay: time.Second}
+
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	log := logging.New(
+		logging.OptionalOutput(io.Discard),
+		logging.OptionalDiscordWebhook(server.URL),
+	)
+
+	start := time.Now()
+
+	for i := range 1000 {
+		log.Error("slow-webhook", "i", i)
+	}
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "logging blocked on the webhook")
+}
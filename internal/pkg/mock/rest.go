@@ -2,10 +2,14 @@ package mock
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"slices"
+	"sync"
 	"sync/atomic"
 
+	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/cache"
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/rest"
@@ -16,6 +20,14 @@ import (
 // in the cache.
 var errGuildNotFound = errors.New("guild not found")
 
+// errChannelNotFound is returned by the fake GetChannel when a channel is not
+// present in the cache.
+var errChannelNotFound = errors.New("channel not found")
+
+// errMissingAccess is returned by the fake CreateMessage for the channels
+// passed to FailMessages.
+var errMissingAccess = errors.New("missing access")
+
 // mockRest is a fake rest.Rest implementation backed by the cache. Only the
 // methods exercised by the bot are overridden; any other method is inherited
 // from the embedded (nil) rest.Rest interface and will panic if called, which
@@ -25,10 +37,49 @@ type mockRest struct {
 
 	caches     cache.Caches
 	nextRoleID atomic.Uint64
+
+	messagesMu      sync.Mutex
+	messages        []SentMessage
+	failingChannels map[snowflake.ID]bool
+}
+
+// SentMessage is a message sent through the fake REST client.
+type SentMessage struct {
+	ChannelID snowflake.ID
+	Message   discord.MessageCreate
+}
+
+// SentMessages returns the messages sent through the fake REST client of a
+// *bot.Client created by NewSession, in the order they were sent.
+func SentMessages(client *bot.Client) []SentMessage {
+	mock, ok := client.Rest.(*mockRest)
+	if !ok {
+		return nil
+	}
+
+	mock.messagesMu.Lock()
+	defer mock.messagesMu.Unlock()
+
+	return slices.Clone(mock.messages)
+}
+
+// FailMessages makes the messages sent to channelID through the fake REST
+// client of a *bot.Client created by NewSession fail, as for a channel the
+// bot can't post to or a user with closed direct messages.
+func FailMessages(client *bot.Client, channelID snowflake.ID) {
+	mock, ok := client.Rest.(*mockRest)
+	if !ok {
+		return
+	}
+
+	mock.messagesMu.Lock()
+	defer mock.messagesMu.Unlock()
+
+	mock.failingChannels[channelID] = true
 }
 
 func newMockRest(caches cache.Caches) *mockRest {
-	mock := &mockRest{caches: caches}
+	mock := &mockRest{caches: caches, failingChannels: make(map[snowflake.ID]bool)}
 	mock.nextRoleID.Store(uint64(TestEphemeralRole) + 1)
 
 	return mock
@@ -116,3 +167,46 @@ func (m *mockRest) GetGuild(
 
 	return &discord.RestGuild{Guild: guild}, nil
 }
+
+// GetChannel returns the channel from the cache.
+func (m *mockRest) GetChannel(channelID snowflake.ID, _ ...rest.RequestOpt) (discord.Channel, error) {
+	channel, ok := m.caches.Channel(channelID)
+	if !ok {
+		return nil, errChannelNotFound
+	}
+
+	return channel, nil
+}
+
+// CreateDMChannel returns a DM channel whose ID is the recipient's user ID.
+func (*mockRest) CreateDMChannel(userID snowflake.ID, _ ...rest.RequestOpt) (*discord.DMChannel, error) {
+	raw := fmt.Sprintf(`{"id":"%d","type":%d,"recipients":[{"id":"%d"}]}`, userID, discord.ChannelTypeDM, userID)
+
+	channel := &discord.DMChannel{}
+	if err := json.Unmarshal([]byte(raw), channel); err != nil {
+		return nil, fmt.Errorf("unable to build mock DM channel: %w", err)
+	}
+
+	return channel, nil
+}
+
+// CreateMessage records the message so tests can inspect it with
+// SentMessages.
+//
+//nolint:gocritic // signature is dictated by the rest.Rest interface
+func (m *mockRest) CreateMessage(
+	channelID snowflake.ID,
+	messageCreate discord.MessageCreate,
+	_ ...rest.RequestOpt,
+) (*discord.Message, error) {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+
+	if m.failingChannels[channelID] {
+		return nil, errMissingAccess
+	}
+
+	m.messages = append(m.messages, SentMessage{ChannelID: channelID, Message: messageCreate})
+
+	return &discord.Message{ChannelID: channelID, Content: messageCreate.Content}, nil
+}
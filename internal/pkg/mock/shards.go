@@ -0,0 +1,126 @@
+package mock
+
+import (
+	"context"
+	"iter"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/disgoorg/disgo/sharding"
+)
+
+// Gateway is a fake gateway.Gateway for a shard, with a settable status and
+// failure to open. Closing it disconnects it, and opening it makes it ready.
+// Methods a test doesn't need are left unimplemented and panic.
+type Gateway struct {
+	gateway.Gateway
+
+	ID      int
+	OpenErr error
+
+	mu     sync.Mutex
+	status gateway.Status
+	opens  int
+}
+
+// NewGateway returns a new *Gateway for shardID with status.
+func NewGateway(shardID int, status gateway.Status) *Gateway {
+	return &Gateway{ID: shardID, status: status}
+}
+
+// ShardID satisfies the gateway.Gateway interface.
+func (g *Gateway) ShardID() int {
+	return g.ID
+}
+
+// Status satisfies the gateway.Gateway interface.
+func (g *Gateway) Status() gateway.Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.status
+}
+
+// SetStatus sets the status of the gateway.
+func (g *Gateway) SetStatus(status gateway.Status) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.status = status
+}
+
+// Latency satisfies the gateway.Gateway interface.
+func (*Gateway) Latency() time.Duration {
+	return 0
+}
+
+// Open satisfies the gateway.Gateway interface.
+func (g *Gateway) Open(context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.opens++
+
+	if g.OpenErr != nil {
+		return g.OpenErr
+	}
+
+	g.status = gateway.StatusReady
+
+	return nil
+}
+
+// Opens returns the number of times the gateway has been opened.
+func (g *Gateway) Opens() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.opens
+}
+
+// CloseWithCode satisfies the gateway.Gateway interface.
+func (g *Gateway) CloseWithCode(context.Context, int, string) {
+	g.SetStatus(gateway.StatusDisconnected)
+}
+
+// ShardManager is a fake sharding.ShardManager of fake gateways. Methods a
+// test doesn't need are left unimplemented and panic.
+type ShardManager struct {
+	sharding.ShardManager
+
+	gateways map[int]*Gateway
+}
+
+// NewShardManager returns a new *ShardManager of gateways.
+func NewShardManager(gateways ...*Gateway) *ShardManager {
+	shardManager := &ShardManager{gateways: make(map[int]*Gateway)}
+
+	for _, shard := range gateways {
+		shardManager.gateways[shard.ID] = shard
+	}
+
+	return shardManager
+}
+
+// Shard satisfies the sharding.ShardManager interface.
+func (m *ShardManager) Shard(shardID int) gateway.Gateway {
+	shard, ok := m.gateways[shardID]
+	if !ok {
+		return nil
+	}
+
+	return shard
+}
+
+// Shards satisfies the sharding.ShardManager interface.
+func (m *ShardManager) Shards() iter.Seq[gateway.Gateway] {
+	return func(yield func(gateway.Gateway) bool) {
+		for shard := range maps.Values(m.gateways) {
+			if !yield(shard) {
+				return
+			}
+		}
+	}
+}
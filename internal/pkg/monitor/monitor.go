@@ -3,39 +3,58 @@
 package monitor
 
 import (
-	"context"
 	"errors"
 	"log/slog"
-	"slices"
-	"time"
+	"strconv"
+	"sync"
 
-	"github.com/disgoorg/disgo/bot"
 	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-const prometheusNamespace = "ephemeral_roles"
+const (
+	prometheusNamespace = "ephemeral_roles"
+
+	shardLabel  = "shard"
+	resultLabel = "result"
+)
 
 // Config contains fields for configuring Metrics.
 type Config struct {
-	Log      *slog.Logger
-	Client   *bot.Client
-	Interval time.Duration
+	Log *slog.Logger
 }
 
 // Metrics contains fields for tracking and exposing metrics to Prometheus.
+//
+// The guild, member, and voice member gauges are driven by gateway events
+// rather than by polling the client cache: Metrics keeps a running tally per
+// guild, adjusted as guilds become available or are left and as members join,
+// leave, and connect to voice, and applies the difference to the shard's
+// gauges.
 type Metrics struct {
 	*Config
 
-	ReadyCounter            prometheus.Counter
-	VoiceStateUpdateCounter prometheus.Counter
-	GuildsGauge             prometheus.Gauge
-	MembersGauge            prometheus.Gauge
+	ReadyCounter            *prometheus.CounterVec
+	VoiceStateUpdateCounter *prometheus.CounterVec
+	VoiceTransitionsCounter *prometheus.CounterVec
+	GuildsGauge             *prometheus.GaugeVec
+	MembersGauge            *prometheus.GaugeVec
+	VoiceMembersGauge       *prometheus.GaugeVec
+	GuildOnboardingCounter  *prometheus.CounterVec
+	ResumeCounter           *prometheus.CounterVec
+
+	mu     sync.Mutex
+	guilds map[snowflake.ID]*guildStats
+}
 
-	guildList  []discord.Guild
-	numGuilds  int
-	numMembers int
+// guildStats is the tally kept for a guild, so its contribution can be
+// removed from its shard's gauges when the guild is left.
+type guildStats struct {
+	shard        string
+	members      int
+	voiceMembers int
 }
 
 // NewMetrics returns a new *Metrics configured using the provided config.
@@ -44,142 +63,233 @@ func NewMetrics(config *Config) *Metrics {
 		Config:                  config,
 		ReadyCounter:            ReadyCounter(config),
 		VoiceStateUpdateCounter: VoiceStateUpdateCounter(config),
+		VoiceTransitionsCounter: VoiceTransitionsCounter(config),
 		GuildsGauge:             GuildsGauge(config),
 		MembersGauge:            MembersGauge(config),
+		VoiceMembersGauge:       VoiceMembersGauge(config),
+		GuildOnboardingCounter:  GuildOnboardingCounter(config),
+		ResumeCounter:           ResumeCounter(config),
+		guilds:                  make(map[snowflake.ID]*guildStats),
 	}
 }
 
-// Monitor periodically polls the client cache and updates the guild and member
-// gauges until the context is canceled. It blocks, so callers should invoke it
-// in its own goroutine (go metrics.Monitor(ctx)).
-func (metrics *Metrics) Monitor(ctx context.Context) {
-	updateTicker := time.NewTicker(metrics.Interval)
-	defer updateTicker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-updateTicker.C:
-			metrics.updateGuilds()
-			metrics.updateMembers()
-		}
-	}
+// GuildReady is the callback function for the GuildReady event from Discord,
+// fired for each guild the shard receives on startup.
+func (metrics *Metrics) GuildReady(event *events.GuildReady) {
+	metrics.addGuild(event.ShardID(), &event.Guild)
+}
+
+// GuildAvailable is the callback function for the GuildAvailable event from
+// Discord, fired when a guild recovers from an outage.
+func (metrics *Metrics) GuildAvailable(event *events.GuildAvailable) {
+	metrics.addGuild(event.ShardID(), &event.Guild)
+}
+
+// GuildJoin is the callback function for the GuildJoin event from Discord.
+func (metrics *Metrics) GuildJoin(event *events.GuildJoin) {
+	metrics.addGuild(event.ShardID(), &event.Guild)
+}
+
+// GuildUnavailable is the callback function for the GuildUnavailable event
+// from Discord, fired when a guild becomes unavailable due to an outage.
+func (metrics *Metrics) GuildUnavailable(event *events.GuildUnavailable) {
+	metrics.removeGuild(event.GuildID)
+}
+
+// GuildLeave is the callback function for the GuildLeave event from Discord.
+func (metrics *Metrics) GuildLeave(event *events.GuildLeave) {
+	metrics.removeGuild(event.GuildID)
+}
+
+// GuildMemberJoin is the callback function for the GuildMemberJoin event from
+// Discord.
+func (metrics *Metrics) GuildMemberJoin(event *events.GuildMemberJoin) {
+	metrics.updateGuild(event.GuildID, func(stats *guildStats) {
+		stats.members++
+		metrics.MembersGauge.WithLabelValues(stats.shard).Inc()
+	})
+}
+
+// GuildMemberLeave is the callback function for the GuildMemberLeave event
+// from Discord.
+func (metrics *Metrics) GuildMemberLeave(event *events.GuildMemberLeave) {
+	metrics.updateGuild(event.GuildID, func(stats *guildStats) {
+		stats.members--
+		metrics.MembersGauge.WithLabelValues(stats.shard).Dec()
+	})
+}
+
+// GuildVoiceJoin is the callback function for the GuildVoiceJoin event from
+// Discord.
+func (metrics *Metrics) GuildVoiceJoin(event *events.GuildVoiceJoin) {
+	metrics.updateGuild(event.VoiceState.GuildID, func(stats *guildStats) {
+		stats.voiceMembers++
+		metrics.VoiceMembersGauge.WithLabelValues(stats.shard).Inc()
+	})
 }
 
-func (metrics *Metrics) updateGuilds() {
-	newCount := metrics.Client.Caches.GuildsLen()
-	if newCount == metrics.numGuilds {
+// GuildVoiceLeave is the callback function for the GuildVoiceLeave event from
+// Discord.
+func (metrics *Metrics) GuildVoiceLeave(event *events.GuildVoiceLeave) {
+	// disgo also fires GuildVoiceLeave for disconnects of members it never
+	// saw connected; only count members that were.
+	if event.OldVoiceState.ChannelID == nil {
 		return
 	}
 
-	currentGuilds := slices.Collect(metrics.Client.Caches.Guilds())
+	metrics.updateGuild(event.VoiceState.GuildID, func(stats *guildStats) {
+		stats.voiceMembers--
+		metrics.VoiceMembersGauge.WithLabelValues(stats.shard).Dec()
+	})
+}
 
-	switch {
-	case newCount > metrics.numGuilds && metrics.numGuilds != 0:
-		if newGuild, ok := metrics.newlyJoinedGuild(currentGuilds); ok {
-			metrics.Log.Info(metrics.botName()+" joined new guild", "guild", newGuild.Name)
-		}
-	case newCount < metrics.numGuilds:
-		metrics.Log.Info(metrics.botName() + " removed from guild")
-	}
+// GuildRestored tallies a guild restored to the cache from a previous
+// process, for which no GuildReady event is fired when its shard resumes.
+func (metrics *Metrics) GuildRestored(shardID int, guild *discord.GatewayGuild) {
+	metrics.addGuild(shardID, guild)
+}
 
-	metrics.numGuilds = newCount
-	metrics.guildList = currentGuilds
-	metrics.GuildsGauge.Set(float64(newCount))
+// GuildDropped stops tallying a guild restored with GuildRestored that is
+// dropped from the cache again, as when its shard fails to resume.
+func (metrics *Metrics) GuildDropped(guildID snowflake.ID) {
+	metrics.removeGuild(guildID)
 }
 
-func (metrics *Metrics) updateMembers() {
-	numMembers := 0
+// addGuild starts tallying guild on shardID. A guild that is already tallied
+// (a GuildReady after a reconnect, say) has its tally replaced.
+func (metrics *Metrics) addGuild(shardID int, guild *discord.GatewayGuild) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
 
-	for guild := range metrics.Client.Caches.Guilds() {
-		numMembers += guild.MemberCount
+	metrics.remove(guild.ID)
+
+	stats := &guildStats{
+		shard:   ShardLabel(shardID),
+		members: guild.MemberCount,
 	}
 
-	if numMembers != metrics.numMembers {
-		metrics.numMembers = numMembers
-		metrics.MembersGauge.Set(float64(numMembers))
+	for _, voiceState := range guild.VoiceStates {
+		if voiceState.ChannelID != nil {
+			stats.voiceMembers++
+		}
 	}
+
+	metrics.guilds[guild.ID] = stats
+
+	metrics.GuildsGauge.WithLabelValues(stats.shard).Inc()
+	metrics.MembersGauge.WithLabelValues(stats.shard).Add(float64(stats.members))
+	metrics.VoiceMembersGauge.WithLabelValues(stats.shard).Add(float64(stats.voiceMembers))
 }
 
-func (metrics *Metrics) botName() string {
-	selfUser, ok := metrics.Client.Caches.SelfUser()
-	if !ok {
-		return ""
-	}
+func (metrics *Metrics) removeGuild(guildID snowflake.ID) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
 
-	return selfUser.Username
+	metrics.remove(guildID)
 }
 
-func (metrics *Metrics) newlyJoinedGuild(currentGuilds []discord.Guild) (discord.Guild, bool) {
-	for i := range currentGuilds {
-		if !metrics.isKnownGuild(currentGuilds[i].ID) {
-			return currentGuilds[i], true
-		}
+// remove subtracts guildID's tally from its shard's gauges and forgets it. The
+// caller must hold metrics.mu.
+func (metrics *Metrics) remove(guildID snowflake.ID) {
+	stats, ok := metrics.guilds[guildID]
+	if !ok {
+		return
 	}
 
-	return discord.Guild{}, false
+	delete(metrics.guilds, guildID)
+
+	metrics.GuildsGauge.WithLabelValues(stats.shard).Dec()
+	metrics.MembersGauge.WithLabelValues(stats.shard).Sub(float64(stats.members))
+	metrics.VoiceMembersGauge.WithLabelValues(stats.shard).Sub(float64(stats.voiceMembers))
 }
 
-func (metrics *Metrics) isKnownGuild(guildID snowflake.ID) bool {
-	for i := range metrics.guildList {
-		if metrics.guildList[i].ID == guildID {
-			return true
-		}
+// updateGuild applies update to guildID's tally. Events for guilds that are
+// not tallied yet are ignored: their counts are taken in full when the guild
+// is added.
+func (metrics *Metrics) updateGuild(guildID snowflake.ID, update func(stats *guildStats)) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	if stats, ok := metrics.guilds[guildID]; ok {
+		update(stats)
 	}
+}
 
-	return false
+// ShardLabel returns the shard label value of shardID.
+func ShardLabel(shardID int) string {
+	return strconv.Itoa(shardID)
 }
 
-// ReadyCounter returns a Prometheus counter for Ready events.
-func ReadyCounter(config *Config) prometheus.Counter {
-	return newCounter(config.Log, "ready_events_total", "Total Ready events")
+// ReadyCounter returns a Prometheus counter for Ready events, labeled by
+// shard.
+func ReadyCounter(config *Config) *prometheus.CounterVec {
+	return newCounterVec(config.Log, "ready_events_total", "Total Ready events", shardLabel)
 }
 
 // VoiceStateUpdateCounter returns a Prometheus counter for VoiceStateUpdate
-// events.
-func VoiceStateUpdateCounter(config *Config) prometheus.Counter {
-	return newCounter(config.Log, "voice_state_update_events_total", "Total VoiceStateUpdate events")
+// events, labeled by shard.
+func VoiceStateUpdateCounter(config *Config) *prometheus.CounterVec {
+	return newCounterVec(config.Log, "voice_state_update_events_total", "Total VoiceStateUpdate events", shardLabel)
 }
 
 // GuildsGauge returns a Prometheus gauge for the number of guilds the bot
-// belongs to.
-func GuildsGauge(config *Config) prometheus.Gauge {
-	return newGauge(config.Log, "guilds", "Total Guilds count")
+// belongs to, labeled by shard.
+func GuildsGauge(config *Config) *prometheus.GaugeVec {
+	return newGaugeVec(config.Log, "guilds", "Total Guilds count", shardLabel)
 }
 
 // MembersGauge returns a Prometheus gauge for the number of members of the
-// guilds the bot belongs to.
-func MembersGauge(config *Config) prometheus.Gauge {
-	return newGauge(config.Log, "members", "Total Members count")
+// guilds the bot belongs to, labeled by shard.
+func MembersGauge(config *Config) *prometheus.GaugeVec {
+	return newGaugeVec(config.Log, "members", "Total Members count", shardLabel)
+}
+
+// VoiceMembersGauge returns a Prometheus gauge for the number of members
+// connected to a voice channel in the guilds the bot belongs to, labeled by
+// shard.
+func VoiceMembersGauge(config *Config) *prometheus.GaugeVec {
+	return newGaugeVec(config.Log, "voice_members", "Total voice-connected Members count", shardLabel)
 }
 
-func newCounter(log *slog.Logger, name, help string) prometheus.Counter {
-	counter := prometheus.NewCounter(prometheus.CounterOpts{
+// GuildOnboardingCounter returns a Prometheus counter for guilds the bot has
+// joined, labeled by the onboarding result.
+func GuildOnboardingCounter(config *Config) *prometheus.CounterVec {
+	return newCounterVec(config.Log, "guild_onboarding_total", "Total guilds onboarded", resultLabel)
+}
+
+// ResumeCounter returns a Prometheus counter for attempts to resume the
+// gateway session of a previous process, labeled by shard and by whether the
+// session was resumed or the shard fell back to a new session.
+func ResumeCounter(config *Config) *prometheus.CounterVec {
+	return newCounterVec(config.Log, "session_resumes_total", "Total gateway session resume attempts on startup", shardLabel, resultLabel)
+}
+
+func newCounterVec(log *slog.Logger, name, help string, labels ...string) *prometheus.CounterVec {
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: prometheusNamespace,
 		Name:      name,
 		Help:      help,
-	})
+	}, labels)
 
-	if !register(log, counter, name) {
+	if !register(log, counterVec, name) {
 		return nil
 	}
 
-	return counter
+	return counterVec
 }
 
-func newGauge(log *slog.Logger, name, help string) prometheus.Gauge {
-	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+func newGaugeVec(log *slog.Logger, name, help string, labels ...string) *prometheus.GaugeVec {
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: prometheusNamespace,
 		Name:      name,
 		Help:      help,
-	})
+	}, labels)
 
-	if !register(log, gauge, name) {
+	if !register(log, gaugeVec, name) {
 		return nil
 	}
 
-	return gauge
+	return gaugeVec
 }
 
 func register(log *slog.Logger, collector prometheus.Collector, name string) bool {
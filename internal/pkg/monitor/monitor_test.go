@@ -1,12 +1,12 @@
 package monitor_test
 
 import (
-	"context"
 	"testing"
-	"time"
 
 	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
 	"github.com/disgoorg/snowflake/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -15,56 +15,105 @@ import (
 )
 
 const (
-	testMonitorInterval = time.Millisecond
-	sleepInterval       = 10 * testMonitorInterval
-	testTimeout         = 100 * testMonitorInterval
+	testShardID = 3
+	testShard   = "3"
 
-	newGuildID snowflake.ID = 987654321
+	newGuildID         snowflake.ID = 987654321
+	newGuildMembers                 = 5
+	joinedVoiceMembers              = 2
 )
 
 func TestMetrics(t *testing.T) {
 	t.Parallel()
 
-	session, err := mock.NewSession()
-	require.NoError(t, err)
-
-	metrics := monitor.NewMetrics(&monitor.Config{
-		Log:      mock.NewLogger(),
-		Client:   session,
-		Interval: testMonitorInterval,
-	})
+	metrics := monitor.NewMetrics(&monitor.Config{Log: mock.NewLogger()})
 
 	require.NotNil(t, metrics)
 	assert.NotNil(t, metrics.ReadyCounter)
 	assert.NotNil(t, metrics.VoiceStateUpdateCounter)
 	assert.NotNil(t, metrics.GuildsGauge)
 	assert.NotNil(t, metrics.MembersGauge)
+	assert.NotNil(t, metrics.VoiceMembersGauge)
+	assert.NotNil(t, metrics.GuildOnboardingCounter)
+	assert.NotNil(t, metrics.ResumeCounter)
 }
 
-func TestMonitor(t *testing.T) {
+func TestMetrics_events(t *testing.T) {
 	t.Parallel()
 
 	session, err := mock.NewSession()
 	require.NoError(t, err)
 
-	ctx, cancelCtx := context.WithTimeout(t.Context(), testTimeout)
-	defer cancelCtx()
+	metrics := monitor.NewMetrics(&monitor.Config{Log: mock.NewLogger()})
+	genericEvent := events.NewGenericEvent(session, 0, testShardID)
+	genericGuild := &events.GenericGuild{GenericEvent: genericEvent, GuildID: newGuildID}
+
+	guild := discord.GatewayGuild{
+		RestGuild: discord.RestGuild{
+			Guild: discord.Guild{ID: newGuildID, Name: "newGuild", MemberCount: newGuildMembers},
+		},
+		VoiceStates: []discord.VoiceState{
+			{GuildID: newGuildID, UserID: mock.TestUser, ChannelID: new(mock.TestChannel)},
+		},
+	}
+
+	metrics.GuildReady(&events.GuildReady{GenericGuild: genericGuild, Guild: guild})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
+
+	// A repeated GuildReady, as after a reconnect, replaces the guild's tally
+	// instead of double-counting it.
+	metrics.GuildReady(&events.GuildReady{GenericGuild: genericGuild, Guild: guild})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
+
+	metrics.GuildMemberJoin(&events.GuildMemberJoin{
+		GenericGuildMember: &events.GenericGuildMember{GenericEvent: genericEvent, GuildID: newGuildID},
+	})
+	assertGauges(t, metrics, 1, newGuildMembers+1, 1)
+
+	metrics.GuildMemberLeave(&events.GuildMemberLeave{GenericEvent: genericEvent, GuildID: newGuildID})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
+
+	voiceState := &events.GenericGuildVoiceState{
+		GenericEvent: genericEvent,
+		VoiceState:   discord.VoiceState{GuildID: newGuildID, UserID: mock.TestUserBot, ChannelID: new(mock.TestChannel)},
+	}
 
-	go monitor.NewMetrics(&monitor.Config{
-		Log:      mock.NewLogger(),
-		Client:   session,
-		Interval: testMonitorInterval,
-	}).Monitor(ctx)
+	metrics.GuildVoiceJoin(&events.GuildVoiceJoin{GenericGuildVoiceState: voiceState})
+	assertGauges(t, metrics, 1, newGuildMembers, joinedVoiceMembers)
 
-	// Drive the guild-join and guild-removal branches: the monitor
-	// goroutine observes the cache growing and shrinking between ticks.
-	time.Sleep(sleepInterval)
+	metrics.GuildVoiceLeave(&events.GuildVoiceLeave{
+		GenericGuildVoiceState: voiceState,
+		OldVoiceState:          voiceState.VoiceState,
+	})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
+
+	// A leave for a member that was never seen connected is not counted.
+	metrics.GuildVoiceLeave(&events.GuildVoiceLeave{GenericGuildVoiceState: voiceState})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
+
+	metrics.GuildUnavailable(&events.GuildUnavailable{GenericGuild: genericGuild})
+	assertGauges(t, metrics, 0, 0, 0)
+
+	metrics.GuildAvailable(&events.GuildAvailable{GenericGuild: genericGuild, Guild: guild})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
 
-	session.Caches.AddGuild(discord.Guild{ID: newGuildID, Name: "newGuild", MemberCount: 5})
+	metrics.GuildLeave(&events.GuildLeave{GenericGuild: genericGuild})
+	assertGauges(t, metrics, 0, 0, 0)
 
-	time.Sleep(sleepInterval)
+	// Events for guilds that aren't tallied are ignored.
+	metrics.GuildMemberJoin(&events.GuildMemberJoin{
+		GenericGuildMember: &events.GenericGuildMember{GenericEvent: genericEvent, GuildID: newGuildID},
+	})
+	assertGauges(t, metrics, 0, 0, 0)
+
+	metrics.GuildJoin(&events.GuildJoin{GenericGuild: genericGuild, Guild: guild})
+	assertGauges(t, metrics, 1, newGuildMembers, 1)
+}
 
-	session.Caches.RemoveGuild(newGuildID)
+func assertGauges(t *testing.T, metrics *monitor.Metrics, guilds, members, voiceMembers int) {
+	t.Helper()
 
-	<-ctx.Done()
+	assert.InDelta(t, guilds, testutil.ToFloat64(metrics.GuildsGauge.WithLabelValues(testShard)), 0)
+	assert.InDelta(t, members, testutil.ToFloat64(metrics.MembersGauge.WithLabelValues(testShard)), 0)
+	assert.InDelta(t, voiceMembers, testutil.ToFloat64(metrics.VoiceMembersGauge.WithLabelValues(testShard)), 0)
 }
@@ -0,0 +1,291 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/disgoorg/disgo/sharding"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const statusLabel = "status"
+
+// shardStatuses are the gateway statuses reported by ShardTracker's status
+// gauge, so a status the shard is not in reports 0 rather than going missing.
+var shardStatuses = []gateway.Status{
+	gateway.StatusUnconnected,
+	gateway.StatusConnecting,
+	gateway.StatusWaitingForHello,
+	gateway.StatusIdentifying,
+	gateway.StatusResuming,
+	gateway.StatusWaitingForReady,
+	gateway.StatusReady,
+	gateway.StatusDisconnected,
+}
+
+// ShardHealth is the health of a shard's gateway connection.
+type ShardHealth struct {
+	ShardID int    `json:"shardID"`
+	Status  string `json:"status"`
+
+	// LatencySeconds is the round trip time of the last heartbeat.
+	LatencySeconds float64 `json:"latencySeconds"`
+
+	// LastEvent is when the shard last dispatched an event other than a
+	// heartbeat ACK, or nil if it hasn't. A shard whose heartbeats are ACKed
+	// but that dispatches nothing for long is likely a zombie connection.
+	LastEvent *time.Time `json:"lastEvent,omitempty"`
+
+	// LastHeartbeatAck is when the shard last dispatched a heartbeat ACK, or
+	// nil if it hasn't.
+	LastHeartbeatAck *time.Time `json:"lastHeartbeatAck,omitempty"`
+
+	// Reconnects is the number of times the shard has reconnected, by RESUME
+	// or by IDENTIFY, since it first became ready.
+	Reconnects int `json:"reconnects"`
+
+	// Guilds is the number of cached guilds the shard is responsible for.
+	Guilds int `json:"guilds"`
+
+	// Unhealthy reports whether the Watchdog has given up on recovering the
+	// shard by reconnecting it.
+	Unhealthy bool `json:"unhealthy"`
+}
+
+// shardActivity is the activity ShardTracker has seen on a shard's gateway.
+type shardActivity struct {
+	lastEvent        time.Time
+	lastHeartbeatAck time.Time
+	sessions         int
+	reconnects       int
+	unhealthy        bool
+}
+
+// ShardTracker tracks the health of the gateway connections of the shards a
+// process manages, reporting it with Health and as a Prometheus collector.
+//
+// The shards' status and latency are read from disgo at scrape time, while
+// the last event time and reconnect count, which disgo doesn't keep, are
+// tallied from the events the shards dispatch, passed to Event.
+type ShardTracker struct {
+	Client     *bot.Client
+	ShardCount int
+	ShardIDs   []int
+
+	statusDesc     *prometheus.Desc
+	latencyDesc    *prometheus.Desc
+	lastEventDesc  *prometheus.Desc
+	reconnectsDesc *prometheus.Desc
+
+	mu     sync.Mutex
+	shards map[int]*shardActivity
+}
+
+// NewShardTracker returns a new *ShardTracker, registered with Prometheus,
+// reporting on shardIDs of shardCount shards.
+func NewShardTracker(config *Config, client *bot.Client, shardCount int, shardIDs []int) *ShardTracker {
+	tracker := &ShardTracker{
+		Client:     client,
+		ShardCount: shardCount,
+		ShardIDs:   shardIDs,
+		statusDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "shard_status"),
+			"Gateway status of the shard: 1 for its current status, 0 for the others",
+			[]string{shardLabel, statusLabel}, nil,
+		),
+		latencyDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "shard_heartbeat_latency_seconds"),
+			"Round trip time of the shard's last gateway heartbeat",
+			[]string{shardLabel}, nil,
+		),
+		lastEventDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "shard_last_event_timestamp_seconds"),
+			"Time the shard last dispatched a gateway event other than a heartbeat ACK",
+			[]string{shardLabel}, nil,
+		),
+		reconnectsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "shard_reconnects_total"),
+			"Total reconnections of the shard since it first became ready",
+			[]string{shardLabel}, nil,
+		),
+		shards: make(map[int]*shardActivity),
+	}
+
+	register(config.Log, tracker, "shard_status")
+
+	return tracker
+}
+
+// Event is the callback function for every event from Discord.
+func (tracker *ShardTracker) Event(event bot.Event) {
+	shardEvent, ok := event.(interface{ ShardID() int })
+	if !ok {
+		return
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	activity := tracker.activity(shardEvent.ShardID())
+
+	// A session starts with each Ready or Resumed event: the first with the
+	// shard's first IDENTIFY, and each one after with a reconnection.
+	var session bool
+
+	switch event.(type) {
+	case *events.HeartbeatAck:
+		activity.lastHeartbeatAck = time.Now()
+		return
+	case *events.Ready, *events.Resumed:
+		session = true
+	}
+
+	activity.lastEvent = time.Now()
+
+	if session {
+		if activity.sessions > 0 {
+			activity.reconnects++
+		}
+
+		activity.sessions++
+	}
+}
+
+// Health returns the health of each shard the tracker reports on.
+func (tracker *ShardTracker) Health() []ShardHealth {
+	guilds := make(map[int]int)
+
+	for guild := range tracker.Client.Caches.Guilds() {
+		guilds[sharding.ShardIDByGuild(guild.ID, tracker.ShardCount)]++
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	health := make([]ShardHealth, 0, len(tracker.ShardIDs))
+
+	for _, shardID := range tracker.ShardIDs {
+		shardHealth := ShardHealth{
+			ShardID: shardID,
+			Status:  gateway.StatusUnconnected.String(),
+			Guilds:  guilds[shardID],
+		}
+
+		if shard := tracker.shard(shardID); shard != nil {
+			shardHealth.Status = shard.Status().String()
+			shardHealth.LatencySeconds = max(shard.Latency(), 0).Seconds()
+		}
+
+		if activity, ok := tracker.shards[shardID]; ok {
+			shardHealth.LastEvent = optionalTime(activity.lastEvent)
+			shardHealth.LastHeartbeatAck = optionalTime(activity.lastHeartbeatAck)
+			shardHealth.Reconnects = activity.reconnects
+			shardHealth.Unhealthy = activity.unhealthy
+		}
+
+		health = append(health, shardHealth)
+	}
+
+	return health
+}
+
+// Describe satisfies the prometheus.Collector interface.
+func (tracker *ShardTracker) Describe(descs chan<- *prometheus.Desc) {
+	descs <- tracker.statusDesc
+	descs <- tracker.latencyDesc
+	descs <- tracker.lastEventDesc
+	descs <- tracker.reconnectsDesc
+}
+
+// Collect satisfies the prometheus.Collector interface. Guild counts are
+// already reported by GuildsGauge.
+func (tracker *ShardTracker) Collect(metrics chan<- prometheus.Metric) {
+	for _, shardHealth := range tracker.Health() {
+		shard := ShardLabel(shardHealth.ShardID)
+
+		for _, status := range shardStatuses {
+			value := 0.0
+			if status.String() == shardHealth.Status {
+				value = 1
+			}
+
+			metrics <- prometheus.MustNewConstMetric(tracker.statusDesc, prometheus.GaugeValue, value, shard, status.String())
+		}
+
+		metrics <- prometheus.MustNewConstMetric(
+			tracker.latencyDesc, prometheus.GaugeValue, shardHealth.LatencySeconds, shard,
+		)
+
+		if shardHealth.LastEvent != nil {
+			metrics <- prometheus.MustNewConstMetric(
+				tracker.lastEventDesc, prometheus.GaugeValue, float64(shardHealth.LastEvent.UnixNano())/float64(time.Second), shard,
+			)
+		}
+
+		metrics <- prometheus.MustNewConstMetric(
+			tracker.reconnectsDesc, prometheus.CounterValue, float64(shardHealth.Reconnects), shard,
+		)
+	}
+}
+
+// Unhealthy reports whether the Watchdog has given up on recovering shardID.
+func (tracker *ShardTracker) Unhealthy(shardID int) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	activity, ok := tracker.shards[shardID]
+
+	return ok && activity.unhealthy
+}
+
+// lastActivity returns when shardID last dispatched a heartbeat ACK and any
+// other event, zero if it hasn't.
+func (tracker *ShardTracker) lastActivity(shardID int) (lastHeartbeatAck, lastEvent time.Time) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	activity := tracker.activity(shardID)
+
+	return activity.lastHeartbeatAck, activity.lastEvent
+}
+
+// setUnhealthy records whether the Watchdog has given up on shardID.
+func (tracker *ShardTracker) setUnhealthy(shardID int, unhealthy bool) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.activity(shardID).unhealthy = unhealthy
+}
+
+// activity returns shardID's activity, creating it on first use. The caller
+// must hold tracker.mu.
+func (tracker *ShardTracker) activity(shardID int) *shardActivity {
+	activity, ok := tracker.shards[shardID]
+	if !ok {
+		activity = &shardActivity{}
+		tracker.shards[shardID] = activity
+	}
+
+	return activity
+}
+
+// shard returns shardID's gateway, or nil if it hasn't been opened.
+func (tracker *ShardTracker) shard(shardID int) gateway.Gateway {
+	if !tracker.Client.HasShardManager() {
+		return nil
+	}
+
+	return tracker.Client.ShardManager.Shard(shardID)
+}
+
+// optionalTime returns a pointer to t, or nil if t is zero.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
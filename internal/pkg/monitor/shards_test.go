@@ -0,0 +1,57 @@
+package monitor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+func TestShardTracker(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	tracker := monitor.NewShardTracker(&monitor.Config{Log: mock.NewLogger()}, session, 2, []int{0, 1})
+
+	tracker.Event(&events.HeartbeatAck{GenericEvent: events.NewGenericEvent(session, 0, 0)})
+
+	health := tracker.Health()
+	require.Len(t, health, 2)
+	assert.Nil(t, health[0].LastEvent, "heartbeat ACKs are not events")
+
+	tracker.Event(&events.Ready{GenericEvent: events.NewGenericEvent(session, 0, 0)})
+	tracker.Event(&events.GuildChannelDelete{GenericGuildChannel: &events.GenericGuildChannel{
+		GenericEvent: events.NewGenericEvent(session, 0, 0),
+	}})
+	tracker.Event(&events.Resumed{GenericEvent: events.NewGenericEvent(session, 0, 0)})
+	tracker.Event(&events.Ready{GenericEvent: events.NewGenericEvent(session, 0, 1)})
+
+	health = tracker.Health()
+
+	assert.Equal(t, gateway.StatusUnconnected.String(), health[0].Status)
+	assert.Equal(t, 2, health[0].Guilds)
+	assert.NotNil(t, health[0].LastEvent)
+	assert.Equal(t, 1, health[0].Reconnects)
+	assert.Equal(t, 0, health[1].Reconnects)
+
+	expected := `
+# HELP ephemeral_roles_shard_reconnects_total Total reconnections of the shard since it first became ready
+# TYPE ephemeral_roles_shard_reconnects_total counter
+ephemeral_roles_shard_reconnects_total{shard="0"} 1
+ephemeral_roles_shard_reconnects_total{shard="1"} 0
+`
+
+	require.NoError(t, testutil.CollectAndCompare(tracker, strings.NewReader(expected), "ephemeral_roles_shard_reconnects_total"))
+	// Per shard: a status series for each of the 8 statuses, latency, last
+	// event, and reconnects.
+	assert.Equal(t, 2*(8+3), testutil.CollectAndCount(tracker))
+}
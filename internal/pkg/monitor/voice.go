@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Voice transitions, used as the VoiceTransitionsCounter label.
+const (
+	VoiceTransitionJoin  = "join"
+	VoiceTransitionLeave = "leave"
+	VoiceTransitionMove  = "move"
+)
+
+const (
+	guildIDLabel   = "guild_id"
+	channelIDLabel = "channel_id"
+)
+
+// VoiceTransitionsCounter returns a Prometheus counter for members joining,
+// leaving, and moving between voice channels, labeled by transition.
+func VoiceTransitionsCounter(config *Config) *prometheus.CounterVec {
+	return newCounterVec(config.Log, "voice_transitions_total", "Total voice channel transitions", "transition")
+}
+
+// VoiceTransition returns the transition a member made between voice
+// channels, given the channel they were connected to before and after a
+// VoiceStateUpdate, or false if they stayed put (a mute or deafen, say).
+func VoiceTransition(oldChannelID, newChannelID *snowflake.ID) (string, bool) {
+	switch {
+	case oldChannelID == nil && newChannelID != nil:
+		return VoiceTransitionJoin, true
+	case oldChannelID != nil && newChannelID == nil:
+		return VoiceTransitionLeave, true
+	case oldChannelID != nil && *oldChannelID != *newChannelID:
+		return VoiceTransitionMove, true
+	default:
+		return "", false
+	}
+}
+
+// VoiceChannelCollector is an opt-in Prometheus collector reporting the
+// members connected to each voice channel and each guild, computed from the
+// client's voice state cache at scrape time.
+//
+// Per-guild and per-channel series are unbounded in number, so each is capped
+// at Limit series, keeping the busiest.
+type VoiceChannelCollector struct {
+	Client *bot.Client
+	Limit  int
+
+	guildDesc   *prometheus.Desc
+	channelDesc *prometheus.Desc
+}
+
+// NewVoiceChannelCollector returns a new *VoiceChannelCollector, registered
+// with Prometheus, reporting at most limit guild and limit channel series.
+func NewVoiceChannelCollector(config *Config, client *bot.Client, limit int) *VoiceChannelCollector {
+	collector := &VoiceChannelCollector{
+		Client: client,
+		Limit:  limit,
+		guildDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "voice_guild_members"),
+			"Voice-connected Members count per Guild",
+			[]string{guildIDLabel}, nil,
+		),
+		channelDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "voice_channel_members"),
+			"Voice-connected Members count per Channel",
+			[]string{guildIDLabel, channelIDLabel}, nil,
+		),
+	}
+
+	register(config.Log, collector, "voice_channel_members")
+
+	return collector
+}
+
+// Describe satisfies the prometheus.Collector interface.
+func (collector *VoiceChannelCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- collector.guildDesc
+	descs <- collector.channelDesc
+}
+
+// Collect satisfies the prometheus.Collector interface.
+func (collector *VoiceChannelCollector) Collect(metrics chan<- prometheus.Metric) {
+	guildCounts := make(map[snowflake.ID]int)
+	channelCounts := make(map[[2]snowflake.ID]int)
+
+	for guild := range collector.Client.Caches.Guilds() {
+		for voiceState := range collector.Client.Caches.VoiceStates(guild.ID) {
+			if voiceState.ChannelID == nil {
+				continue
+			}
+
+			guildCounts[guild.ID]++
+			channelCounts[[2]snowflake.ID{guild.ID, *voiceState.ChannelID}]++
+		}
+	}
+
+	for _, guildID := range busiest(guildCounts, collector.Limit, cmp.Compare[snowflake.ID]) {
+		metrics <- prometheus.MustNewConstMetric(
+			collector.guildDesc, prometheus.GaugeValue, float64(guildCounts[guildID]),
+			guildID.String(),
+		)
+	}
+
+	for _, key := range busiest(channelCounts, collector.Limit, compareChannelKeys) {
+		metrics <- prometheus.MustNewConstMetric(
+			collector.channelDesc, prometheus.GaugeValue, float64(channelCounts[key]),
+			key[0].String(), key[1].String(),
+		)
+	}
+}
+
+// busiest returns up to limit keys of counts, highest count first. Ties are
+// broken by compareKeys, so that the same keys are exported from one scrape
+// to the next when counts tie at the limit. A negative limit is taken as
+// zero.
+func busiest[K comparable](counts map[K]int, limit int, compareKeys func(a, b K) int) []K {
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b K) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), compareKeys(a, b))
+	})
+
+	return keys[:max(min(limit, len(keys)), 0)]
+}
+
+// compareChannelKeys compares the guild and channel ID keys of the channel
+// counts by channel ID, then guild ID.
+func compareChannelKeys(a, b [2]snowflake.ID) int {
+	return cmp.Or(cmp.Compare(a[1], b[1]), cmp.Compare(a[0], b[0]))
+}
@@ -0,0 +1,111 @@
+package monitor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+func TestVoiceTransition(t *testing.T) {
+	t.Parallel()
+
+	channel := new(mock.TestChannel)
+	channel2 := new(mock.TestChannel2)
+
+	testCases := []struct {
+		name       string
+		oldChannel *snowflake.ID
+		newChannel *snowflake.ID
+		expected   string
+		ok         bool
+	}{
+		{name: "join", oldChannel: nil, newChannel: channel, expected: monitor.VoiceTransitionJoin, ok: true},
+		{name: "leave", oldChannel: channel, newChannel: nil, expected: monitor.VoiceTransitionLeave, ok: true},
+		{name: "move", oldChannel: channel, newChannel: channel2, expected: monitor.VoiceTransitionMove, ok: true},
+		{name: "same channel", oldChannel: channel, newChannel: new(mock.TestChannel)},
+		{name: "not connected", oldChannel: nil, newChannel: nil},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			transition, ok := monitor.VoiceTransition(testCase.oldChannel, testCase.newChannel)
+			assert.Equal(t, testCase.ok, ok)
+			assert.Equal(t, testCase.expected, transition)
+		})
+	}
+}
+
+func TestVoiceChannelCollector(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	// Two members in TestChannel and one in TestChannel2 of TestGuild, one in
+	// TestChannel of TestGuildLarge.
+	for i, voiceState := range []struct {
+		guildID   snowflake.ID
+		channelID snowflake.ID
+	}{
+		{mock.TestGuild, mock.TestChannel},
+		{mock.TestGuild, mock.TestChannel},
+		{mock.TestGuild, mock.TestChannel2},
+		{mock.TestGuildLarge, mock.TestChannel},
+	} {
+		session.Caches.AddVoiceState(discord.VoiceState{
+			GuildID:   voiceState.guildID,
+			ChannelID: &voiceState.channelID,
+			UserID:    snowflake.ID(uint64(mock.TestUser) + uint64(i)),
+		})
+	}
+
+	collector := monitor.NewVoiceChannelCollector(&monitor.Config{Log: mock.NewLogger()}, session, 1)
+
+	expected := `
+# HELP ephemeral_roles_voice_channel_members Voice-connected Members count per Channel
+# TYPE ephemeral_roles_voice_channel_members gauge
+ephemeral_roles_voice_channel_members{channel_id="1001",guild_id="1000"} 2
+# HELP ephemeral_roles_voice_guild_members Voice-connected Members count per Guild
+# TYPE ephemeral_roles_voice_guild_members gauge
+ephemeral_roles_voice_guild_members{guild_id="1000"} 3
+`
+
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+
+	// The channels tied at the limit are exported by lowest channel ID, on
+	// every scrape.
+	collector.Limit = 2
+
+	expected = `
+# HELP ephemeral_roles_voice_channel_members Voice-connected Members count per Channel
+# TYPE ephemeral_roles_voice_channel_members gauge
+ephemeral_roles_voice_channel_members{channel_id="1001",guild_id="1000"} 2
+ephemeral_roles_voice_channel_members{channel_id="1001",guild_id="2000"} 1
+# HELP ephemeral_roles_voice_guild_members Voice-connected Members count per Guild
+# TYPE ephemeral_roles_voice_guild_members gauge
+ephemeral_roles_voice_guild_members{guild_id="1000"} 3
+ephemeral_roles_voice_guild_members{guild_id="2000"} 1
+`
+
+	for range 10 {
+		require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+	}
+
+	collector.Limit = 10
+
+	assert.Equal(t, 5, testutil.CollectAndCount(collector))
+
+	collector.Limit = -1
+
+	assert.Zero(t, testutil.CollectAndCount(collector))
+}
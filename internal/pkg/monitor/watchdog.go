@@ -0,0 +1,256 @@
+package monitor
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Watchdog defaults.
+const (
+	DefaultWatchdogInterval         = 30 * time.Second
+	DefaultWatchdogHeartbeatTimeout = 2 * time.Minute
+	DefaultWatchdogMaxFailures      = 3
+
+	watchdogReconnectTimeout = time.Minute
+)
+
+// Results of a reconnection forced by the Watchdog, as labeled on its
+// reconnects counter.
+const (
+	WatchdogReconnectSuccess = "success"
+	WatchdogReconnectFailure = "failure"
+)
+
+// WatchdogConfig contains fields for configuring a Watchdog.
+type WatchdogConfig struct {
+	Tracker *ShardTracker
+
+	// Interval is how often the shards are checked.
+	Interval time.Duration
+
+	// HeartbeatTimeout is how long a shard may go without dispatching a
+	// heartbeat ACK. Discord asks for a heartbeat every 41.25 seconds or so.
+	HeartbeatTimeout time.Duration
+
+	// EventTimeout is how long a shard may go without dispatching any other
+	// event. A shard with few, quiet guilds can legitimately receive nothing
+	// for long, so it is disabled when 0.
+	EventTimeout time.Duration
+
+	// MaxFailures is the number of consecutive checks finding a shard stale,
+	// each forcing a reconnect, after which it is reported unhealthy.
+	MaxFailures int
+}
+
+// Watchdog detects zombie shards, whose connection is up but which no longer
+// dispatch heartbeat ACKs or events, and forces them to reconnect.
+//
+// Staleness is judged from the events the shards dispatch to the
+// ShardTracker rather than from disgo's own heartbeat bookkeeping: disgo
+// already reconnects a shard whose heartbeats go unACKed, but not one whose
+// event dispatch is wedged (a listener blocking on disgo's event-manager
+// mutex, say) while its connection stays healthy.
+//
+// A shard still stale after MaxFailures checks is reported unhealthy on the
+// ShardTracker, failing the readiness check, which takes the process out of
+// its Service's endpoints, until the shard dispatches a heartbeat ACK again.
+type Watchdog struct {
+	*Config
+	*WatchdogConfig
+
+	reconnectsCounter *prometheus.CounterVec
+	unhealthyGauge    *prometheus.GaugeVec
+
+	// since is when each shard was last reconnected by the watchdog, or when
+	// the watchdog started, from which staleness is judged until the shard
+	// dispatches again. A failing shard only recovers once it has dispatched
+	// a heartbeat ACK since then.
+	since    map[int]time.Time
+	failures map[int]int
+
+	// orphaned are the shards the watchdog failed to reconnect, left
+	// disconnected with disgo not reconnecting them.
+	orphaned map[int]bool
+}
+
+// NewWatchdog returns a new *Watchdog configured using the provided configs,
+// with defaults for the zero values of the watchdog config, except for
+// EventTimeout.
+func NewWatchdog(config *Config, watchdogConfig *WatchdogConfig) *Watchdog {
+	watchdogConfig.Interval = cmp.Or(watchdogConfig.Interval, DefaultWatchdogInterval)
+	watchdogConfig.HeartbeatTimeout = cmp.Or(watchdogConfig.HeartbeatTimeout, DefaultWatchdogHeartbeatTimeout)
+	watchdogConfig.MaxFailures = cmp.Or(watchdogConfig.MaxFailures, DefaultWatchdogMaxFailures)
+
+	now := time.Now()
+	since := make(map[int]time.Time, len(watchdogConfig.Tracker.ShardIDs))
+
+	for _, shardID := range watchdogConfig.Tracker.ShardIDs {
+		since[shardID] = now
+	}
+
+	return &Watchdog{
+		Config:         config,
+		WatchdogConfig: watchdogConfig,
+		reconnectsCounter: newCounterVec(
+			config.Log, "shard_watchdog_reconnects_total", "Total reconnections forced by the zombie shard watchdog",
+			shardLabel, resultLabel,
+		),
+		unhealthyGauge: newGaugeVec(
+			config.Log, "shard_watchdog_unhealthy", "Whether the zombie shard watchdog has given up on recovering the shard",
+			shardLabel,
+		),
+		since:    since,
+		failures: make(map[int]int),
+		orphaned: make(map[int]bool),
+	}
+}
+
+// Run checks the shards every Interval until ctx is done.
+func (watchdog *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(watchdog.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			watchdog.Check(ctx)
+		}
+	}
+}
+
+// Check checks each shard once, forcing those that are stale to reconnect.
+//
+// Shards that are not opened yet, or are connecting, are skipped: IDENTIFY
+// can legitimately wait long on the identify lock. Stale disconnected shards
+// are not reconnected, as disgo may be reconnecting them itself, unless the
+// watchdog's own reconnect of the shard failed; they are still reported
+// unhealthy after MaxFailures checks, in case disgo has given up on them.
+func (watchdog *Watchdog) Check(ctx context.Context) {
+	for _, shardID := range watchdog.Tracker.ShardIDs {
+		shard := watchdog.Tracker.shard(shardID)
+		if shard == nil {
+			continue
+		}
+
+		status := shard.Status()
+
+		switch status {
+		case gateway.StatusReady, gateway.StatusDisconnected, gateway.StatusUnconnected:
+		default:
+			continue
+		}
+
+		reason, stale := watchdog.stale(shardID)
+		if !stale {
+			// A shard just reconnected isn't stale again until
+			// HeartbeatTimeout has passed, whether or not it recovered.
+			if watchdog.acked(shardID) {
+				watchdog.recovered(shardID)
+			}
+
+			continue
+		}
+
+		watchdog.failures[shardID]++
+
+		log := watchdog.Log.With("shardID", shardID, "reason", reason, "failures", watchdog.failures[shardID])
+
+		if status == gateway.StatusReady || watchdog.orphaned[shardID] {
+			log.Warn("Shard appears to be a zombie: reconnecting")
+
+			watchdog.reconnect(ctx, log, shard)
+		} else {
+			log.Warn("Shard is disconnected: leaving its reconnection to disgo")
+		}
+
+		if watchdog.failures[shardID] >= watchdog.MaxFailures && !watchdog.Tracker.Unhealthy(shardID) {
+			log.Error("Shard is not recovering from reconnects: reporting unhealthy")
+
+			watchdog.Tracker.setUnhealthy(shardID, true)
+			watchdog.unhealthyGauge.WithLabelValues(ShardLabel(shardID)).Set(1)
+		}
+	}
+}
+
+// stale reports whether shardID has gone without dispatching heartbeat ACKs
+// or events for too long, and which.
+func (watchdog *Watchdog) stale(shardID int) (string, bool) {
+	lastHeartbeatAck, lastEvent := watchdog.Tracker.lastActivity(shardID)
+	since := watchdog.since[shardID]
+
+	switch {
+	case time.Since(latest(lastHeartbeatAck, since)) > watchdog.HeartbeatTimeout:
+		return "no heartbeat ACK", true
+	case watchdog.EventTimeout > 0 && time.Since(latest(lastEvent, since)) > watchdog.EventTimeout:
+		return "no events", true
+	default:
+		return "", false
+	}
+}
+
+// acked reports whether shardID has dispatched a heartbeat ACK since it was
+// last reconnected by the watchdog, or since the watchdog started.
+func (watchdog *Watchdog) acked(shardID int) bool {
+	lastHeartbeatAck, _ := watchdog.Tracker.lastActivity(shardID)
+
+	return lastHeartbeatAck.After(watchdog.since[shardID])
+}
+
+// reconnect closes shard's connection, keeping its session resumable, and
+// opens it again.
+func (watchdog *Watchdog) reconnect(ctx context.Context, log *slog.Logger, shard gateway.Gateway) {
+	ctx, cancel := context.WithTimeout(ctx, watchdogReconnectTimeout)
+	defer cancel()
+
+	watchdog.since[shard.ShardID()] = time.Now()
+
+	shard.CloseWithCode(ctx, websocket.CloseServiceRestart, "zombie connection")
+
+	result := WatchdogReconnectSuccess
+
+	watchdog.orphaned[shard.ShardID()] = false
+
+	if err := shard.Open(ctx); err != nil {
+		log.Error("Unable to reconnect shard", "error", err)
+
+		result = WatchdogReconnectFailure
+		watchdog.orphaned[shard.ShardID()] = true
+	}
+
+	watchdog.reconnectsCounter.WithLabelValues(ShardLabel(shard.ShardID()), result).Inc()
+}
+
+// recovered resets shardID's failures once it is no longer stale and has
+// dispatched a heartbeat ACK.
+func (watchdog *Watchdog) recovered(shardID int) {
+	if watchdog.failures[shardID] == 0 {
+		return
+	}
+
+	delete(watchdog.failures, shardID)
+	delete(watchdog.orphaned, shardID)
+
+	if watchdog.Tracker.Unhealthy(shardID) {
+		watchdog.Log.Info("Shard recovered", "shardID", shardID)
+
+		watchdog.Tracker.setUnhealthy(shardID, false)
+		watchdog.unhealthyGauge.WithLabelValues(ShardLabel(shardID)).Set(0)
+	}
+}
+
+// latest returns the later of a and b.
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,120 @@
+package monitor_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+const testHeartbeatTimeout = 50 * time.Millisecond
+
+func TestWatchdog(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	zombie := mock.NewGateway(0, gateway.StatusReady)
+	unrecoverable := mock.NewGateway(1, gateway.StatusReady)
+	unrecoverable.OpenErr = errors.New("unable to connect")
+	identifying := mock.NewGateway(2, gateway.StatusIdentifying)
+	reconnecting := mock.NewGateway(3, gateway.StatusDisconnected)
+
+	session.ShardManager = mock.NewShardManager(zombie, unrecoverable, identifying, reconnecting)
+
+	config := &monitor.Config{Log: mock.NewLogger()}
+	tracker := monitor.NewShardTracker(config, session, 4, []int{0, 1, 2, 3, 4})
+	watchdog := monitor.NewWatchdog(config, &monitor.WatchdogConfig{
+		Tracker:          tracker,
+		HeartbeatTimeout: testHeartbeatTimeout,
+		MaxFailures:      2,
+	})
+
+	// Nothing is stale until HeartbeatTimeout after the watchdog started.
+	watchdog.Check(t.Context())
+	assert.Zero(t, zombie.Opens())
+
+	time.Sleep(2 * testHeartbeatTimeout)
+	watchdog.Check(t.Context())
+
+	assert.Equal(t, 1, zombie.Opens())
+	assert.Equal(t, 1, unrecoverable.Opens())
+	assert.Zero(t, identifying.Opens(), "connecting shards are skipped")
+	assert.Zero(t, reconnecting.Opens(), "shards disconnected by disgo are left to it")
+	assert.False(t, tracker.Unhealthy(0))
+
+	// The reconnected shard dispatches heartbeat ACKs again, while the other
+	// is still disconnected.
+	ack := func() {
+		tracker.Event(&events.HeartbeatAck{GenericEvent: events.NewGenericEvent(session, 0, 0)})
+	}
+
+	time.Sleep(2 * testHeartbeatTimeout)
+	ack()
+	watchdog.Check(t.Context())
+
+	assert.Equal(t, 1, zombie.Opens())
+	assert.Equal(t, gateway.StatusDisconnected, unrecoverable.Status())
+	assert.Equal(t, 2, unrecoverable.Opens())
+	assert.False(t, tracker.Unhealthy(0))
+	assert.True(t, tracker.Unhealthy(1), "unhealthy after MaxFailures")
+	assert.Zero(t, reconnecting.Opens())
+	assert.True(t, tracker.Unhealthy(3), "disconnected shard not reported unhealthy after MaxFailures")
+
+	// Once the shard recovers, it is reported healthy again.
+	unrecoverable.OpenErr = nil
+
+	time.Sleep(2 * testHeartbeatTimeout)
+	ack()
+	watchdog.Check(t.Context())
+
+	assert.Equal(t, gateway.StatusReady, unrecoverable.Status())
+
+	tracker.Event(&events.HeartbeatAck{GenericEvent: events.NewGenericEvent(session, 0, 1)})
+	watchdog.Check(t.Context())
+
+	assert.False(t, tracker.Unhealthy(1))
+}
+
+func TestWatchdog_checkedWithinHeartbeatTimeout(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	zombie := mock.NewGateway(0, gateway.StatusReady)
+
+	session.ShardManager = mock.NewShardManager(zombie)
+
+	config := &monitor.Config{Log: mock.NewLogger()}
+	tracker := monitor.NewShardTracker(config, session, 1, []int{0})
+	watchdog := monitor.NewWatchdog(config, &monitor.WatchdogConfig{
+		Tracker:          tracker,
+		Interval:         testHeartbeatTimeout / 4,
+		HeartbeatTimeout: testHeartbeatTimeout,
+		MaxFailures:      2,
+	})
+
+	// Checks between reconnects find the shard not stale yet, but it isn't
+	// recovered until it dispatches a heartbeat ACK.
+	for range 16 {
+		time.Sleep(watchdog.Interval)
+		watchdog.Check(t.Context())
+	}
+
+	assert.GreaterOrEqual(t, zombie.Opens(), 2)
+	assert.True(t, tracker.Unhealthy(0), "unhealthy after MaxFailures")
+
+	tracker.Event(&events.HeartbeatAck{GenericEvent: events.NewGenericEvent(session, 0, 0)})
+	watchdog.Check(t.Context())
+
+	assert.False(t, tracker.Unhealthy(0))
+}
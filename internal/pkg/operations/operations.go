@@ -13,7 +13,10 @@ import (
 	"github.com/disgoorg/disgo/discord"
 	"github.com/disgoorg/disgo/rest"
 	"github.com/disgoorg/snowflake/v2"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/singleflight"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
 )
 
 // APIErrorCodeMaxRoles is the Discord API error code for the maximum number of
@@ -35,10 +38,36 @@ const (
 	requestTimeout = 1 * time.Minute
 )
 
-// RequestContext returns a context bounding a single Discord REST request,
-// and its cancel function.
-func RequestContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), requestTimeout)
+// progressKey is the context key of the function attached by WithProgress.
+type progressKey struct{}
+
+// RequestContext returns a context derived from parent bounding a single
+// Discord REST request, and its cancel function. If parent carries a function
+// attached by WithProgress, it is called now and again on cancel, when the
+// request is over.
+func RequestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(parent, requestTimeout)
+
+	progress, ok := parent.Value(progressKey{}).(func())
+	if !ok {
+		return ctx, cancel
+	}
+
+	progress()
+
+	return ctx, func() {
+		cancel()
+		progress()
+	}
+}
+
+// WithProgress returns a copy of parent carrying progress, which
+// RequestContext calls when each request made with it starts and ends, for
+// callers whose liveness is judged from their progress: a job making several
+// requests, each of which may wait up to requestTimeout in disgo's rate
+// limiter, is then seen progressing between them.
+func WithProgress(parent context.Context, progress func()) context.Context {
+	return context.WithValue(parent, progressKey{}, progress)
 }
 
 // Gateway is a centralized construct to process Discord API-mutating requests
@@ -56,10 +85,17 @@ func NewGateway(client *bot.Client) *Gateway {
 
 // CreateRole creates a new role in the provided guild and adds it to the
 // client cache. Concurrent calls for the same guild and role name are collapsed
-// into a single Discord API request sharing one result.
-func (gateway *Gateway) CreateRole(guildID snowflake.ID, roleName string, roleColor int) (discord.Role, error) {
+// into a single Discord API request sharing one result, made with the context
+// and reason of the first caller.
+func (gateway *Gateway) CreateRole(
+	ctx context.Context,
+	guildID snowflake.ID,
+	roleName string,
+	roleColor int,
+	reason string,
+) (discord.Role, error) {
 	result, err, _ := gateway.group.Do(guildID.String()+"/"+roleName, func() (any, error) {
-		return createRole(gateway.Client, guildID, roleName, roleColor)
+		return createRole(ctx, gateway.Client, guildID, roleName, roleColor, reason)
 	})
 	if err != nil {
 		return discord.Role{}, err
@@ -76,13 +112,16 @@ func (gateway *Gateway) CreateRole(guildID snowflake.ID, roleName string, roleCo
 // LookupGuild returns a discord.Guild from the client's cache. If the guild is
 // not found in the cache, LookupGuild will query the Discord API for the guild
 // and add it to the cache before returning it.
-func LookupGuild(client *bot.Client, guildID snowflake.ID) (discord.Guild, error) {
+func LookupGuild(ctx context.Context, client *bot.Client, guildID snowflake.ID) (guild discord.Guild, err error) {
 	guild, ok := client.Caches.Guild(guildID)
 	if ok {
 		return guild, nil
 	}
 
-	ctx, cancel := RequestContext()
+	ctx, span := tracing.Start(ctx, "operations.LookupGuild", tracing.GuildIDKey.String(guildID.String()))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := RequestContext(ctx)
 	defer cancel()
 
 	restGuild, err := client.Rest.GetGuild(guildID, false, rest.WithCtx(ctx))
@@ -97,12 +136,20 @@ func LookupGuild(client *bot.Client, guildID snowflake.ID) (discord.Guild, error
 
 // AddRoleToMember adds the role associated with the provided roleID to the
 // user associated with the provided userID, in the guild associated with the
-// provided guildID.
-func AddRoleToMember(client *bot.Client, guildID, userID, roleID snowflake.ID) error {
-	ctx, cancel := RequestContext()
+// provided guildID, giving reason in the guild's audit log.
+func AddRoleToMember(
+	ctx context.Context,
+	client *bot.Client,
+	guildID, userID, roleID snowflake.ID,
+	reason string,
+) (err error) {
+	ctx, span := tracing.Start(ctx, "operations.AddRoleToMember", memberRoleAttributes(guildID, userID, roleID)...)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := RequestContext(ctx)
 	defer cancel()
 
-	if err := client.Rest.AddMemberRole(guildID, userID, roleID, rest.WithCtx(ctx)); err != nil {
+	if err := client.Rest.AddMemberRole(guildID, userID, roleID, requestOpts(ctx, reason)...); err != nil {
 		return fmt.Errorf("unable to add ephemeral role: %w", err)
 	}
 
@@ -111,18 +158,48 @@ func AddRoleToMember(client *bot.Client, guildID, userID, roleID snowflake.ID) e
 
 // RemoveRoleFromMember removes the role associated with the provided roleID
 // from the user associated with the provided userID, in the guild associated
-// with the provided guildID.
-func RemoveRoleFromMember(client *bot.Client, guildID, userID, roleID snowflake.ID) error {
-	ctx, cancel := RequestContext()
+// with the provided guildID, giving reason in the guild's audit log.
+func RemoveRoleFromMember(
+	ctx context.Context,
+	client *bot.Client,
+	guildID, userID, roleID snowflake.ID,
+	reason string,
+) (err error) {
+	ctx, span := tracing.Start(ctx, "operations.RemoveRoleFromMember", memberRoleAttributes(guildID, userID, roleID)...)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := RequestContext(ctx)
 	defer cancel()
 
-	if err := client.Rest.RemoveMemberRole(guildID, userID, roleID, rest.WithCtx(ctx)); err != nil {
+	if err := client.Rest.RemoveMemberRole(guildID, userID, roleID, requestOpts(ctx, reason)...); err != nil {
 		return fmt.Errorf("unable to remove ephemeral role: %w", err)
 	}
 
 	return nil
 }
 
+// DeleteRole deletes the role associated with the provided roleID from the
+// guild associated with the provided guildID, giving reason in the guild's
+// audit log, and removes it from the client cache.
+func DeleteRole(ctx context.Context, client *bot.Client, guildID, roleID snowflake.ID, reason string) (err error) {
+	ctx, span := tracing.Start(ctx, "operations.DeleteRole",
+		tracing.GuildIDKey.String(guildID.String()),
+		tracing.RoleIDKey.String(roleID.String()),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := RequestContext(ctx)
+	defer cancel()
+
+	if err := client.Rest.DeleteRole(guildID, roleID, requestOpts(ctx, reason)...); err != nil {
+		return fmt.Errorf("unable to delete ephemeral role: %w", err)
+	}
+
+	client.Caches.RemoveRole(guildID, roleID)
+
+	return nil
+}
+
 // IsDeadlineExceeded checks if the provided error wraps
 // context.DeadlineExceeded.
 func IsDeadlineExceeded(err error) bool {
@@ -182,12 +259,17 @@ func BotHasChannelPermission(client *bot.Client, channel discord.GuildChannel) e
 }
 
 func createRole(
+	ctx context.Context,
 	client *bot.Client,
 	guildID snowflake.ID,
 	roleName string,
 	roleColor int,
-) (discord.Role, error) {
-	ctx, cancel := RequestContext()
+	reason string,
+) (_ discord.Role, err error) {
+	ctx, span := tracing.Start(ctx, "operations.CreateRole", tracing.GuildIDKey.String(guildID.String()))
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := RequestContext(ctx)
 	defer cancel()
 
 	role, err := client.Rest.CreateRole(guildID, discord.RoleCreate{
@@ -195,7 +277,7 @@ func createRole(
 		Color:       roleColor,
 		Hoist:       roleHoist,
 		Mentionable: roleMention,
-	}, rest.WithCtx(ctx))
+	}, requestOpts(ctx, reason)...)
 	if err != nil {
 		return discord.Role{}, fmt.Errorf("unable to create ephemeral role: %w", err)
 	}
@@ -204,3 +286,23 @@ func createRole(
 
 	return *role, nil
 }
+
+// requestOpts returns the options of a mutating request made with ctx,
+// setting its audit log reason unless reason is empty.
+func requestOpts(ctx context.Context, reason string) []rest.RequestOpt {
+	opts := []rest.RequestOpt{rest.WithCtx(ctx)}
+
+	if reason != "" {
+		opts = append(opts, rest.WithReason(reason))
+	}
+
+	return opts
+}
+
+func memberRoleAttributes(guildID, userID, roleID snowflake.ID) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		tracing.GuildIDKey.String(guildID.String()),
+		tracing.UserIDKey.String(userID.String()),
+		tracing.RoleIDKey.String(roleID.String()),
+	}
+}
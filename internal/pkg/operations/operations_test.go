@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"sync"
 	"testing"
 
@@ -72,13 +74,36 @@ func TestLookupGuild(t *testing.T) {
 	session, err := mock.NewSession()
 	require.NoError(t, err)
 
-	_, err = operations.LookupGuild(session, mock.TestGuild)
+	_, err = operations.LookupGuild(t.Context(), session, mock.TestGuild)
 	require.NoError(t, err)
 
-	_, err = operations.LookupGuild(session, mock.TestGuildLarge)
+	_, err = operations.LookupGuild(t.Context(), session, mock.TestGuildLarge)
 	require.NoError(t, err)
 }
 
+func TestRequestContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := operations.RequestContext(t.Context())
+	cancel()
+
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	progressed := 0
+	progressCtx := operations.WithProgress(t.Context(), func() { progressed++ })
+
+	ctx, cancel = operations.RequestContext(progressCtx)
+
+	_, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, 1, progressed, "request start not reported")
+
+	cancel()
+
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.Equal(t, 2, progressed, "request end not reported")
+}
+
 func TestAddRoleToMember(t *testing.T) {
 	t.Parallel()
 
@@ -101,6 +126,60 @@ func TestRemoveRoleFromMember(t *testing.T) {
 	runRoleForMemberTestCases(t, removeRoleFromMemberTestCases(getSession))
 }
 
+func TestDeleteRole(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	require.NoError(t, operations.DeleteRole(t.Context(), session, mock.TestGuild, mock.TestEphemeralRole, ""))
+
+	_, ok := session.Caches.Role(mock.TestGuild, mock.TestEphemeralRole)
+	assert.False(t, ok)
+}
+
+func TestAuditLogReason(t *testing.T) {
+	t.Parallel()
+
+	const reason = "joined voice channel Café"
+
+	var (
+		mutex   sync.Mutex
+		reasons []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// disgo percent-encodes reasons, as Discord expects.
+		decoded, err := url.PathUnescape(r.Header.Get("X-Audit-Log-Reason"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reasons = append(reasons, decoded)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	session.Rest = rest.New(rest.NewClient("", rest.WithURL(server.URL), rest.WithHTTPClient(server.Client())))
+
+	require.NoError(t, operations.AddRoleToMember(t.Context(), session, mock.TestGuild, mock.TestUser, newRoleID, reason))
+	require.NoError(t, operations.RemoveRoleFromMember(t.Context(), session, mock.TestGuild, mock.TestUser, newRoleID, ""))
+	require.NoError(t, operations.DeleteRole(t.Context(), session, mock.TestGuild, mock.TestEphemeralRole, reason))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	assert.Equal(t, []string{reason, "", reason}, reasons)
+}
+
 func TestIsDeadlineExceeded(t *testing.T) {
 	t.Parallel()
 
@@ -195,7 +274,7 @@ func TestBotHasChannelPermission(t *testing.T) {
 func runTestCreateRole(t *testing.T, gateway callbacks.OperationsGateway, roleName string) {
 	t.Helper()
 
-	_, err := gateway.CreateRole(mock.TestGuild, roleName, 0)
+	_, err := gateway.CreateRole(t.Context(), mock.TestGuild, roleName, 0, "")
 	require.NoError(t, err)
 }
 
@@ -271,9 +350,9 @@ func roleForMember(
 
 	switch add {
 	case true:
-		require.NoError(t, operations.AddRoleToMember(session, guildID, userID, roleID))
+		require.NoError(t, operations.AddRoleToMember(t.Context(), session, guildID, userID, roleID, ""))
 	case false:
-		require.NoError(t, operations.RemoveRoleFromMember(session, guildID, userID, roleID))
+		require.NoError(t, operations.RemoveRoleFromMember(t.Context(), session, guildID, userID, roleID, ""))
 	}
 }
 
@@ -0,0 +1,116 @@
+// Package reason provides the localized reasons the bot gives Discord for its
+// role mutations, shown to guild administrators in the guild's audit log.
+package reason
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+)
+
+// DefaultLocale is the locale reasons are given in when the requested locale
+// has no translation.
+const DefaultLocale = discord.LocaleEnglishUS
+
+// Kind is the trigger of a role mutation.
+type Kind int
+
+// Kind enumerations.
+const (
+	// KindJoinedChannel is a member joining a voice channel, given the
+	// channel's name.
+	KindJoinedChannel Kind = iota
+
+	// KindMovedChannel is a member moving to another voice channel, given
+	// the name of the channel moved to.
+	KindMovedChannel
+
+	// KindLeftChannel is a member disconnecting from voice.
+	KindLeftChannel
+
+	// KindChannelUnavailable is a member connecting to a voice channel the
+	// bot can't see.
+	KindChannelUnavailable
+
+	// KindChannelRole is a role being created for a voice channel, given the
+	// channel's name.
+	KindChannelRole
+
+	// KindChannelDeleted is a voice channel being deleted, given the
+	// channel's name.
+	KindChannelDeleted
+
+	// KindOrphanedRole is a role whose voice channel no longer exists.
+	KindOrphanedRole
+)
+
+// translations are the reason formats of each Kind, by base language. Formats
+// of kinds given a channel name take it as their only verb.
+var translations = map[string]map[Kind]string{
+	"en": {
+		KindJoinedChannel:      "joined voice channel %s",
+		KindMovedChannel:       "moved to voice channel %s",
+		KindLeftChannel:        "left voice channel",
+		KindChannelUnavailable: "voice channel unavailable",
+		KindChannelRole:        "ephemeral role for voice channel %s",
+		KindChannelDeleted:     "voice channel %s deleted",
+		KindOrphanedRole:       "voice channel no longer exists",
+	},
+	"de": {
+		KindJoinedChannel:      "ist dem Sprachkanal %s beigetreten",
+		KindMovedChannel:       "ist in den Sprachkanal %s gewechselt",
+		KindLeftChannel:        "hat den Sprachkanal verlassen",
+		KindChannelUnavailable: "Sprachkanal nicht verfügbar",
+		KindChannelRole:        "Ephemere Rolle für Sprachkanal %s",
+		KindChannelDeleted:     "Sprachkanal %s gelöscht",
+		KindOrphanedRole:       "Sprachkanal existiert nicht mehr",
+	},
+	"es": {
+		KindJoinedChannel:      "se unió al canal de voz %s",
+		KindMovedChannel:       "se cambió al canal de voz %s",
+		KindLeftChannel:        "salió del canal de voz",
+		KindChannelUnavailable: "canal de voz no disponible",
+		KindChannelRole:        "rol efímero para el canal de voz %s",
+		KindChannelDeleted:     "canal de voz %s eliminado",
+		KindOrphanedRole:       "el canal de voz ya no existe",
+	},
+	"fr": {
+		KindJoinedChannel:      "a rejoint le salon vocal %s",
+		KindMovedChannel:       "est passé au salon vocal %s",
+		KindLeftChannel:        "a quitté le salon vocal",
+		KindChannelUnavailable: "salon vocal indisponible",
+		KindChannelRole:        "rôle éphémère pour le salon vocal %s",
+		KindChannelDeleted:     "salon vocal %s supprimé",
+		KindOrphanedRole:       "le salon vocal n'existe plus",
+	},
+}
+
+// Format returns the reason for kind in locale, falling back to DefaultLocale
+// for languages without a translation. Regional locales, such as es-ES and
+// es-419, share their language's translation. channelName is ignored by kinds
+// not about a named channel.
+func Format(locale discord.Locale, kind Kind, channelName string) string {
+	formats, ok := translations[baseLanguage(locale)]
+	if !ok {
+		formats = translations[baseLanguage(DefaultLocale)]
+	}
+
+	format, ok := formats[kind]
+	if !ok {
+		return ""
+	}
+
+	if !strings.Contains(format, "%s") {
+		return format
+	}
+
+	return fmt.Sprintf(format, channelName)
+}
+
+// baseLanguage returns the language of locale, without its region.
+func baseLanguage(locale discord.Locale) string {
+	language, _, _ := strings.Cut(locale.Code(), "-")
+
+	return language
+}
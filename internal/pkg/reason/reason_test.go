@@ -0,0 +1,84 @@
+package reason_test
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/reason"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name        string
+		locale      discord.Locale
+		kind        reason.Kind
+		channelName string
+		expected    string
+	}
+
+	testCases := []*testCase{
+		{
+			name:        "default locale",
+			locale:      reason.DefaultLocale,
+			kind:        reason.KindJoinedChannel,
+			channelName: "General",
+			expected:    "joined voice channel General",
+		},
+		{
+			name:     "unset locale",
+			kind:     reason.KindLeftChannel,
+			expected: "left voice channel",
+		},
+		{
+			name:        "untranslated locale",
+			locale:      discord.LocaleJapanese,
+			kind:        reason.KindChannelDeleted,
+			channelName: "General",
+			expected:    "voice channel General deleted",
+		},
+		{
+			name:        "translated locale",
+			locale:      discord.LocaleGerman,
+			kind:        reason.KindMovedChannel,
+			channelName: "Lobby",
+			expected:    "ist in den Sprachkanal Lobby gewechselt",
+		},
+		{
+			name:        "regional locale",
+			locale:      discord.LocaleSpanishLATAM,
+			kind:        reason.KindChannelRole,
+			channelName: "Lobby",
+			expected:    "rol efímero para el canal de voz Lobby",
+		},
+		{
+			name:        "channel name ignored",
+			locale:      discord.LocaleFrench,
+			kind:        reason.KindOrphanedRole,
+			channelName: "Lobby",
+			expected:    "le salon vocal n'existe plus",
+		},
+		{
+			name:        "channel name with verb",
+			kind:        reason.KindJoinedChannel,
+			channelName: "100%s",
+			expected:    "joined voice channel 100%s",
+		},
+		{
+			name:     "unknown kind",
+			kind:     reason.Kind(-1),
+			expected: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, testCase.expected, reason.Format(testCase.locale, testCase.kind, testCase.channelName))
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// Package resume persists the gateway sessions of the process's shards across
+// restarts, so that a restarted process can RESUME them rather than IDENTIFY
+// again.
+//
+// A RESUME replays only the events missed while disconnected, not the
+// GUILD_CREATE events that build the cache on IDENTIFY, so the cache of the
+// resumed shards is persisted along with their sessions and restored before
+// they open.
+package resume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/sharding"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/gorilla/websocket"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/atomicfile"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+)
+
+// Results of an attempt to resume a shard's session, as labeled on
+// monitor.ResumeCounter.
+const (
+	ResultResumed  = "resumed"
+	ResultIdentify = "identify"
+)
+
+// DefaultMaxAge is the default age past which saved sessions are not resumed.
+// Discord only keeps a disconnected session resumable for a short while, and
+// a RESUME it refuses costs a round trip before falling back to IDENTIFY.
+const DefaultMaxAge = 5 * time.Minute
+
+// Errors returned by Load for saved state that can't be resumed.
+var (
+	ErrExpired           = errors.New("saved sessions are too old to resume")
+	ErrShardCountChanged = errors.New("saved sessions are for a different shard count")
+)
+
+// Session is the state needed to resume a shard's gateway session.
+type Session struct {
+	SessionID string `json:"sessionID"`
+	Sequence  int    `json:"sequence"`
+	ResumeURL string `json:"resumeURL"`
+}
+
+// State is the saved state of the process's shards.
+type State struct {
+	SavedAt    time.Time              `json:"savedAt"`
+	ShardCount int                    `json:"shardCount"`
+	Sessions   map[int]Session        `json:"sessions"`
+	SelfUser   *discord.OAuth2User    `json:"selfUser,omitempty"`
+	Guilds     []discord.GatewayGuild `json:"guilds"`
+}
+
+// Suspend closes the client's shards, keeping their sessions resumable, and
+// returns their state. Shards without a session, as when they never became
+// ready, are left out.
+func Suspend(ctx context.Context, client *bot.Client, shardCount int) *State {
+	sessions := make(map[int]Session)
+
+	for shard := range client.ShardManager.Shards() {
+		// Discord invalidates the session of a connection closed normally, so
+		// close with a code that marks the disconnection as temporary. The
+		// session is read after closing so no events are received past it.
+		shard.CloseWithCode(ctx, websocket.CloseServiceRestart, "restarting")
+
+		sessionID, sequence, resumeURL := shard.SessionID(), shard.LastSequenceReceived(), shard.ResumeURL()
+		if sessionID == nil || sequence == nil {
+			continue
+		}
+
+		session := Session{
+			SessionID: *sessionID,
+			Sequence:  *sequence,
+		}
+
+		if resumeURL != nil {
+			session.ResumeURL = *resumeURL
+		}
+
+		sessions[shard.ShardID()] = session
+	}
+
+	return NewState(client, shardCount, sessions)
+}
+
+// NewState returns the state of the shards with sessions, along with the
+// cached guilds they are responsible for.
+func NewState(client *bot.Client, shardCount int, sessions map[int]Session) *State {
+	state := &State{
+		SavedAt:    time.Now(),
+		ShardCount: shardCount,
+		Sessions:   sessions,
+	}
+
+	if selfUser, ok := client.Caches.SelfUser(); ok {
+		state.SelfUser = &selfUser
+	}
+
+	for guild := range client.Caches.Guilds() {
+		if _, ok := sessions[sharding.ShardIDByGuild(guild.ID, shardCount)]; !ok {
+			continue
+		}
+
+		state.Guilds = append(state.Guilds, discord.GatewayGuild{
+			RestGuild: discord.RestGuild{
+				Guild: guild,
+				Roles: slices.Collect(client.Caches.Roles(guild.ID)),
+			},
+			VoiceStates: slices.Collect(client.Caches.VoiceStates(guild.ID)),
+			Members:     slices.Collect(client.Caches.Members(guild.ID)),
+			Channels:    slices.Collect(client.Caches.ChannelsForGuild(guild.ID)),
+		})
+	}
+
+	return state
+}
+
+// Save writes the state to the file at path. The file is replaced only once
+// the state is fully written, so that a kill mid-write, as at the end of the
+// shutdown grace period, doesn't leave it truncated.
+func (state *State) Save(path string) error {
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to marshal session state: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(path, contents); err != nil {
+		return fmt.Errorf("unable to write session state: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads the state saved to the file at path by Save and removes the
+// file, since a session can be resumed only once. A missing file is not an
+// error: there is nothing to resume on first start, and nil is returned.
+//
+// State saved longer than maxAge ago returns ErrExpired, and state saved for
+// another shard count, whose shards are responsible for other guilds, returns
+// ErrShardCountChanged.
+func Load(path string, maxAge time.Duration, shardCount int) (*State, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("unable to read session state: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return nil, fmt.Errorf("unable to remove session state: %w", err)
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(contents, state); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal session state: %w", err)
+	}
+
+	if time.Since(state.SavedAt) > maxAge {
+		return nil, ErrExpired
+	}
+
+	if state.ShardCount != shardCount {
+		return nil, ErrShardCountChanged
+	}
+
+	return state, nil
+}
+
+// ShardStates returns the sessions to resume of shardIDs, for
+// sharding.WithShardIDsWithStates. Shards without a saved session IDENTIFY.
+func (state *State) ShardStates(shardIDs []int) map[int]sharding.ShardState {
+	shardStates := make(map[int]sharding.ShardState, len(shardIDs))
+
+	for _, shardID := range shardIDs {
+		session := state.Sessions[shardID]
+
+		shardStates[shardID] = sharding.ShardState{
+			SessionID: session.SessionID,
+			Sequence:  session.Sequence,
+			ResumeURL: session.ResumeURL,
+		}
+	}
+
+	return shardStates
+}
+
+// Config contains fields for configuring a Resumer.
+type Config struct {
+	Log     *slog.Logger
+	Metrics *monitor.Metrics
+}
+
+// Resumer restores the cache of the shards resuming saved sessions, and
+// tracks whether they resume. A shard whose session is refused receives a
+// Ready event instead of a Resumed event, and its restored guilds are dropped
+// from the cache to be rebuilt from the GUILD_CREATE events that follow.
+type Resumer struct {
+	*Config
+
+	mu      sync.Mutex
+	pending map[int][]snowflake.ID
+}
+
+// NewResumer returns a new *Resumer configured using the provided config.
+func NewResumer(config *Config) *Resumer {
+	return &Resumer{
+		Config:  config,
+		pending: make(map[int][]snowflake.ID),
+	}
+}
+
+// Restore adds the guilds saved in state for the shards among shardIDs with a
+// session to resume to the client's cache. It must be called before the
+// shards are opened.
+func (resumer *Resumer) Restore(client *bot.Client, state *State, shardIDs []int) {
+	resumer.mu.Lock()
+	defer resumer.mu.Unlock()
+
+	for _, shardID := range shardIDs {
+		if _, ok := state.Sessions[shardID]; ok {
+			resumer.pending[shardID] = []snowflake.ID{}
+		}
+	}
+
+	if state.SelfUser != nil {
+		client.Caches.SetSelfUser(*state.SelfUser)
+	}
+
+	for i := range state.Guilds {
+		guild := &state.Guilds[i]
+		shardID := sharding.ShardIDByGuild(guild.ID, state.ShardCount)
+
+		guildIDs, ok := resumer.pending[shardID]
+		if !ok {
+			continue
+		}
+
+		restoreGuild(client, guild)
+
+		resumer.pending[shardID] = append(guildIDs, guild.ID)
+		resumer.Metrics.GuildRestored(shardID, guild)
+	}
+}
+
+// Resumed is the callback function for the Resumed event from Discord.
+func (resumer *Resumer) Resumed(event *events.Resumed) {
+	if _, ok := resumer.done(event.ShardID()); !ok {
+		return
+	}
+
+	resumer.Log.Info("Resumed session", "shardID", event.ShardID())
+	resumer.Metrics.ResumeCounter.WithLabelValues(monitor.ShardLabel(event.ShardID()), ResultResumed).Inc()
+}
+
+// Ready is the callback function for the Ready event from Discord.
+func (resumer *Resumer) Ready(event *events.Ready) {
+	guildIDs, ok := resumer.done(event.ShardID())
+	if !ok {
+		return
+	}
+
+	client := event.Client()
+
+	for _, guildID := range guildIDs {
+		dropGuild(client, guildID)
+		resumer.Metrics.GuildDropped(guildID)
+	}
+
+	resumer.Log.Warn("Unable to resume session: identified instead", "shardID", event.ShardID())
+	resumer.Metrics.ResumeCounter.WithLabelValues(monitor.ShardLabel(event.ShardID()), ResultIdentify).Inc()
+}
+
+// done returns the guilds restored for shardID, if it was resuming a session,
+// and stops tracking it.
+func (resumer *Resumer) done(shardID int) ([]snowflake.ID, bool) {
+	resumer.mu.Lock()
+	defer resumer.mu.Unlock()
+
+	guildIDs, ok := resumer.pending[shardID]
+	delete(resumer.pending, shardID)
+
+	return guildIDs, ok
+}
+
+func restoreGuild(client *bot.Client, guild *discord.GatewayGuild) {
+	client.Caches.AddGuild(guild.Guild)
+
+	for _, role := range guild.Roles {
+		role.GuildID = guild.ID
+		client.Caches.AddRole(role)
+	}
+
+	for _, channel := range guild.Channels {
+		client.Caches.AddChannel(channel)
+	}
+
+	for _, member := range guild.Members {
+		member.GuildID = guild.ID
+		client.Caches.AddMember(member)
+	}
+
+	for _, voiceState := range guild.VoiceStates {
+		voiceState.GuildID = guild.ID
+		client.Caches.AddVoiceState(voiceState)
+	}
+}
+
+func dropGuild(client *bot.Client, guildID snowflake.ID) {
+	client.Caches.RemoveVoiceStatesByGuildID(guildID)
+	client.Caches.RemoveMembersByGuildID(guildID)
+	client.Caches.RemoveChannelsByGuildID(guildID)
+	client.Caches.RemoveRolesByGuildID(guildID)
+	client.Caches.RemoveGuild(guildID)
+}
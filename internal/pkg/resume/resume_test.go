@@ -0,0 +1,156 @@
+package resume_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/cache"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/sharding"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/monitor"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/resume"
+)
+
+// testShardCount puts mock.TestGuild and mock.TestGuildLarge on shard 0.
+const testShardCount = 2
+
+var testSession = resume.Session{SessionID: "session0", Sequence: 42, ResumeURL: "wss://resume.discord.gg"}
+
+func TestState(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	state := resume.NewState(session, testShardCount, map[int]resume.Session{1: {SessionID: "session1"}})
+	assert.Empty(t, state.Guilds, "only guilds of shards with a session")
+
+	state = resume.NewState(session, testShardCount, map[int]resume.Session{0: testSession})
+	require.Len(t, state.Guilds, 2)
+	require.NoError(t, state.Save(path))
+
+	loaded, err := resume.Load(path, resume.DefaultMaxAge, testShardCount)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Equal(t, state.Sessions, loaded.Sessions)
+	assert.Equal(t, state.Guilds[0].ID, loaded.Guilds[0].ID)
+	assert.Len(t, loaded.Guilds[0].Channels, len(state.Guilds[0].Channels))
+	assert.Len(t, loaded.Guilds[0].Members, len(state.Guilds[0].Members))
+
+	assert.Equal(t, map[int]sharding.ShardState{
+		0: {SessionID: "session0", Sequence: 42, ResumeURL: "wss://resume.discord.gg"},
+		1: {},
+	}, loaded.ShardStates([]int{0, 1}))
+
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist, "loaded state is removed")
+
+	loaded, err = resume.Load(path, resume.DefaultMaxAge, testShardCount)
+	require.NoError(t, err)
+	assert.Nil(t, loaded, "missing state")
+
+	require.NoError(t, state.Save(path))
+
+	_, err = resume.Load(path, resume.DefaultMaxAge, testShardCount+1)
+	require.ErrorIs(t, err, resume.ErrShardCountChanged)
+
+	state.SavedAt = time.Now().Add(-2 * resume.DefaultMaxAge)
+	require.NoError(t, state.Save(path))
+
+	_, err = resume.Load(path, resume.DefaultMaxAge, testShardCount)
+	require.ErrorIs(t, err, resume.ErrExpired)
+}
+
+func TestResumer(t *testing.T) {
+	t.Parallel()
+
+	session, err := mock.NewSession()
+	require.NoError(t, err)
+
+	state := resume.NewState(session, testShardCount, map[int]resume.Session{0: testSession})
+	metrics := monitor.NewMetrics(&monitor.Config{Log: mock.NewLogger()})
+
+	testCases := []struct {
+		name    string
+		event   func(client *bot.Client, resumer *resume.Resumer)
+		result  string
+		restore bool
+	}{
+		{
+			name: "resumed",
+			event: func(client *bot.Client, resumer *resume.Resumer) {
+				resumer.Resumed(&events.Resumed{GenericEvent: events.NewGenericEvent(client, 0, 0)})
+			},
+			result:  resume.ResultResumed,
+			restore: true,
+		},
+		{
+			name: "identify",
+			event: func(client *bot.Client, resumer *resume.Resumer) {
+				resumer.Ready(&events.Ready{GenericEvent: events.NewGenericEvent(client, 0, 0)})
+			},
+			result:  resume.ResultIdentify,
+			restore: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := &bot.Client{
+				Caches: cache.New(cache.WithCaches(
+					cache.FlagGuilds,
+					cache.FlagChannels,
+					cache.FlagRoles,
+					cache.FlagVoiceStates,
+					cache.FlagMembers,
+				)),
+			}
+
+			resumer := resume.NewResumer(&resume.Config{
+				Log:     mock.NewLogger(),
+				Metrics: metrics,
+			})
+
+			// Shard 1 has no saved session, so its events are not counted.
+			resumer.Restore(client, state, []int{0, 1})
+
+			_, ok := client.Caches.Guild(mock.TestGuild)
+			require.True(t, ok)
+
+			selfMember, ok := client.Caches.SelfMember(mock.TestGuild)
+			require.True(t, ok)
+			assert.Equal(t, mock.TestUserBot, selfMember.User.ID)
+
+			channel, ok := client.Caches.Channel(mock.TestChannel)
+			require.True(t, ok)
+			assert.Equal(t, mock.TestChannelName, channel.Name())
+
+			_, ok = client.Caches.Role(mock.TestGuild, mock.TestEphemeralRole)
+			require.True(t, ok)
+
+			counter := metrics.ResumeCounter.WithLabelValues(monitor.ShardLabel(0), testCase.result)
+			before := testutil.ToFloat64(counter)
+
+			testCase.event(client, resumer)
+
+			// Only the first Resumed or Ready event of a shard settles it.
+			resumer.Ready(&events.Ready{GenericEvent: events.NewGenericEvent(client, 0, 0)})
+			resumer.Resumed(&events.Resumed{GenericEvent: events.NewGenericEvent(client, 0, 1)})
+
+			assert.Equal(t, before+1, testutil.ToFloat64(counter))
+
+			_, ok = client.Caches.Guild(mock.TestGuild)
+			assert.Equal(t, testCase.restore, ok)
+		})
+	}
+}
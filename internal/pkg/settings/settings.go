@@ -0,0 +1,232 @@
+// Package settings provides storage for per-guild bot settings.
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/atomicfile"
+)
+
+// Guild contains the settings for a single guild.
+type Guild struct {
+	// NotificationChannelID is the channel bot notifications for the guild,
+	// such as configuration problems, are posted to. When nil, the guild
+	// owner is notified by direct message instead.
+	NotificationChannelID *snowflake.ID `json:"notificationChannelID,omitempty"`
+
+	// AuditLogChannelID is the channel the guild's role mutations are
+	// mirrored to. When nil, they are only kept in the bot's audit log.
+	AuditLogChannelID *snowflake.ID `json:"auditLogChannelID,omitempty"`
+
+	// AuditLogReasonsDisabled stops the bot from giving reasons for its role
+	// mutations in the guild's Discord audit log.
+	AuditLogReasonsDisabled bool `json:"auditLogReasonsDisabled,omitempty"`
+
+	// AuditLogReasonLocale is the locale audit log reasons are given in. When
+	// empty, the guild's preferred locale is used.
+	AuditLogReasonLocale discord.Locale `json:"auditLogReasonLocale,omitempty"`
+
+	// JoinedAt is when the bot joined the guild.
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// Store is a concurrency-safe store of per-guild settings. Once opened on a
+// local file with Open, the settings are saved to the file on every change, so
+// they survive a restart. The zero value is ready to use.
+type Store struct {
+	mu     sync.RWMutex
+	guilds map[snowflake.ID]Guild
+	path   string
+}
+
+// NewStore returns a new, empty *Store.
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Guild returns the settings stored for guildID.
+func (store *Store) Guild(guildID snowflake.ID) (Guild, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	guild, ok := store.guilds[guildID]
+
+	return guild, ok
+}
+
+// Init stores settings for guildID unless the guild already has settings, and
+// reports whether it did. It is used when the bot joins a guild, so that
+// settings configured before the join was processed aren't replaced. A
+// guild's settings are deleted when the bot leaves it, so a rejoin starts
+// from defaults.
+//
+// Like every change, the settings are stored in memory even if saving them to
+// the store's file fails.
+func (store *Store) Init(guildID snowflake.ID, guild Guild) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.guilds[guildID]; ok {
+		return false, nil
+	}
+
+	return true, store.set(guildID, guild)
+}
+
+// Set stores settings for guildID, replacing any existing settings.
+func (store *Store) Set(guildID snowflake.ID, guild Guild) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.set(guildID, guild)
+}
+
+// Delete removes the settings stored for guildID.
+func (store *Store) Delete(guildID snowflake.ID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.guilds[guildID]; !ok {
+		return nil
+	}
+
+	delete(store.guilds, guildID)
+
+	return store.save()
+}
+
+// NotificationChannel returns the notification channel configured for
+// guildID, if any.
+func (store *Store) NotificationChannel(guildID snowflake.ID) (snowflake.ID, bool) {
+	guild, ok := store.Guild(guildID)
+	if !ok || guild.NotificationChannelID == nil {
+		return 0, false
+	}
+
+	return *guild.NotificationChannelID, true
+}
+
+// SetNotificationChannel sets the notification channel for guildID, creating
+// its settings if it has none. A nil channelID notifies the guild owner by
+// direct message instead.
+func (store *Store) SetNotificationChannel(guildID snowflake.ID, channelID *snowflake.ID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	guild := store.guilds[guildID]
+	guild.NotificationChannelID = channelID
+
+	return store.set(guildID, guild)
+}
+
+// AuditLogChannel returns the audit log channel configured for guildID, if
+// any.
+func (store *Store) AuditLogChannel(guildID snowflake.ID) (snowflake.ID, bool) {
+	guild, ok := store.Guild(guildID)
+	if !ok || guild.AuditLogChannelID == nil {
+		return 0, false
+	}
+
+	return *guild.AuditLogChannelID, true
+}
+
+// SetAuditLogChannel sets the audit log channel for guildID, creating its
+// settings if it has none. A nil channelID stops mirroring.
+func (store *Store) SetAuditLogChannel(guildID snowflake.ID, channelID *snowflake.ID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	guild := store.guilds[guildID]
+	guild.AuditLogChannelID = channelID
+
+	return store.set(guildID, guild)
+}
+
+// AuditLogReasons reports whether audit log reasons are enabled for guildID,
+// and the locale configured for them, if any. Reasons are enabled for guilds
+// without settings.
+func (store *Store) AuditLogReasons(guildID snowflake.ID) (bool, discord.Locale) {
+	guild, _ := store.Guild(guildID)
+
+	return !guild.AuditLogReasonsDisabled, guild.AuditLogReasonLocale
+}
+
+// SetAuditLogReasons enables or disables audit log reasons for guildID, and
+// sets the locale they're given in, creating its settings if it has none. An
+// empty locale uses the guild's preferred locale.
+func (store *Store) SetAuditLogReasons(guildID snowflake.ID, enabled bool, locale discord.Locale) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	guild := store.guilds[guildID]
+	guild.AuditLogReasonsDisabled = !enabled
+	guild.AuditLogReasonLocale = locale
+
+	return store.set(guildID, guild)
+}
+
+// Open restores the settings saved to the file at path, and saves them to it
+// on every change from now on. A missing file is not an error: it is created
+// on the first change.
+func (store *Store) Open(path string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	contents, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to read settings: %w", err)
+	}
+
+	if err == nil {
+		guilds := make(map[snowflake.ID]Guild)
+		if err := json.Unmarshal(contents, &guilds); err != nil {
+			return fmt.Errorf("unable to unmarshal settings: %w", err)
+		}
+
+		store.guilds = guilds
+	}
+
+	store.path = path
+
+	return nil
+}
+
+// set stores settings for guildID and saves the store. The caller must hold
+// store.mu.
+func (store *Store) set(guildID snowflake.ID, guild Guild) error {
+	if store.guilds == nil {
+		store.guilds = make(map[snowflake.ID]Guild)
+	}
+
+	store.guilds[guildID] = guild
+
+	return store.save()
+}
+
+// save writes the settings to the store's file, replacing it only once they
+// are fully written, so that a crash mid-write doesn't lose them. It is a no-op if the
+// store hasn't been opened. The caller must hold store.mu.
+func (store *Store) save() error {
+	if store.path == "" {
+		return nil
+	}
+
+	contents, err := json.Marshal(store.guilds)
+	if err != nil {
+		return fmt.Errorf("unable to marshal settings: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(store.path, contents); err != nil {
+		return fmt.Errorf("unable to write settings: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package settings_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/settings"
+)
+
+const (
+	testGuildID   snowflake.ID = 1000
+	testChannelID snowflake.ID = 1001
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	store := settings.NewStore()
+
+	_, ok := store.Guild(testGuildID)
+	require.False(t, ok)
+
+	_, ok = store.NotificationChannel(testGuildID)
+	require.False(t, ok)
+
+	joinedAt := time.Now()
+
+	initialized, err := store.Init(testGuildID, settings.Guild{JoinedAt: joinedAt})
+	require.NoError(t, err)
+	require.True(t, initialized)
+
+	initialized, err = store.Init(testGuildID, settings.Guild{})
+	require.NoError(t, err)
+	require.False(t, initialized, "Init overwrote existing settings")
+
+	guild, ok := store.Guild(testGuildID)
+	require.True(t, ok)
+	assert.Equal(t, joinedAt, guild.JoinedAt)
+
+	_, ok = store.NotificationChannel(testGuildID)
+	require.False(t, ok)
+
+	guild.NotificationChannelID = new(testChannelID)
+	require.NoError(t, store.Set(testGuildID, guild))
+
+	channelID, ok := store.NotificationChannel(testGuildID)
+	require.True(t, ok)
+	assert.Equal(t, testChannelID, channelID)
+
+	require.NoError(t, store.Delete(testGuildID))
+
+	_, ok = store.Guild(testGuildID)
+	require.False(t, ok)
+}
+
+func TestStore_AuditLogChannel(t *testing.T) {
+	t.Parallel()
+
+	store := settings.NewStore()
+
+	_, ok := store.AuditLogChannel(testGuildID)
+	require.False(t, ok)
+
+	require.NoError(t, store.SetAuditLogChannel(testGuildID, new(testChannelID)))
+
+	channelID, ok := store.AuditLogChannel(testGuildID)
+	require.True(t, ok)
+	assert.Equal(t, testChannelID, channelID)
+
+	// Setting the channel created the guild's settings, which Init keeps.
+	initialized, err := store.Init(testGuildID, settings.Guild{})
+	require.NoError(t, err)
+	require.False(t, initialized)
+
+	require.NoError(t, store.SetAuditLogChannel(testGuildID, nil))
+
+	_, ok = store.AuditLogChannel(testGuildID)
+	require.False(t, ok)
+}
+
+func TestStore_NotificationChannel(t *testing.T) {
+	t.Parallel()
+
+	store := settings.NewStore()
+
+	_, ok := store.NotificationChannel(testGuildID)
+	require.False(t, ok)
+
+	require.NoError(t, store.SetNotificationChannel(testGuildID, new(testChannelID)))
+
+	channelID, ok := store.NotificationChannel(testGuildID)
+	require.True(t, ok)
+	assert.Equal(t, testChannelID, channelID)
+
+	require.NoError(t, store.SetNotificationChannel(testGuildID, nil))
+
+	_, ok = store.NotificationChannel(testGuildID)
+	require.False(t, ok)
+}
+
+func TestStore_AuditLogReasons(t *testing.T) {
+	t.Parallel()
+
+	store := settings.NewStore()
+
+	enabled, locale := store.AuditLogReasons(testGuildID)
+	assert.True(t, enabled)
+	assert.Empty(t, locale)
+
+	require.NoError(t, store.SetAuditLogReasons(testGuildID, false, discord.LocaleGerman))
+
+	enabled, locale = store.AuditLogReasons(testGuildID)
+	assert.False(t, enabled)
+	assert.Equal(t, discord.LocaleGerman, locale)
+
+	require.NoError(t, store.SetAuditLogReasons(testGuildID, true, ""))
+
+	enabled, locale = store.AuditLogReasons(testGuildID)
+	assert.True(t, enabled)
+	assert.Empty(t, locale)
+}
+
+func TestStore_zeroValue(t *testing.T) {
+	t.Parallel()
+
+	store := &settings.Store{}
+
+	require.NoError(t, store.Set(testGuildID, settings.Guild{}))
+
+	_, ok := store.Guild(testGuildID)
+	require.True(t, ok)
+}
+
+func TestStore_Open(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "settings.json")
+
+	store := settings.NewStore()
+	require.NoError(t, store.Open(path), "missing file treated as an error")
+
+	require.NoError(t, store.SetAuditLogChannel(testGuildID, new(testChannelID)))
+	require.NoError(t, store.SetAuditLogReasons(testGuildID+1, false, discord.LocaleGerman))
+
+	restored := settings.NewStore()
+	require.NoError(t, restored.Open(path))
+
+	channelID, ok := restored.AuditLogChannel(testGuildID)
+	require.True(t, ok)
+	assert.Equal(t, testChannelID, channelID)
+
+	enabled, locale := restored.AuditLogReasons(testGuildID + 1)
+	assert.False(t, enabled)
+	assert.Equal(t, discord.LocaleGerman, locale)
+
+	require.NoError(t, restored.Delete(testGuildID))
+
+	restored = settings.NewStore()
+	require.NoError(t, restored.Open(path))
+
+	_, ok = restored.Guild(testGuildID)
+	assert.False(t, ok, "deleted settings restored")
+}
+
+func TestStore_OpenInvalid(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "settings.json")
+	require.NoError(t, os.WriteFile(path, []byte("invalid"), 0o600))
+
+	require.Error(t, settings.NewStore().Open(path))
+}
@@ -0,0 +1,80 @@
+package shards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// fileLock is an IdentifyLock on lock files in a directory shared by the
+// processes, such as on a single host or a shared volume.
+type fileLock struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[int]*os.File
+}
+
+// NewFileLock returns an IdentifyLock on a lock file per bucket in dir, which
+// is created if missing. The locks are advisory locks on the files, released
+// by the operating system if their holder exits without releasing them.
+func NewFileLock(dir string) (IdentifyLock, error) {
+	if !fileLocksSupported {
+		return nil, fmt.Errorf("unable to use identify lock files: %w", errors.ErrUnsupported)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("unable to create identify lock directory: %w", err)
+	}
+
+	return &fileLock{
+		dir:   dir,
+		files: make(map[int]*os.File),
+	}, nil
+}
+
+func (lock *fileLock) Acquire(ctx context.Context, bucket int) error {
+	file, err := os.OpenFile(lock.path(bucket), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open identify lock file: %w", err)
+	}
+
+	// Each acquisition locks its own open file, so shards of the same process
+	// in the same bucket exclude each other too.
+	err = pollAcquire(ctx, func() (bool, error) {
+		return tryLockFile(file)
+	})
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	lock.files[bucket] = file
+
+	return nil
+}
+
+func (lock *fileLock) Release(_ context.Context, bucket int) error {
+	lock.mu.Lock()
+	file, ok := lock.files[bucket]
+	delete(lock.files, bucket)
+	lock.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// Closing the file releases its lock.
+	return file.Close()
+}
+
+func (lock *fileLock) path(bucket int) string {
+	return filepath.Join(lock.dir, "identify-"+strconv.Itoa(bucket)+".lock")
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package shards
+
+import (
+	"errors"
+	"os"
+)
+
+const fileLocksSupported = false
+
+// tryLockFile is unsupported outside of Unix.
+func tryLockFile(*os.File) (bool, error) {
+	return false, errors.ErrUnsupported
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package shards
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const fileLocksSupported = true
+
+// tryLockFile takes an exclusive lock on file without blocking, and reports
+// whether it did.
+func tryLockFile(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unable to lock identify lock file: %w", err)
+}
@@ -0,0 +1,140 @@
+package shards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/gateway"
+)
+
+// DefaultIdentifyInterval is how long Discord requires between IDENTIFYs in
+// the same max_concurrency bucket.
+const DefaultIdentifyInterval = 5 * time.Second
+
+const (
+	// identifyPollInterval is how often a lock held elsewhere is retried.
+	identifyPollInterval = 250 * time.Millisecond
+
+	// identifyReleaseTimeout bounds releasing a bucket's lock.
+	identifyReleaseTimeout = 10 * time.Second
+)
+
+// IdentifyLock is a lock on each IDENTIFY bucket shared by every process of
+// the bot, so that processes starting in parallel don't IDENTIFY in the same
+// bucket at once and have Discord invalidate the colliding sessions.
+type IdentifyLock interface {
+	// Acquire blocks until the caller holds the lock on bucket, or ctx is
+	// done.
+	Acquire(ctx context.Context, bucket int) error
+
+	// Release releases the caller's lock on bucket.
+	Release(ctx context.Context, bucket int) error
+}
+
+// IdentifyRateLimiterConfig contains fields for configuring an
+// IdentifyRateLimiter.
+type IdentifyRateLimiterConfig struct {
+	Log  *slog.Logger
+	Lock IdentifyLock
+
+	// MaxConcurrency is the bot's max_concurrency: shards are bucketed by
+	// shard_id % MaxConcurrency. It defaults to 1.
+	MaxConcurrency int
+
+	// Interval is how long a bucket's lock is held after an IDENTIFY. It
+	// defaults to DefaultIdentifyInterval.
+	Interval time.Duration
+}
+
+// IdentifyRateLimiter is a gateway.IdentifyRateLimiter that spaces out
+// IDENTIFYs across processes, rather than only within one as disgo's does:
+// each shard takes its bucket's IdentifyLock to IDENTIFY, and the lock is
+// released only once Interval has passed.
+type IdentifyRateLimiter struct {
+	*IdentifyRateLimiterConfig
+
+	releases sync.WaitGroup
+}
+
+var _ gateway.IdentifyRateLimiter = (*IdentifyRateLimiter)(nil)
+
+// NewIdentifyRateLimiter returns a new *IdentifyRateLimiter configured using
+// the provided config.
+func NewIdentifyRateLimiter(config *IdentifyRateLimiterConfig) *IdentifyRateLimiter {
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = gateway.DefaultMaxConcurrency
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = DefaultIdentifyInterval
+	}
+
+	return &IdentifyRateLimiter{IdentifyRateLimiterConfig: config}
+}
+
+// Wait blocks until shardID's bucket is free to IDENTIFY in.
+func (limiter *IdentifyRateLimiter) Wait(ctx context.Context, shardID int) error {
+	bucket := gateway.MaxConcurrencyKey(shardID, limiter.MaxConcurrency)
+
+	if err := limiter.Lock.Acquire(ctx, bucket); err != nil {
+		return fmt.Errorf("unable to acquire identify lock for bucket %d: %w", bucket, err)
+	}
+
+	return nil
+}
+
+// Unlock releases shardID's bucket once the interval has passed, without
+// blocking the caller.
+func (limiter *IdentifyRateLimiter) Unlock(shardID int) {
+	bucket := gateway.MaxConcurrencyKey(shardID, limiter.MaxConcurrency)
+
+	limiter.releases.Go(func() {
+		time.Sleep(limiter.Interval)
+
+		ctx, cancel := context.WithTimeout(context.Background(), identifyReleaseTimeout)
+		defer cancel()
+
+		if err := limiter.Lock.Release(ctx, bucket); err != nil {
+			limiter.Log.Warn("unable to release identify lock", "bucket", bucket, "error", err)
+		}
+	})
+}
+
+// Close waits for pending releases, or for ctx to be done.
+func (limiter *IdentifyRateLimiter) Close(ctx context.Context) {
+	released := make(chan struct{})
+
+	go func() {
+		limiter.releases.Wait()
+		close(released)
+	}()
+
+	select {
+	case <-released:
+	case <-ctx.Done():
+	}
+}
+
+// pollAcquire calls tryAcquire until it acquires the lock or ctx is done,
+// returning the last error tryAcquire failed with alongside ctx's.
+func pollAcquire(ctx context.Context, tryAcquire func() (bool, error)) error {
+	ticker := time.NewTicker(identifyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := tryAcquire()
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
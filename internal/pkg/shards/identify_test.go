@@ -0,0 +1,104 @@
+package shards_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/shards"
+)
+
+const (
+	testIdentifyInterval = 50 * time.Millisecond
+	testLockTimeout      = 100 * time.Millisecond
+)
+
+func TestIdentifyRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := shards.NewIdentifyRateLimiter(&shards.IdentifyRateLimiterConfig{
+		Log:            mock.NewLogger(),
+		Lock:           shards.NewLeases(0).Lock(),
+		MaxConcurrency: 2,
+		Interval:       testIdentifyInterval,
+	})
+
+	require.NoError(t, limiter.Wait(t.Context(), 0))
+
+	// Shard 1 is in another bucket, so it doesn't wait on shard 0.
+	require.NoError(t, limiter.Wait(t.Context(), 1))
+
+	// Shard 2 is in shard 0's bucket, so it waits until the interval after
+	// shard 0's IDENTIFY has passed.
+	ctx, cancel := context.WithTimeout(t.Context(), testLockTimeout)
+	defer cancel()
+
+	require.ErrorIs(t, limiter.Wait(ctx, 2), context.DeadlineExceeded)
+
+	start := time.Now()
+
+	limiter.Unlock(0)
+	require.NoError(t, limiter.Wait(t.Context(), 2))
+	assert.GreaterOrEqual(t, time.Since(start), testIdentifyInterval)
+
+	limiter.Unlock(1)
+	limiter.Unlock(2)
+
+	ctx, cancel = context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	limiter.Close(ctx)
+	require.NoError(t, ctx.Err())
+}
+
+func TestLeases(t *testing.T) {
+	t.Parallel()
+
+	leases := shards.NewLeases(testLockTimeout)
+
+	require.True(t, leases.TryAcquire(0, "a"))
+	require.True(t, leases.TryAcquire(0, "a"), "renewal")
+	require.False(t, leases.TryAcquire(0, "b"))
+	require.True(t, leases.TryAcquire(1, "b"))
+
+	leases.Release(0, "b")
+	require.False(t, leases.TryAcquire(0, "b"), "release by another holder")
+
+	leases.Release(0, "a")
+	require.True(t, leases.TryAcquire(0, "b"))
+
+	time.Sleep(2 * testLockTimeout)
+	require.True(t, leases.TryAcquire(0, "a"), "expired")
+}
+
+func TestNewFileLock(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	lock, err := shards.NewFileLock(dir)
+	require.NoError(t, err)
+
+	// A second lock on the directory stands in for another process.
+	other, err := shards.NewFileLock(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, lock.Acquire(t.Context(), 0))
+	require.NoError(t, other.Acquire(t.Context(), 1))
+
+	ctx, cancel := context.WithTimeout(t.Context(), testLockTimeout)
+	defer cancel()
+
+	require.ErrorIs(t, other.Acquire(ctx, 0), context.DeadlineExceeded)
+
+	require.NoError(t, lock.Release(t.Context(), 0))
+	require.NoError(t, other.Acquire(t.Context(), 0))
+
+	require.NoError(t, other.Release(t.Context(), 0))
+	require.NoError(t, other.Release(t.Context(), 1))
+	require.NoError(t, other.Release(t.Context(), 1), "release of a bucket not held")
+}
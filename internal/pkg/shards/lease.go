@@ -0,0 +1,140 @@
+package shards
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseTTL is how long an IDENTIFY bucket lease lasts unless released.
+const DefaultLeaseTTL = 30 * time.Second
+
+// TryAcquireFunc takes the lease on bucket for holder, or renews it if holder
+// already has it, and reports whether it did.
+type TryAcquireFunc func(ctx context.Context, bucket int, holder string) (bool, error)
+
+// ReleaseFunc gives up holder's lease on bucket.
+type ReleaseFunc func(ctx context.Context, bucket int, holder string) error
+
+// leaseLock is an IdentifyLock taking leases on buckets.
+type leaseLock struct {
+	tryAcquire TryAcquireFunc
+	release    ReleaseFunc
+
+	mu      sync.Mutex
+	holders map[int]string
+}
+
+// NewLeaseLock returns an IdentifyLock that takes a lease on a bucket with
+// tryAcquire, retrying while the lease is held elsewhere, and gives it up with
+// release. Each acquisition holds its lease under a new random holder ID, so
+// shards of the same process in the same bucket exclude each other too.
+func NewLeaseLock(tryAcquire TryAcquireFunc, release ReleaseFunc) IdentifyLock {
+	return &leaseLock{
+		tryAcquire: tryAcquire,
+		release:    release,
+		holders:    make(map[int]string),
+	}
+}
+
+func (lock *leaseLock) Acquire(ctx context.Context, bucket int) error {
+	holder := rand.Text()
+
+	err := pollAcquire(ctx, func() (bool, error) {
+		return lock.tryAcquire(ctx, bucket, holder)
+	})
+	if err != nil {
+		return err
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+
+	lock.holders[bucket] = holder
+
+	return nil
+}
+
+func (lock *leaseLock) Release(ctx context.Context, bucket int) error {
+	lock.mu.Lock()
+	holder, ok := lock.holders[bucket]
+	delete(lock.holders, bucket)
+	lock.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return lock.release(ctx, bucket, holder)
+}
+
+// Leases is a concurrency-safe table of IDENTIFY bucket leases. One process
+// serves it on the identify lock API for the others to coordinate through. A
+// lease not released within its TTL expires, so a holder that crashed doesn't
+// block its bucket for good.
+type Leases struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	leases map[int]lease
+}
+
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+// NewLeases returns a new, empty *Leases whose leases last ttl. It defaults to
+// DefaultLeaseTTL.
+func NewLeases(ttl time.Duration) *Leases {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+
+	return &Leases{
+		ttl:    ttl,
+		leases: make(map[int]lease),
+	}
+}
+
+// TryAcquire takes the lease on bucket for holder, or renews it if holder
+// already has it, and reports whether it did.
+func (leases *Leases) TryAcquire(bucket int, holder string) bool {
+	leases.mu.Lock()
+	defer leases.mu.Unlock()
+
+	now := time.Now()
+
+	if current, ok := leases.leases[bucket]; ok && current.holder != holder && now.Before(current.expires) {
+		return false
+	}
+
+	leases.leases[bucket] = lease{holder: holder, expires: now.Add(leases.ttl)}
+
+	return true
+}
+
+// Release gives up holder's lease on bucket. It is a no-op if holder doesn't
+// have the lease, as when it expired and was taken by another holder.
+func (leases *Leases) Release(bucket int, holder string) {
+	leases.mu.Lock()
+	defer leases.mu.Unlock()
+
+	if current, ok := leases.leases[bucket]; ok && current.holder == holder {
+		delete(leases.leases, bucket)
+	}
+}
+
+// Lock returns an IdentifyLock on leases, for the process serving them.
+func (leases *Leases) Lock() IdentifyLock {
+	return NewLeaseLock(
+		func(_ context.Context, bucket int, holder string) (bool, error) {
+			return leases.TryAcquire(bucket, holder), nil
+		},
+		func(_ context.Context, bucket int, holder string) error {
+			leases.Release(bucket, holder)
+			return nil
+		},
+	)
+}
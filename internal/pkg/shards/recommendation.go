@@ -0,0 +1,187 @@
+package shards
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/disgoorg/disgo/rest"
+)
+
+// CheckMode is how Check handles a shard count that requires resharding.
+type CheckMode string
+
+// CheckMode enumerations.
+const (
+	// CheckModeOff skips the check.
+	CheckModeOff CheckMode = "off"
+
+	// CheckModeWarn logs a warning and starts anyway.
+	CheckModeWarn CheckMode = "warn"
+
+	// CheckModeRefuse refuses to start.
+	CheckModeRefuse CheckMode = "refuse"
+)
+
+// MaxGuildsPerShard is the most guilds Discord allows a shard, closing shards
+// with more.
+const MaxGuildsPerShard = 2500
+
+// recommendedGuildsPerShard is the guilds per shard Discord's recommended
+// shard count is based on.
+const recommendedGuildsPerShard = 1000
+
+// ErrReshardingRequired is returned by Check in CheckModeRefuse when the
+// configured shard count doesn't meet Discord's sharding requirements.
+var ErrReshardingRequired = errors.New("resharding required")
+
+// RecommendationSource is the part of Discord's REST API FetchRecommendation
+// queries, such as a rest.Rest.
+type RecommendationSource interface {
+	rest.Gateway
+	rest.Applications
+}
+
+// Recommendation is Discord's recommended sharding for the bot, as reported by
+// the gateway bot endpoint.
+type Recommendation struct {
+	// ShardCount is the number of shards Discord recommends.
+	ShardCount int
+
+	// MaxConcurrency is the number of shards that may IDENTIFY in the same
+	// 5 second window.
+	MaxConcurrency int
+
+	// GuildCount is Discord's approximate count of the bot's guilds, or 0 if
+	// unknown.
+	GuildCount int
+}
+
+// ParseCheckMode parses mode into a CheckMode.
+func ParseCheckMode(mode string) (CheckMode, error) {
+	switch checkMode := CheckMode(strings.ToLower(mode)); checkMode {
+	case CheckModeOff, CheckModeWarn, CheckModeRefuse:
+		return checkMode, nil
+	default:
+		return "", fmt.Errorf("invalid shard count check mode: %q", mode)
+	}
+}
+
+// FetchRecommendation queries Discord's gateway bot endpoint for the bot's
+// recommended sharding, and the bot's application for its guild count. The
+// guild count is left unknown if the application can't be queried.
+func FetchRecommendation(ctx context.Context, source RecommendationSource) (Recommendation, error) {
+	gatewayBot, err := source.GetGatewayBot(rest.WithCtx(ctx))
+	if err != nil {
+		return Recommendation{}, fmt.Errorf("unable to query gateway bot: %w", err)
+	}
+
+	recommendation := Recommendation{
+		ShardCount:     gatewayBot.Shards,
+		MaxConcurrency: gatewayBot.SessionStartLimit.MaxConcurrency,
+	}
+
+	if application, err := source.GetCurrentApplication(rest.WithCtx(ctx)); err == nil && application.ApproximateGuildCount != nil {
+		recommendation.GuildCount = *application.ApproximateGuildCount
+	}
+
+	return recommendation, nil
+}
+
+// RequiredShardCount returns the fewest shards the bot's guilds fit in, at
+// MaxGuildsPerShard. When the guild count is unknown, it is estimated from the
+// recommended shard count.
+func (recommendation Recommendation) RequiredShardCount() int {
+	guildCount := recommendation.GuildCount
+	if guildCount == 0 {
+		guildCount = recommendation.ShardCount * recommendedGuildsPerShard
+	}
+
+	return max((guildCount+MaxGuildsPerShard-1)/MaxGuildsPerShard, 1)
+}
+
+// Problems returns the reasons shardCount requires resharding: too few shards
+// for the bot's guilds, which Discord enforces by closing shards with more
+// than MaxGuildsPerShard, or, for bots allowed concurrent IDENTIFYs, a count
+// that isn't a multiple of the max concurrency.
+func (recommendation Recommendation) Problems(shardCount int) []string {
+	var problems []string
+
+	if required := recommendation.RequiredShardCount(); shardCount < required {
+		problems = append(problems, fmt.Sprintf(
+			"shard count %d is below the %d required for %d guilds per shard", shardCount, required, MaxGuildsPerShard,
+		))
+	}
+
+	if recommendation.MaxConcurrency > 1 && shardCount%recommendation.MaxConcurrency != 0 {
+		problems = append(problems, fmt.Sprintf(
+			"shard count %d is not a multiple of max concurrency %d", shardCount, recommendation.MaxConcurrency,
+		))
+	}
+
+	return problems
+}
+
+// Warnings returns the reasons shardCount, while workable, falls short of
+// Discord's recommendation: fewer shards than recommended leaves little room
+// for the bot to grow before resharding is required.
+func (recommendation Recommendation) Warnings(shardCount int) []string {
+	if shardCount >= recommendation.ShardCount || shardCount < recommendation.RequiredShardCount() {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("shard count %d is below the recommended %d", shardCount, recommendation.ShardCount)}
+}
+
+// Check fetches Discord's recommended sharding and validates shardCount
+// against it, logging a warning or returning ErrReshardingRequired, per mode,
+// if resharding is required. A count merely below the recommendation is only
+// warned about, whatever the mode. It returns the recommendation, or the zero
+// Recommendation when the check is off or the recommendation can't be
+// fetched: the check is a safeguard, so being unable to make it doesn't
+// prevent startup.
+func Check(
+	ctx context.Context,
+	log *slog.Logger,
+	source RecommendationSource,
+	shardCount int,
+	mode CheckMode,
+) (Recommendation, error) {
+	if mode == CheckModeOff {
+		return Recommendation{}, nil
+	}
+
+	recommendation, err := FetchRecommendation(ctx, source)
+	if err != nil {
+		log.Warn("unable to check shard count: skipping", "error", err)
+		return Recommendation{}, nil
+	}
+
+	log.Info("gateway sharding recommendation",
+		"shardCount", shardCount,
+		"recommendedShardCount", recommendation.ShardCount,
+		"maxConcurrency", recommendation.MaxConcurrency,
+		"guildCount", recommendation.GuildCount,
+	)
+
+	for _, warning := range recommendation.Warnings(shardCount) {
+		log.Warn("shard count below recommendation", "problem", warning)
+	}
+
+	problems := recommendation.Problems(shardCount)
+	if len(problems) == 0 {
+		return recommendation, nil
+	}
+
+	if mode == CheckModeRefuse {
+		return recommendation, fmt.Errorf("%w: %s", ErrReshardingRequired, strings.Join(problems, "; "))
+	}
+
+	for _, problem := range problems {
+		log.Warn("resharding required", "problem", problem)
+	}
+
+	return recommendation, nil
+}
@@ -0,0 +1,149 @@
+package shards_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/disgoorg/disgo/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/mock"
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/shards"
+)
+
+const (
+	gatewayBotResponse = `{
+	"url": "wss://gateway.discord.gg",
+	"shards": 4,
+	"session_start_limit": {"total": 1000, "remaining": 999, "reset_after": 14400000, "max_concurrency": 2}
+}`
+
+	applicationResponse = `{"id": "1", "name": "test", "approximate_guild_count": 3600}`
+)
+
+func TestParseCheckMode(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []shards.CheckMode{shards.CheckModeOff, shards.CheckModeWarn, shards.CheckModeRefuse} {
+		checkMode, err := shards.ParseCheckMode(string(mode))
+		require.NoError(t, err)
+		assert.Equal(t, mode, checkMode)
+	}
+
+	_, err := shards.ParseCheckMode("auto")
+	assert.Error(t, err)
+}
+
+func TestRecommendation_Problems(t *testing.T) {
+	t.Parallel()
+
+	recommendation := shards.Recommendation{ShardCount: 4, MaxConcurrency: 2, GuildCount: 3600}
+
+	assert.Empty(t, recommendation.Problems(4))
+	assert.Empty(t, recommendation.Problems(6))
+	assert.Empty(t, recommendation.Problems(2), "below the recommendation refused")
+	assert.Len(t, recommendation.Problems(5), 1)
+	assert.Len(t, recommendation.Problems(1), 2)
+
+	assert.Empty(t, recommendation.Warnings(4))
+	assert.Len(t, recommendation.Warnings(2), 1)
+	assert.Empty(t, recommendation.Warnings(1), "insufficient count only warned about")
+
+	assert.Empty(t, shards.Recommendation{ShardCount: 1, MaxConcurrency: 1}.Problems(3))
+}
+
+func TestRecommendation_RequiredShardCount(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 2, shards.Recommendation{ShardCount: 4, GuildCount: 3600}.RequiredShardCount())
+	assert.Equal(t, 1, shards.Recommendation{ShardCount: 1, GuildCount: 10}.RequiredShardCount())
+
+	// Without a guild count, it is estimated from the recommendation.
+	assert.Equal(t, 2, shards.Recommendation{ShardCount: 5}.RequiredShardCount())
+	assert.Equal(t, 1, shards.Recommendation{}.RequiredShardCount())
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	source := newTestSource(t, http.StatusOK, gatewayBotResponse)
+
+	testCases := []struct {
+		name       string
+		shardCount int
+		mode       shards.CheckMode
+		expected   shards.Recommendation
+		err        error
+	}{
+		{name: "off", shardCount: 1, mode: shards.CheckModeOff},
+		{
+			name:       "valid",
+			shardCount: 4,
+			mode:       shards.CheckModeRefuse,
+			expected:   shards.Recommendation{ShardCount: 4, MaxConcurrency: 2, GuildCount: 3600},
+		},
+		{
+			name:       "warn",
+			shardCount: 1,
+			mode:       shards.CheckModeWarn,
+			expected:   shards.Recommendation{ShardCount: 4, MaxConcurrency: 2, GuildCount: 3600},
+		},
+		{
+			name:       "below recommendation",
+			shardCount: 2,
+			mode:       shards.CheckModeRefuse,
+			expected:   shards.Recommendation{ShardCount: 4, MaxConcurrency: 2, GuildCount: 3600},
+		},
+		{
+			name:       "refuse",
+			shardCount: 1,
+			mode:       shards.CheckModeRefuse,
+			expected:   shards.Recommendation{ShardCount: 4, MaxConcurrency: 2, GuildCount: 3600},
+			err:        shards.ErrReshardingRequired,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			recommendation, err := shards.Check(t.Context(), mock.NewLogger(), source, testCase.shardCount, testCase.mode)
+			require.ErrorIs(t, err, testCase.err)
+			assert.Equal(t, testCase.expected, recommendation)
+		})
+	}
+}
+
+func TestCheck_unavailable(t *testing.T) {
+	t.Parallel()
+
+	source := newTestSource(t, http.StatusInternalServerError, `{}`)
+
+	recommendation, err := shards.Check(t.Context(), mock.NewLogger(), source, 1, shards.CheckModeRefuse)
+	require.NoError(t, err)
+	assert.Zero(t, recommendation)
+}
+
+// newTestSource returns a RecommendationSource whose gateway bot endpoint
+// responds with status and body, and whose application has 3600 guilds.
+func newTestSource(t *testing.T, status int, body string) shards.RecommendationSource {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if strings.HasSuffix(r.URL.Path, "/applications/@me") {
+			_, _ = w.Write([]byte(applicationResponse))
+			return
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return rest.New(rest.NewClient("", rest.WithURL(server.URL), rest.WithHTTPClient(server.Client())))
+}
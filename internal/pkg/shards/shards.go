@@ -0,0 +1,74 @@
+// Package shards provides the configuration of the Discord gateway shards a
+// process manages.
+package shards
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParseIDs parses spec, a comma-separated list of shard IDs and inclusive
+// ranges of them such as "0-3" or "0,2,4-7", into the sorted, de-duplicated
+// shard IDs it names. Each must be less than shardCount.
+func ParseIDs(spec string, shardCount int) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, errors.New("no shard IDs")
+	}
+
+	var shardIDs []int
+
+	for part := range strings.SplitSeq(spec, ",") {
+		first, last, err := parseRange(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+
+		if last >= shardCount {
+			return nil, fmt.Errorf("shard ID %d out of range for shard count %d", last, shardCount)
+		}
+
+		for shardID := first; shardID <= last; shardID++ {
+			shardIDs = append(shardIDs, shardID)
+		}
+	}
+
+	slices.Sort(shardIDs)
+
+	return slices.Compact(shardIDs), nil
+}
+
+// parseRange parses part, a shard ID or an inclusive range of them, into its
+// first and last shard IDs.
+func parseRange(part string) (first, last int, err error) {
+	firstPart, lastPart, isRange := strings.Cut(part, "-")
+
+	if first, err = parseID(firstPart); err != nil {
+		return 0, 0, err
+	}
+
+	if !isRange {
+		return first, first, nil
+	}
+
+	if last, err = parseID(lastPart); err != nil {
+		return 0, 0, err
+	}
+
+	if last < first {
+		return 0, 0, fmt.Errorf("invalid shard ID range %q", part)
+	}
+
+	return first, last, nil
+}
+
+func parseID(value string) (int, error) {
+	shardID, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || shardID < 0 {
+		return 0, fmt.Errorf("invalid shard ID %q", value)
+	}
+
+	return shardID, nil
+}
@@ -0,0 +1,46 @@
+package shards_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/shards"
+)
+
+func TestParseIDs(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		spec       string
+		shardCount int
+		expected   []int
+	}{
+		{name: "single", spec: "2", shardCount: 4, expected: []int{2}},
+		{name: "range", spec: "0-3", shardCount: 4, expected: []int{0, 1, 2, 3}},
+		{name: "set", spec: "3, 1", shardCount: 4, expected: []int{1, 3}},
+		{name: "ranges and set", spec: "6-7,0-1,4", shardCount: 8, expected: []int{0, 1, 4, 6, 7}},
+		{name: "overlapping", spec: "0-2,1-3,2", shardCount: 4, expected: []int{0, 1, 2, 3}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			shardIDs, err := shards.ParseIDs(testCase.spec, testCase.shardCount)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, shardIDs)
+		})
+	}
+}
+
+func TestParseIDs_invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{"", " ", "a", "-1", "1-", "3-1", "0,,1", "0-4"} {
+		_, err := shards.ParseIDs(spec, 4)
+		assert.Error(t, err, spec)
+	}
+}
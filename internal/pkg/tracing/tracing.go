@@ -0,0 +1,133 @@
+// Package tracing provides OpenTelemetry tracing of Discord event handling,
+// exported over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// InstrumentationName is the name of the tracer spans are started with.
+const InstrumentationName = "github.com/ewohltman/ephemeral-roles"
+
+const (
+	defaultServiceName = "ephemeral-roles"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Span attribute keys shared by the spans of event handling.
+const (
+	GuildIDKey   = attribute.Key("discord.guild.id")
+	UserIDKey    = attribute.Key("discord.user.id")
+	ChannelIDKey = attribute.Key("discord.channel.id")
+	RoleIDKey    = attribute.Key("discord.role.id")
+)
+
+// Config contains fields for configuring trace export.
+type Config struct {
+	// Endpoint is the URL spans are exported to over OTLP/HTTP, for example
+	// http://otel-collector:4318/v1/traces. Headers, such as for
+	// authentication, are read from the standard OTEL_EXPORTER_OTLP_HEADERS
+	// environment variable.
+	Endpoint string
+
+	// SampleRatio is the fraction of events traced, from 0 to 1.
+	SampleRatio float64
+
+	// ServiceName is reported as the service.name resource attribute. It
+	// defaults to ephemeral-roles.
+	ServiceName string
+}
+
+// Provider provides the tracer spans are started with, and exports them.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewProvider returns a new *Provider exporting spans in batches to the
+// configured endpoint. It must be shut down to flush them.
+func NewProvider(config *Config) (*Provider, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(config.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP trace exporter: %w", err)
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	return &Provider{
+		provider: provider,
+		tracer:   provider.Tracer(InstrumentationName),
+	}, nil
+}
+
+// Tracer returns the tracer spans are started with. A nil *Provider returns
+// a no-op tracer, so tracing can be left unconfigured.
+func (p *Provider) Tracer() trace.Tracer {
+	if p == nil {
+		return noop.NewTracerProvider().Tracer(InstrumentationName)
+	}
+
+	return p.tracer
+}
+
+// Shutdown flushes the spans pending export and stops exporting.
+func (p *Provider) Shutdown() error {
+	if p == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return p.provider.Shutdown(ctx)
+}
+
+// Start starts a span named name as a child of the span in ctx, from the
+// provider that span was started with, so that operations are traced as part
+// of the event they serve without needing a tracer of their own. Outside a
+// traced event the span is a no-op.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(InstrumentationName)
+
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Wait records a span named name as a child of the span in ctx, covering the
+// time from since until now, for time spent waiting rather than working, such
+// as in a queue.
+func Wait(ctx context.Context, name string, since time.Time) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(InstrumentationName)
+
+	_, span := tracer.Start(ctx, name, trace.WithTimestamp(since))
+	span.End()
+}
@@ -0,0 +1,100 @@
+package tracing_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/tracing"
+)
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		requests.Add(1)
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider, err := tracing.NewProvider(&tracing.Config{
+		Endpoint:    server.URL + "/v1/traces",
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+
+	_, span := provider.Tracer().Start(t.Context(), "test")
+	span.End()
+
+	// Shutdown flushes the batch exporter.
+	require.NoError(t, provider.Shutdown())
+	assert.Positive(t, requests.Load())
+}
+
+func TestProvider_Nil(t *testing.T) {
+	t.Parallel()
+
+	var provider *tracing.Provider
+
+	_, span := provider.Tracer().Start(t.Context(), "test")
+	span.End()
+
+	assert.False(t, span.SpanContext().IsValid())
+	assert.NoError(t, provider.Shutdown())
+}
+
+func TestStart(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ctx, parent := tracer.Start(t.Context(), "parent")
+
+	queued := time.Now().Add(-time.Second)
+	tracing.Wait(ctx, "wait", queued)
+
+	_, child := tracing.Start(ctx, "child", tracing.GuildIDKey.String("1000"))
+	tracing.End(child, errors.New("test error"))
+
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	wait, ended, root := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "wait", wait.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), wait.Parent().SpanID())
+	assert.Equal(t, queued, wait.StartTime())
+
+	assert.Equal(t, "child", ended.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), ended.Parent().SpanID())
+	assert.Equal(t, codes.Error, ended.Status().Code)
+	assert.Contains(t, ended.Attributes(), tracing.GuildIDKey.String("1000"))
+}
+
+func TestStart_Untraced(t *testing.T) {
+	t.Parallel()
+
+	_, span := tracing.Start(t.Context(), "untraced")
+	tracing.End(span, nil)
+
+	assert.False(t, span.SpanContext().IsValid())
+}
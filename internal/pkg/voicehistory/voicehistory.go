@@ -0,0 +1,340 @@
+// Package voicehistory records the voice sessions of guild members, so their
+// recent voice activity and total time connected can be queried.
+package voicehistory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/atomicfile"
+)
+
+// Retention defaults, used when the corresponding Config field is unset.
+const (
+	DefaultMaxAge      = 30 * 24 * time.Hour
+	DefaultMaxPerGuild = 10000
+)
+
+// Session is a member's continuous connection to a single voice channel. End
+// is zero while the session is ongoing.
+type Session struct {
+	GuildID   snowflake.ID `json:"guildID"`
+	ChannelID snowflake.ID `json:"channelID"`
+	UserID    snowflake.ID `json:"userID"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end,omitzero"`
+}
+
+// Ongoing reports whether the member is still connected.
+func (session *Session) Ongoing() bool {
+	return session.End.IsZero()
+}
+
+// Duration returns how long the session lasted, or has lasted so far as of now
+// if it is ongoing.
+func (session *Session) Duration(now time.Time) time.Duration {
+	if session.Ongoing() {
+		return now.Sub(session.Start)
+	}
+
+	return session.End.Sub(session.Start)
+}
+
+// Query selects the sessions of a guild returned by Store.Query. A zero
+// UserID or ChannelID matches any member or channel.
+type Query struct {
+	GuildID   snowflake.ID
+	UserID    snowflake.ID
+	ChannelID snowflake.ID
+	Limit     int
+}
+
+// Config contains fields for configuring a Store.
+type Config struct {
+	// MaxAge is how long ended sessions are retained. It defaults to
+	// DefaultMaxAge.
+	MaxAge time.Duration
+
+	// MaxPerGuild caps the ended sessions retained per guild, discarding the
+	// oldest first. It defaults to DefaultMaxPerGuild.
+	MaxPerGuild int
+}
+
+// Store is a concurrency-safe, in-memory store of voice sessions, with
+// retention limits on the sessions it keeps. It can be persisted to and
+// restored from a local file with Save and Load.
+//
+// Ending a session only records it, as it happens on the gateway read loop;
+// the retention limits are applied by Prune, which is meant to be called
+// periodically, and by Load.
+type Store struct {
+	*Config
+
+	mu      sync.Mutex
+	ongoing map[memberKey]Session
+	ended   map[snowflake.ID][]Session
+}
+
+type memberKey struct {
+	guildID snowflake.ID
+	userID  snowflake.ID
+}
+
+// snapshot is the on-disk representation of a Store.
+type snapshot struct {
+	Ongoing []Session `json:"ongoing"`
+	Ended   []Session `json:"ended"`
+}
+
+// NewStore returns a new, empty *Store configured using the provided config.
+func NewStore(config *Config) *Store {
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+
+	if config.MaxPerGuild <= 0 {
+		config.MaxPerGuild = DefaultMaxPerGuild
+	}
+
+	return &Store{
+		Config:  config,
+		ongoing: make(map[memberKey]Session),
+		ended:   make(map[snowflake.ID][]Session),
+	}
+}
+
+// Transition records a member moving from oldChannelID to newChannelID at the
+// provided time, where a nil channel means not connected: it ends the member's
+// ongoing session, if it was for a different channel, and starts a new one if
+// the member is now connected.
+//
+// Members already connected when the bot started have no ongoing session, so
+// their first session is only recorded from their next join or move.
+func (store *Store) Transition(guildID, userID snowflake.ID, oldChannelID, newChannelID *snowflake.ID, at time.Time) {
+	if oldChannelID != nil && newChannelID != nil && *oldChannelID == *newChannelID {
+		return
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key := memberKey{guildID: guildID, userID: userID}
+
+	if session, ok := store.ongoing[key]; ok {
+		delete(store.ongoing, key)
+
+		session.End = at
+		store.end(session)
+	}
+
+	if newChannelID == nil {
+		return
+	}
+
+	store.ongoing[key] = Session{
+		GuildID:   guildID,
+		ChannelID: *newChannelID,
+		UserID:    userID,
+		Start:     at,
+	}
+}
+
+// Query returns the sessions matching query, most recently started first,
+// ongoing sessions included. Sessions past MaxAge are left out even before
+// Prune discards them.
+func (store *Store) Query(query Query) []Session {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var sessions []Session
+
+	matches := func(session *Session) bool {
+		return (query.UserID == 0 || session.UserID == query.UserID) &&
+			(query.ChannelID == 0 || session.ChannelID == query.ChannelID)
+	}
+
+	for key, session := range store.ongoing {
+		if key.guildID == query.GuildID && matches(&session) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	cutoff := time.Now().Add(-store.MaxAge)
+
+	for _, session := range store.ended[query.GuildID] {
+		if matches(&session) && !session.End.Before(cutoff) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.Start.Compare(a.Start)
+	})
+
+	if query.Limit > 0 && len(sessions) > query.Limit {
+		sessions = sessions[:query.Limit]
+	}
+
+	return sessions
+}
+
+// Purge discards every session recorded for guildID.
+func (store *Store) Purge(guildID snowflake.ID) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.ended, guildID)
+
+	for key := range store.ongoing {
+		if key.guildID == guildID {
+			delete(store.ongoing, key)
+		}
+	}
+}
+
+// Save writes the store's sessions to the file at path, replacing it only
+// once they are fully written, so that a kill mid-write doesn't lose them.
+func (store *Store) Save(path string) error {
+	store.mu.Lock()
+
+	data := snapshot{}
+
+	for _, session := range store.ongoing {
+		data.Ongoing = append(data.Ongoing, session)
+	}
+
+	for _, sessions := range store.ended {
+		data.Ended = append(data.Ended, sessions...)
+	}
+
+	store.mu.Unlock()
+
+	contents, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("unable to marshal voice history: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(path, contents); err != nil {
+		return fmt.Errorf("unable to write voice history: %w", err)
+	}
+
+	return nil
+}
+
+// Load restores the sessions saved to the file at path by Save, applying the
+// store's retention limits. A missing file is not an error: there is nothing
+// to restore on first start.
+//
+// Sessions that were ongoing when the store was saved are restored as ended
+// at the time they were saved, since whether the member stayed connected
+// while the bot was down is unknown.
+func (store *Store) Load(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("unable to read voice history: %w", err)
+	}
+
+	data := snapshot{}
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return fmt.Errorf("unable to unmarshal voice history: %w", err)
+	}
+
+	savedAt := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		savedAt = info.ModTime()
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, session := range data.Ended {
+		store.end(session)
+	}
+
+	for _, session := range data.Ongoing {
+		session.End = savedAt
+		store.end(session)
+	}
+
+	now := time.Now()
+
+	for guildID := range store.ended {
+		store.prune(guildID, now)
+	}
+
+	return nil
+}
+
+// end adds an ended session to its guild's history. The caller must hold
+// store.mu.
+func (store *Store) end(session Session) {
+	store.ended[session.GuildID] = append(store.ended[session.GuildID], session)
+}
+
+// Prune applies the retention limits as of now to the ended sessions. The
+// guilds are pruned one at a time, so that recording sessions isn't held up
+// for the whole store.
+func (store *Store) Prune(now time.Time) {
+	store.mu.Lock()
+	guildIDs := slices.Collect(maps.Keys(store.ended))
+	store.mu.Unlock()
+
+	for _, guildID := range guildIDs {
+		store.mu.Lock()
+		store.prune(guildID, now)
+		store.mu.Unlock()
+	}
+}
+
+// prune applies the retention limits as of now to guildID's ended sessions.
+// The caller must hold store.mu.
+func (store *Store) prune(guildID snowflake.ID, now time.Time) {
+	sessions, ok := store.ended[guildID]
+	if !ok {
+		return
+	}
+
+	cutoff := now.Add(-store.MaxAge)
+
+	sessions = slices.DeleteFunc(sessions, func(session Session) bool {
+		return session.End.Before(cutoff)
+	})
+
+	if excess := len(sessions) - store.MaxPerGuild; excess > 0 {
+		slices.SortFunc(sessions, func(a, b Session) int {
+			return a.End.Compare(b.End)
+		})
+
+		sessions = slices.Delete(sessions, 0, excess)
+	}
+
+	if len(sessions) == 0 {
+		delete(store.ended, guildID)
+		return
+	}
+
+	store.ended[guildID] = sessions
+}
+
+// TotalDuration returns the combined duration of sessions as of now.
+func TotalDuration(sessions []Session, now time.Time) time.Duration {
+	var total time.Duration
+
+	for i := range sessions {
+		total += sessions[i].Duration(now)
+	}
+
+	return total
+}
@@ -0,0 +1,116 @@
+package voicehistory_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ewohltman/ephemeral-roles/internal/pkg/voicehistory"
+)
+
+const (
+	testGuildID    snowflake.ID = 1000
+	testUserID     snowflake.ID = 1001
+	testOtherUser  snowflake.ID = 1002
+	testChannelID  snowflake.ID = 1003
+	testChannel2ID snowflake.ID = 1004
+)
+
+func TestStore_Transition(t *testing.T) {
+	t.Parallel()
+
+	store := voicehistory.NewStore(&voicehistory.Config{})
+	start := time.Now().Add(-time.Hour)
+
+	store.Transition(testGuildID, testUserID, nil, new(testChannelID), start)
+
+	// A mute or deafen within the same channel doesn't split the session.
+	store.Transition(testGuildID, testUserID, new(testChannelID), new(testChannelID), start.Add(time.Minute))
+
+	store.Transition(testGuildID, testUserID, new(testChannelID), new(testChannel2ID), start.Add(10*time.Minute))
+	store.Transition(testGuildID, testOtherUser, nil, new(testChannel2ID), start.Add(15*time.Minute))
+	store.Transition(testGuildID, testUserID, new(testChannel2ID), nil, start.Add(30*time.Minute))
+
+	sessions := store.Query(voicehistory.Query{GuildID: testGuildID, UserID: testUserID})
+	require.Len(t, sessions, 2)
+
+	assert.Equal(t, testChannel2ID, sessions[0].ChannelID)
+	assert.Equal(t, 20*time.Minute, sessions[0].Duration(time.Now()))
+	assert.Equal(t, testChannelID, sessions[1].ChannelID)
+	assert.Equal(t, 10*time.Minute, sessions[1].Duration(time.Now()))
+	assert.Equal(t, 30*time.Minute, voicehistory.TotalDuration(sessions, time.Now()))
+
+	sessions = store.Query(voicehistory.Query{GuildID: testGuildID, ChannelID: testChannel2ID})
+	require.Len(t, sessions, 2)
+	assert.Equal(t, testOtherUser, sessions[0].UserID)
+	assert.True(t, sessions[0].Ongoing())
+
+	sessions = store.Query(voicehistory.Query{GuildID: testGuildID, Limit: 1})
+	require.Len(t, sessions, 1)
+
+	store.Purge(testGuildID)
+	assert.Empty(t, store.Query(voicehistory.Query{GuildID: testGuildID}))
+}
+
+func TestStore_retention(t *testing.T) {
+	t.Parallel()
+
+	store := voicehistory.NewStore(&voicehistory.Config{MaxAge: time.Hour, MaxPerGuild: 2})
+	now := time.Now()
+
+	// Older than MaxAge, so never returned.
+	store.Transition(testGuildID, testUserID, nil, new(testChannelID), now.Add(-3*time.Hour))
+	store.Transition(testGuildID, testUserID, new(testChannelID), nil, now.Add(-2*time.Hour))
+	assert.Empty(t, store.Query(voicehistory.Query{GuildID: testGuildID}))
+
+	for i := range 3 {
+		at := now.Add(time.Duration(i-3) * 10 * time.Minute)
+
+		store.Transition(testGuildID, testUserID, nil, new(testChannelID), at)
+		store.Transition(testGuildID, testUserID, new(testChannelID), nil, at.Add(time.Minute))
+	}
+
+	sessions := store.Query(voicehistory.Query{GuildID: testGuildID})
+	require.Len(t, sessions, 3, "MaxPerGuild applied before Prune")
+
+	store.Prune(now)
+
+	sessions = store.Query(voicehistory.Query{GuildID: testGuildID})
+	require.Len(t, sessions, 2, "MaxPerGuild not applied")
+	assert.Equal(t, now.Add(-10*time.Minute), sessions[0].Start)
+	assert.Equal(t, now.Add(-20*time.Minute), sessions[1].Start)
+}
+
+func TestStore_SaveLoad(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "voicehistory.json")
+	start := time.Now().Add(-time.Hour).Round(0)
+
+	store := voicehistory.NewStore(&voicehistory.Config{})
+
+	require.NoError(t, store.Load(path), "missing file treated as an error")
+
+	store.Transition(testGuildID, testUserID, nil, new(testChannelID), start)
+	store.Transition(testGuildID, testUserID, new(testChannelID), nil, start.Add(time.Minute))
+	store.Transition(testGuildID, testOtherUser, nil, new(testChannelID), start)
+
+	require.NoError(t, store.Save(path))
+
+	restored := voicehistory.NewStore(&voicehistory.Config{})
+	require.NoError(t, restored.Load(path))
+
+	sessions := restored.Query(voicehistory.Query{GuildID: testGuildID, UserID: testUserID})
+	require.Len(t, sessions, 1)
+	assert.Equal(t, time.Minute, sessions[0].Duration(time.Now()))
+
+	// The ongoing session is restored as ended, so it isn't extended by
+	// the time the bot was down.
+	sessions = restored.Query(voicehistory.Query{GuildID: testGuildID, UserID: testOtherUser})
+	require.Len(t, sessions, 1)
+	assert.False(t, sessions[0].Ongoing())
+}